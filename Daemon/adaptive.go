@@ -0,0 +1,224 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SamplerStatus es el estado del muestreo adaptativo (API).
+type SamplerStatus struct {
+	Enabled        bool             `json:"enabled"`
+	IntervalsMs    map[string]int64 `json:"intervals_ms"` // por colector
+	MinIntervalMs  int64            `json:"min_interval_ms"`
+	MaxIntervalMs  int64            `json:"max_interval_ms"`
+	Reason         string           `json:"reason"`
+	StableSamples  int              `json:"stable_samples"`
+	LastContainers int              `json:"last_containers"`
+	ChangedTsMs    int64            `json:"changed_ts_ms,omitempty"`
+}
+
+// adaptiveSampler ajusta el intervalo de cada colector adaptativo: arranca en
+// el configurado para ese colector, lo baja al mínimo cuando CPU/RAM del host
+// superan los umbrales o la cantidad de contenedores cambia rápido, y lo
+// duplica (hasta el máximo) tras varias muestras estables.
+type adaptiveSampler struct {
+	mu             sync.Mutex
+	intervals      map[string]time.Duration
+	reason         string
+	stable         int
+	lastContainers int
+	haveContainers bool
+	changedTs      time.Time
+	// se cierra (y se reemplaza) cada vez que cambia algún intervalo
+	changed chan struct{}
+}
+
+var sampler = &adaptiveSampler{
+	intervals: make(map[string]time.Duration),
+	changed:   make(chan struct{}),
+}
+
+// reset fija el intervalo inicial de cada colector.
+func (s *adaptiveSampler) reset(bases map[string]time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.intervals = make(map[string]time.Duration, len(bases))
+	for name, iv := range bases {
+		s.intervals[name] = iv
+	}
+	s.reason = "inicial"
+}
+
+func samplingBounds() (time.Duration, time.Duration) {
+	return time.Duration(cfg.MinSampleIntervalSeconds) * time.Second,
+		time.Duration(cfg.MaxSampleIntervalSeconds) * time.Second
+}
+
+// Interval devuelve la función de intervalo del colector para runAligned.
+func (s *adaptiveSampler) Interval(name string) func() time.Duration {
+	return func() time.Duration {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.intervals[name]
+	}
+}
+
+// Changed devuelve un canal que se cierra en el próximo cambio de intervalo.
+func (s *adaptiveSampler) Changed() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.changed
+}
+
+// notifyLocked despierta a los colectores que esperan su próximo tick.
+func (s *adaptiveSampler) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.changedTs = time.Now()
+}
+
+// ObserveHost evalúa la muestra de sysinfo.
+func (s *adaptiveSampler) ObserveHost(si SysInfo) {
+	if !cfg.AdaptiveSampling {
+		return
+	}
+	cpuPct := float64(si.CPUUsagePct)
+	ramPct := 0.0
+	if si.TotalRAMKB > 0 {
+		ramPct = float64(si.RamUsedKB) * 100.0 / float64(si.TotalRAMKB)
+	}
+
+	switch {
+	case cfg.FastSampleCPUPct > 0 && cpuPct >= cfg.FastSampleCPUPct:
+		s.speedUp(fmt.Sprintf("CPU %.0f%%", cpuPct))
+	case cfg.FastSampleRAMPct > 0 && ramPct >= cfg.FastSampleRAMPct:
+		s.speedUp(fmt.Sprintf("RAM %.0f%%", ramPct))
+	default:
+		s.calm()
+	}
+}
+
+// ObserveContainers evalúa el cambio en la cantidad de contenedores.
+func (s *adaptiveSampler) ObserveContainers(count int) {
+	if !cfg.AdaptiveSampling {
+		return
+	}
+	s.mu.Lock()
+	delta := count - s.lastContainers
+	have := s.haveContainers
+	s.lastContainers = count
+	s.haveContainers = true
+	s.mu.Unlock()
+
+	if delta < 0 {
+		delta = -delta
+	}
+	if have && cfg.FastSampleContainerDelta > 0 && delta >= cfg.FastSampleContainerDelta {
+		s.speedUp(fmt.Sprintf("%d contenedores cambiaron", delta))
+	}
+}
+
+func (s *adaptiveSampler) speedUp(reason string) {
+	minIv, _ := samplingBounds()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stable = 0
+	s.reason = reason
+	changed := false
+	for name, iv := range s.intervals {
+		if iv != minIv {
+			fmt.Printf(" Muestreo adaptativo: %s %s -> %s (%s)\n", name, iv, minIv, reason)
+			s.intervals[name] = minIv
+			changed = true
+		}
+	}
+	if changed {
+		s.notifyLocked()
+	}
+}
+
+func (s *adaptiveSampler) calm() {
+	_, maxIv := samplingBounds()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stable++
+	if s.stable < cfg.StableSamplesToSlowDown {
+		return
+	}
+	changed := false
+	for name, iv := range s.intervals {
+		if iv >= maxIv {
+			continue
+		}
+		next := iv * 2
+		if next > maxIv {
+			next = maxIv
+		}
+		fmt.Printf(" Muestreo adaptativo: %s %s -> %s (estable)\n", name, iv, next)
+		s.intervals[name] = next
+		changed = true
+	}
+	if changed {
+		s.reason = "estable"
+		s.stable = 0
+		s.notifyLocked()
+	}
+}
+
+func (s *adaptiveSampler) Status() SamplerStatus {
+	minIv, maxIv := samplingBounds()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := SamplerStatus{
+		Enabled:        cfg.AdaptiveSampling,
+		IntervalsMs:    make(map[string]int64, len(s.intervals)),
+		MinIntervalMs:  minIv.Milliseconds(),
+		MaxIntervalMs:  maxIv.Milliseconds(),
+		Reason:         s.reason,
+		StableSamples:  s.stable,
+		LastContainers: s.lastContainers,
+	}
+	for name, iv := range s.intervals {
+		st.IntervalsMs[name] = iv.Milliseconds()
+	}
+	if !s.changedTs.IsZero() {
+		st.ChangedTsMs = s.changedTs.UnixMilli()
+	}
+	return st
+}
+
+// sampleIntervalMs es el intervalo real entre dos muestras del kernel (0 si no hay previa).
+func sampleIntervalMs(prevTsMs, currTsMs int64) int64 {
+	if prevTsMs <= 0 || currTsMs <= prevTsMs {
+		return 0
+	}
+	return currTsMs - prevTsMs
+}
+
+// MigrateSampleIntervalColumns agrega el intervalo real de muestreo a DBs existentes.
+func MigrateSampleIntervalColumns(db *sql.DB) error {
+	for _, table := range []string{"system_metrics", "container_host_metrics"} {
+		if err := addColumnIfMissing(db, table, "sample_interval_ms", "BIGINT"); err != nil {
+			return err
+		}
+	}
+	return addColumnIfMissing(db, "collector_cycles", "actual_interval_ms", "BIGINT")
+}
+
+// MigrateTickColumns agrega el tick del ciclo (tick_ts_ms) a las tablas que se
+// unen entre colectores: system_metrics usa el ts_ms del módulo y
+// host_pressure_metrics el de su lectura, así que se unen por el tick.
+func MigrateTickColumns(db *sql.DB) error {
+	for _, table := range []string{"system_metrics", "host_pressure_metrics"} {
+		if err := addColumnIfMissing(db, table, "tick_ts_ms", "BIGINT"); err != nil {
+			return err
+		}
+		idx := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%s_tick ON %s(tick_ts_ms);`, table, table)
+		if _, err := db.Exec(idx); err != nil {
+			return fmt.Errorf("error creando índice idx_%s_tick: %w", table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveSamplerPerCollector(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.AdaptiveSampling = true
+	cfg.MinSampleIntervalSeconds = 5
+	cfg.MaxSampleIntervalSeconds = 60
+	cfg.FastSampleCPUPct = 90
+	cfg.StableSamplesToSlowDown = 1
+
+	s := &adaptiveSampler{changed: make(chan struct{})}
+	s.reset(map[string]time.Duration{
+		"sysinfo": 10 * time.Second,
+		"host":    40 * time.Second,
+	})
+	sys, host := s.Interval("sysinfo"), s.Interval("host")
+	if sys() != 10*time.Second || host() != 40*time.Second {
+		t.Fatalf("intervalos iniciales = %s, %s; se esperaban los configurados", sys(), host())
+	}
+
+	wake := s.Changed()
+	s.ObserveHost(SysInfo{CPUUsagePct: 95})
+	select {
+	case <-wake:
+	default:
+		t.Fatalf("acelerar no avisó a los colectores")
+	}
+	if sys() != 5*time.Second || host() != 5*time.Second {
+		t.Errorf("con carga = %s, %s; se esperaba el mínimo", sys(), host())
+	}
+
+	steps := []struct{ sys, host time.Duration }{
+		{10 * time.Second, 10 * time.Second},
+		{20 * time.Second, 20 * time.Second},
+		{40 * time.Second, 40 * time.Second},
+		{60 * time.Second, 60 * time.Second},
+		{60 * time.Second, 60 * time.Second},
+	}
+	for i, want := range steps {
+		s.ObserveHost(SysInfo{CPUUsagePct: 10})
+		if sys() != want.sys || host() != want.host {
+			t.Errorf("muestra estable %d = %s, %s; se esperaba %s, %s", i, sys(), host(), want.sys, want.host)
+		}
+	}
+}
+
+// Un colector esperando un tick largo se reprograma en cuanto el intervalo baja.
+func TestRunAlignedRearmsOnIntervalChange(t *testing.T) {
+	s := &adaptiveSampler{changed: make(chan struct{})}
+	s.reset(map[string]time.Duration{"test": time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ticks := make(chan time.Duration, 10)
+	go runAligned(ctx, "test", s.Interval("test"), s.Changed, func(rec *cycleRecord) {
+		ticks <- rec.Interval
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	s.mu.Lock()
+	s.intervals["test"] = 50 * time.Millisecond
+	s.notifyLocked()
+	s.mu.Unlock()
+
+	select {
+	case iv := <-ticks:
+		if iv != 50*time.Millisecond {
+			t.Errorf("ciclo con intervalo %s, se esperaba 50ms", iv)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("el colector siguió esperando el tick de 1h")
+	}
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Alcance de una regla de alerta
+const (
+	alertScopeHost      = "host"
+	alertScopeProcess   = "process"
+	alertScopeContainer = "container"
+)
+
+// Estados de una alerta
+const (
+	alertPending  = "pending"
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+	// pending que se canceló antes de disparar: no se notifica ni queda en el historial
+	alertCancelled = "cancelled"
+)
+
+// alertMetrics son las métricas que acepta cada alcance.
+var alertMetrics = map[string][]string{
+	alertScopeHost:      {"ram_pct", "cpu_pct", "available_kb", "procs"},
+	alertScopeProcess:   {"rss_kb", "cpu_pct"},
+	alertScopeContainer: {"mem_kb", "mem_pct_of_limit", "cpu_pct", "throttled_pct"},
+}
+
+// AlertRule es una regla evaluada en cada ciclo del orquestador. Con
+// RateWindowSeconds > 0 se compara el cambio por minuto de la métrica en esa
+// ventana en lugar de su valor.
+type AlertRule struct {
+	Name              string   `json:"name"`
+	Scope             string   `json:"scope"`
+	Metric            string   `json:"metric"`
+	Op                string   `json:"op"` // >, >=, <, <=
+	Threshold         float64  `json:"threshold"`
+	ForSeconds        int      `json:"for_seconds"` // tiempo en pending antes de disparar
+	RateWindowSeconds int      `json:"rate_window_seconds"`
+	Severity          string   `json:"severity"`
+	Notifiers         []string `json:"notifiers"` // vacío = todos
+}
+
+func (r AlertRule) validate(notifiers []NotifierSpec) error {
+	if r.Name == "" {
+		return fmt.Errorf("regla de alerta sin name")
+	}
+	metrics, ok := alertMetrics[r.Scope]
+	if !ok {
+		return fmt.Errorf("regla %q: scope desconocido %q", r.Name, r.Scope)
+	}
+	found := false
+	for _, m := range metrics {
+		if m == r.Metric {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("regla %q: métrica %q no existe para scope %s (válidas: %v)", r.Name, r.Metric, r.Scope, metrics)
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=":
+	default:
+		return fmt.Errorf("regla %q: op desconocido %q", r.Name, r.Op)
+	}
+	if r.ForSeconds < 0 || r.RateWindowSeconds < 0 {
+		return fmt.Errorf("regla %q: for_seconds y rate_window_seconds no pueden ser negativos", r.Name)
+	}
+	for _, name := range r.Notifiers {
+		known := false
+		for _, n := range notifiers {
+			if n.Name == name {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("regla %q: notificador %q no definido", r.Name, name)
+		}
+	}
+	return nil
+}
+
+func (r AlertRule) matches(v float64) bool {
+	switch r.Op {
+	case ">":
+		return v > r.Threshold
+	case ">=":
+		return v >= r.Threshold
+	case "<":
+		return v < r.Threshold
+	case "<=":
+		return v <= r.Threshold
+	}
+	return false
+}
+
+// alertSample es el valor de una métrica para un objetivo en este ciclo.
+type alertSample struct {
+	TargetID string
+	Name     string
+	Value    float64
+}
+
+// alertInputs son las últimas muestras de los colectores.
+type alertInputs struct {
+	Sys     *SysInfo
+	Tree    *ProcTree
+	CgStats []CgroupStats
+	CgUsage map[string]CgroupUsage
+}
+
+// available indica si este ciclo hay muestras del alcance de la regla. Sin
+// ellas (primer ciclo, módulo recargándose) la regla no se evalúa: la falta de
+// datos no es una recuperación.
+func (in alertInputs) available(r AlertRule) bool {
+	switch r.Scope {
+	case alertScopeHost:
+		return in.Sys != nil
+	case alertScopeProcess:
+		return in.Sys != nil && (r.Metric != "cpu_pct" || in.Tree != nil)
+	case alertScopeContainer:
+		return in.CgUsage != nil
+	}
+	return false
+}
+
+// samples extrae la métrica de la regla para cada objetivo de su alcance.
+func (in alertInputs) samples(r AlertRule) []alertSample {
+	switch r.Scope {
+	case alertScopeHost:
+		if in.Sys == nil {
+			return nil
+		}
+		si := in.Sys
+		var v float64
+		switch r.Metric {
+		case "ram_pct":
+			if si.TotalRAMKB == 0 {
+				return nil
+			}
+			v = float64(si.RamUsedKB) * 100.0 / float64(si.TotalRAMKB)
+		case "cpu_pct":
+			v = float64(si.CPUUsagePct)
+		case "available_kb":
+			v = float64(si.AvailableKB)
+		case "procs":
+			v = float64(si.TotalProcs)
+		}
+		return []alertSample{{TargetID: "host", Name: "host", Value: v}}
+
+	case alertScopeProcess:
+		if in.Sys == nil {
+			return nil
+		}
+		out := make([]alertSample, 0, len(in.Sys.Procesos))
+		for _, p := range in.Sys.Procesos {
+			s := alertSample{
+				TargetID: strconv.Itoa(p.Pid) + ":" + strconv.FormatUint(p.StartTimeNs, 10),
+				Name:     p.Comm,
+			}
+			switch r.Metric {
+			case "rss_kb":
+				s.Value = float64(p.RssKB)
+			case "cpu_pct":
+				if in.Tree == nil {
+					continue
+				}
+				node, ok := in.Tree.ByPid[p.Pid]
+				if !ok {
+					continue
+				}
+				s.Value = node.CPUPct
+			}
+			out = append(out, s)
+		}
+		return out
+
+	case alertScopeContainer:
+		out := make([]alertSample, 0, len(in.CgStats))
+		for _, st := range in.CgStats {
+			u := in.CgUsage[st.ContainerID]
+			s := alertSample{TargetID: st.ContainerID, Name: st.Name}
+			switch r.Metric {
+			case "mem_kb":
+				s.Value = float64(st.MemCurrentBytes / 1024)
+			case "mem_pct_of_limit":
+				if st.MemMaxBytes == 0 {
+					continue
+				}
+				s.Value = u.MemPctOfLimit
+			case "cpu_pct":
+				s.Value = u.CPUPct
+			case "throttled_pct":
+				s.Value = u.ThrottledPct
+			}
+			out = append(out, s)
+		}
+		return out
+	}
+	return nil
+}
+
+// AlertTransition es un cambio de estado de una alerta (se persiste y, si es
+// firing o resolved, se notifica).
+type AlertTransition struct {
+	Fingerprint string  `json:"fingerprint"`
+	Rule        string  `json:"rule"`
+	Severity    string  `json:"severity,omitempty"`
+	Scope       string  `json:"scope"`
+	Metric      string  `json:"metric"`
+	Op          string  `json:"op"`
+	Threshold   float64 `json:"threshold"`
+	Rate        bool    `json:"rate,omitempty"` // Value es cambio por minuto
+	TargetID    string  `json:"target_id"`
+	TargetName  string  `json:"target_name"`
+	State       string  `json:"state"`
+	Value       float64 `json:"value"`
+	TsMs        int64   `json:"ts_ms"`
+	SinceTsMs   int64   `json:"since_ts_ms"`
+	Message     string  `json:"message"`
+
+	notifiers []string
+}
+
+type alertPoint struct {
+	TsMs  int64
+	Value float64
+}
+
+// alertState es una alerta en curso (pending o firing).
+type alertState struct {
+	state     string
+	sinceTsMs int64
+	value     float64
+	name      string
+}
+
+// alertEngine evalúa las reglas y deduplica: cada objetivo de una regla tiene
+// una sola alerta (fingerprint), que solo notifica al pasar a firing y a resolved.
+type alertEngine struct {
+	mu      sync.Mutex
+	states  map[string]*alertState
+	history map[string][]alertPoint // para reglas de tasa
+}
+
+var alerts = &alertEngine{
+	states:  make(map[string]*alertState),
+	history: make(map[string][]alertPoint),
+}
+
+func alertFingerprint(rule, target string) string {
+	return rule + "|" + target
+}
+
+// Evaluate aplica las reglas sobre las muestras y devuelve las transiciones.
+func (e *alertEngine) Evaluate(now time.Time, rules []AlertRule, in alertInputs) []AlertTransition {
+	nowMs := now.UnixMilli()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var out []AlertTransition
+	seen := make(map[string]bool)
+	seenHistory := make(map[string]bool)
+	unavailable := make(map[string]bool)
+
+	for _, r := range rules {
+		if !in.available(r) {
+			unavailable[r.Name] = true
+			continue
+		}
+		for _, smp := range in.samples(r) {
+			fp := alertFingerprint(r.Name, smp.TargetID)
+			value, ok := smp.Value, true
+			if r.RateWindowSeconds > 0 {
+				seenHistory[fp] = true
+				value, ok = e.rate(fp, nowMs, smp.Value, int64(r.RateWindowSeconds)*1000)
+			}
+			if !ok || !r.matches(value) {
+				continue
+			}
+			seen[fp] = true
+
+			st, exists := e.states[fp]
+			if !exists {
+				st = &alertState{state: alertPending, sinceTsMs: nowMs}
+				e.states[fp] = st
+			}
+			st.value = value
+			st.name = smp.Name
+			if !exists && r.ForSeconds > 0 {
+				out = append(out, newTransition(r, smp.TargetID, st, alertPending, nowMs))
+			}
+			if st.state == alertPending && nowMs-st.sinceTsMs >= int64(r.ForSeconds)*1000 {
+				st.state = alertFiring
+				out = append(out, newTransition(r, smp.TargetID, st, alertFiring, nowMs))
+			}
+		}
+	}
+
+	// alertas cuya condición dejó de cumplirse (u objetivo que ya no existe)
+	byName := make(map[string]AlertRule, len(rules))
+	for _, r := range rules {
+		byName[r.Name] = r
+	}
+	for fp, st := range e.states {
+		if seen[fp] {
+			continue
+		}
+		rule, target := splitFingerprint(fp)
+		if unavailable[rule] {
+			continue
+		}
+		r, ok := byName[rule]
+		if !ok {
+			r = AlertRule{Name: rule}
+		}
+		if st.state == alertFiring {
+			out = append(out, newTransition(r, target, st, alertResolved, nowMs))
+		} else {
+			out = append(out, newTransition(r, target, st, alertCancelled, nowMs))
+		}
+		delete(e.states, fp)
+	}
+	for fp := range e.history {
+		if rule, _ := splitFingerprint(fp); !seenHistory[fp] && !unavailable[rule] {
+			delete(e.history, fp)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Fingerprint < out[j].Fingerprint })
+	return out
+}
+
+// rate guarda el punto y devuelve el cambio por minuto en la ventana. Hace
+// falta haber cubierto al menos la mitad de la ventana para tener valor.
+func (e *alertEngine) rate(fp string, nowMs int64, v float64, windowMs int64) (float64, bool) {
+	pts := append(e.history[fp], alertPoint{TsMs: nowMs, Value: v})
+	cut := 0
+	for cut < len(pts) && nowMs-pts[cut].TsMs > windowMs {
+		cut++
+	}
+	pts = pts[cut:]
+	e.history[fp] = pts
+
+	first := pts[0]
+	span := nowMs - first.TsMs
+	if span <= 0 || span < windowMs/2 {
+		return 0, false
+	}
+	return (v - first.Value) * 60000.0 / float64(span), true
+}
+
+func splitFingerprint(fp string) (string, string) {
+	for i := len(fp) - 1; i >= 0; i-- {
+		if fp[i] == '|' {
+			return fp[:i], fp[i+1:]
+		}
+	}
+	return fp, ""
+}
+
+func newTransition(r AlertRule, target string, st *alertState, state string, nowMs int64) AlertTransition {
+	t := AlertTransition{
+		Fingerprint: alertFingerprint(r.Name, target),
+		Rule:        r.Name,
+		Severity:    r.Severity,
+		Scope:       r.Scope,
+		Metric:      r.Metric,
+		Op:          r.Op,
+		Threshold:   r.Threshold,
+		Rate:        r.RateWindowSeconds > 0,
+		TargetID:    target,
+		TargetName:  st.name,
+		State:       state,
+		Value:       st.value,
+		TsMs:        nowMs,
+		SinceTsMs:   st.sinceTsMs,
+		notifiers:   r.Notifiers,
+	}
+	metric := r.Metric
+	if t.Rate {
+		metric += "/min"
+	}
+	switch state {
+	case alertCancelled:
+		t.Message = fmt.Sprintf("%s: %s %s se normalizó antes de disparar", r.Name, r.Scope, st.name)
+	case alertResolved:
+		t.Message = fmt.Sprintf("[RESUELTA] %s: %s %s volvió a la normalidad", r.Name, r.Scope, st.name)
+	default:
+		t.Message = fmt.Sprintf("[%s] %s: %s %s %s=%.2f %s %.2f",
+			state, r.Name, r.Scope, st.name, metric, st.value, r.Op, r.Threshold)
+	}
+	return t
+}
+
+// Active devuelve las alertas en pending o firing.
+func (e *alertEngine) Active() []AlertTransition {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := []AlertTransition{}
+	for fp, st := range e.states {
+		rule, target := splitFingerprint(fp)
+		out = append(out, AlertTransition{
+			Fingerprint: fp,
+			Rule:        rule,
+			TargetID:    target,
+			TargetName:  st.name,
+			State:       st.state,
+			Value:       st.value,
+			SinceTsMs:   st.sinceTsMs,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Fingerprint < out[j].Fingerprint })
+	return out
+}
+
+// Restore retoma las alertas en curso guardadas antes de un reinicio. Las que
+// ya no se cumplan se resuelven (y notifican) en el próximo Evaluate.
+func (e *alertEngine) Restore(active []AlertTransition) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, t := range active {
+		if t.State != alertPending && t.State != alertFiring {
+			continue
+		}
+		e.states[t.Fingerprint] = &alertState{
+			state:     t.State,
+			sinceTsMs: t.SinceTsMs,
+			value:     t.Value,
+			name:      t.TargetName,
+		}
+	}
+}
+
+func CreateAlertTables(db *sql.DB) error {
+	current := `
+    CREATE TABLE IF NOT EXISTS alerts (
+        fingerprint     VARCHAR(256) PRIMARY KEY,
+        rule            VARCHAR(128) NOT NULL,
+        severity        VARCHAR(32),
+        scope           VARCHAR(16) NOT NULL,
+        target_id       VARCHAR(128) NOT NULL,
+        target_name     TEXT,
+        state           VARCHAR(16) NOT NULL,
+        value           REAL,
+        since_ts_ms     BIGINT NOT NULL,
+        fired_ts_ms     BIGINT,
+        resolved_ts_ms  BIGINT,
+        updated_ts_ms   BIGINT NOT NULL
+    );
+    `
+	if _, err := db.Exec(current); err != nil {
+		return fmt.Errorf("error creando tabla alerts: %w", err)
+	}
+
+	events := `
+    CREATE TABLE IF NOT EXISTS alert_events (
+        id           INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms        BIGINT NOT NULL,
+        fingerprint  VARCHAR(256) NOT NULL,
+        rule         VARCHAR(128) NOT NULL,
+        severity     VARCHAR(32),
+        scope        VARCHAR(16) NOT NULL,
+        metric       VARCHAR(32),
+        target_id    VARCHAR(128) NOT NULL,
+        target_name  TEXT,
+        state        VARCHAR(16) NOT NULL,
+        value        REAL,
+        threshold    REAL,
+        message      TEXT,
+        created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(events); err != nil {
+		return fmt.Errorf("error creando tabla alert_events: %w", err)
+	}
+	idx := `CREATE INDEX IF NOT EXISTS idx_alert_events_ts ON alert_events(ts_ms);`
+	if _, err := db.Exec(idx); err != nil {
+		return fmt.Errorf("error creando índice idx_alert_events_ts: %w", err)
+	}
+	return nil
+}
+
+// InsertAlertTransitions guarda el historial y actualiza el estado actual de
+// cada alerta. Una alerta pending que se cancela se borra de alerts.
+func InsertAlertTransitions(db *sql.DB, transitions []AlertTransition) error {
+	for _, t := range transitions {
+		if t.State == alertCancelled {
+			if _, err := db.Exec(`DELETE FROM alerts WHERE fingerprint = ? AND state = 'pending';`, t.Fingerprint); err != nil {
+				return fmt.Errorf("error borrando alerta %s de alerts: %w", t.Fingerprint, err)
+			}
+			continue
+		}
+		if _, err := db.Exec(`
+            INSERT INTO alert_events (
+                ts_ms,
+                fingerprint,
+                rule,
+                severity,
+                scope,
+                metric,
+                target_id,
+                target_name,
+                state,
+                value,
+                threshold,
+                message
+            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+        `,
+			t.TsMs,
+			t.Fingerprint,
+			t.Rule,
+			nullIfEmpty(t.Severity),
+			t.Scope,
+			nullIfEmpty(t.Metric),
+			t.TargetID,
+			nullIfEmpty(t.TargetName),
+			t.State,
+			t.Value,
+			t.Threshold,
+			t.Message,
+		); err != nil {
+			return fmt.Errorf("error insertando alerta %s en alert_events: %w", t.Fingerprint, err)
+		}
+
+		var fired, resolved interface{}
+		switch t.State {
+		case alertFiring:
+			fired = t.TsMs
+		case alertResolved:
+			resolved = t.TsMs
+		}
+		if _, err := db.Exec(`
+            INSERT INTO alerts (
+                fingerprint, rule, severity, scope, target_id, target_name,
+                state, value, since_ts_ms, fired_ts_ms, resolved_ts_ms, updated_ts_ms
+            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            ON CONFLICT(fingerprint) DO UPDATE SET
+                severity       = excluded.severity,
+                target_name    = excluded.target_name,
+                state          = excluded.state,
+                value          = excluded.value,
+                since_ts_ms    = excluded.since_ts_ms,
+                fired_ts_ms    = CASE WHEN excluded.state = 'resolved' THEN alerts.fired_ts_ms
+                                      ELSE excluded.fired_ts_ms END,
+                resolved_ts_ms = excluded.resolved_ts_ms,
+                updated_ts_ms  = excluded.updated_ts_ms;
+        `,
+			t.Fingerprint,
+			t.Rule,
+			nullIfEmpty(t.Severity),
+			t.Scope,
+			t.TargetID,
+			nullIfEmpty(t.TargetName),
+			t.State,
+			t.Value,
+			t.SinceTsMs,
+			fired,
+			resolved,
+			t.TsMs,
+		); err != nil {
+			return fmt.Errorf("error actualizando alerta %s en alerts: %w", t.Fingerprint, err)
+		}
+	}
+	return nil
+}
+
+// QueryAlertEvents devuelve el historial de alertas (más recientes primero).
+func QueryAlertEvents(db *sql.DB, limit int) ([]AlertTransition, error) {
+	rows, err := db.Query(`
+        SELECT ts_ms, fingerprint, rule, COALESCE(severity, ''), scope, COALESCE(metric, ''),
+               target_id, COALESCE(target_name, ''), state, COALESCE(value, 0),
+               COALESCE(threshold, 0), COALESCE(message, '')
+        FROM alert_events
+        ORDER BY ts_ms DESC, id DESC
+        LIMIT ?;
+    `, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando alert_events: %w", err)
+	}
+	defer rows.Close()
+
+	var result []AlertTransition
+	for rows.Next() {
+		var t AlertTransition
+		if err := rows.Scan(&t.TsMs, &t.Fingerprint, &t.Rule, &t.Severity, &t.Scope, &t.Metric,
+			&t.TargetID, &t.TargetName, &t.State, &t.Value, &t.Threshold, &t.Message); err != nil {
+			return nil, fmt.Errorf("error leyendo alert_events: %w", err)
+		}
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+// LoadActiveAlerts devuelve las alertas pending o firing de alerts.
+func LoadActiveAlerts(db *sql.DB) ([]AlertTransition, error) {
+	rows, err := db.Query(`
+        SELECT fingerprint, rule, COALESCE(severity, ''), scope, target_id,
+               COALESCE(target_name, ''), state, COALESCE(value, 0), since_ts_ms
+        FROM alerts
+        WHERE state IN ('pending', 'firing');
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var result []AlertTransition
+	for rows.Next() {
+		var t AlertTransition
+		if err := rows.Scan(&t.Fingerprint, &t.Rule, &t.Severity, &t.Scope, &t.TargetID,
+			&t.TargetName, &t.State, &t.Value, &t.SinceTsMs); err != nil {
+			return nil, fmt.Errorf("error leyendo alerts: %w", err)
+		}
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
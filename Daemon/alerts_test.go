@@ -0,0 +1,66 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Una alerta firing guardada antes de un reinicio se retoma y, si la condición
+// ya no se cumple, se resuelve en la primera evaluación.
+func TestAlertsRestoredAfterRestart(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := CreateAlertTables(db); err != nil {
+		t.Fatal(err)
+	}
+
+	rule := AlertRule{Name: "host_ram_alta", Scope: alertScopeHost, Metric: "ram_pct", Op: ">=", Threshold: 95}
+	high := alertInputs{Sys: &SysInfo{TotalRAMKB: 100, RamUsedKB: 97}}
+	low := alertInputs{Sys: &SysInfo{TotalRAMKB: 100, RamUsedKB: 40}}
+	start := time.UnixMilli(1000)
+
+	before := &alertEngine{states: make(map[string]*alertState), history: make(map[string][]alertPoint)}
+	if err := InsertAlertTransitions(db, before.Evaluate(start, []AlertRule{rule}, high)); err != nil {
+		t.Fatal(err)
+	}
+
+	active, err := LoadActiveAlerts(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].State != alertFiring || active[0].SinceTsMs != 1000 {
+		t.Fatalf("alertas en curso = %+v", active)
+	}
+
+	// reinicio: motor nuevo
+	after := &alertEngine{states: make(map[string]*alertState), history: make(map[string][]alertPoint)}
+	after.Restore(active)
+
+	// primer ciclo tras el reinicio, todavía sin muestra del host: sigue firing
+	if got := after.Evaluate(start.Add(30*time.Second), []AlertRule{rule}, alertInputs{}); len(got) != 0 {
+		t.Errorf("transiciones sin muestra = %+v, no se esperaba ninguna", got)
+	}
+
+	// la condición sigue: no se vuelve a disparar
+	if got := after.Evaluate(start.Add(time.Minute), []AlertRule{rule}, high); len(got) != 0 {
+		t.Errorf("transiciones con la condición vigente = %+v, no se esperaba ninguna", got)
+	}
+
+	got := after.Evaluate(start.Add(2*time.Minute), []AlertRule{rule}, low)
+	if len(got) != 1 || got[0].State != alertResolved || got[0].SinceTsMs != 1000 {
+		t.Fatalf("transiciones = %+v, se esperaba una resolved", got)
+	}
+	if err := InsertAlertTransitions(db, got); err != nil {
+		t.Fatal(err)
+	}
+	if active, err := LoadActiveAlerts(db); err != nil || len(active) != 0 {
+		t.Errorf("alertas en curso tras resolver = %+v (err %v)", active, err)
+	}
+}
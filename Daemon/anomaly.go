@@ -0,0 +1,291 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Series vigiladas por el detector de anomalías
+const (
+	streamHostCPUPct    = "host_cpu_pct"
+	streamHostRAMUsedKB = "host_ram_used_kb"
+	streamContainers    = "container_count"
+)
+
+// anomalyStreamSpec es el piso de la desviación de cada serie: evita que una
+// serie casi constante (p.ej. contenedores) dé z enormes ante cambios mínimos.
+type anomalyStreamSpec struct {
+	MinStd    float64 // absoluto
+	MinStdPct float64 // % de la media
+}
+
+var anomalyStreams = map[string]anomalyStreamSpec{
+	streamHostCPUPct:    {MinStd: 2},
+	streamHostRAMUsedKB: {MinStdPct: 1},
+	streamContainers:    {MinStd: 1},
+}
+
+// AnomalyEvent es una muestra fuera de la banda esperada de su serie.
+type AnomalyEvent struct {
+	TsMs      int64   `json:"ts_ms"`
+	Stream    string  `json:"stream"`
+	Value     float64 `json:"value"`
+	Baseline  float64 `json:"baseline"`
+	StdDev    float64 `json:"stddev"`
+	ZScore    float64 `json:"z_score"`
+	Direction string  `json:"direction"` // high o low
+	Lower     float64 `json:"lower"`
+	Upper     float64 `json:"upper"`
+}
+
+// ewmaBaseline es la media y varianza móviles exponenciales de una serie,
+// junto con la última muestra anómala para agrupar episodios.
+type ewmaBaseline struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Samples  int     `json:"samples"`
+	LastTsMs int64   `json:"last_ts_ms"`
+
+	LastAnomalyTsMs int64  `json:"last_anomaly_ts_ms"`
+	LastDirection   string `json:"last_direction"`
+}
+
+// AnomalyStatus es la línea base actual de una serie (API).
+type AnomalyStatus struct {
+	Stream   string  `json:"stream"`
+	Mean     float64 `json:"mean"`
+	StdDev   float64 `json:"stddev"`
+	Samples  int     `json:"samples"`
+	WarmedUp bool    `json:"warmed_up"`
+	Lower    float64 `json:"lower"`
+	Upper    float64 `json:"upper"`
+}
+
+// anomalyDetector compara cada muestra con la EWMA de su serie: si
+// |x - media| / desviación supera el umbral (tras el calentamiento) es anomalía.
+type anomalyDetector struct {
+	mu        sync.Mutex
+	baselines map[string]*ewmaBaseline
+}
+
+var anomalies = &anomalyDetector{baselines: make(map[string]*ewmaBaseline)}
+
+// effectiveStd aplica el piso de la serie a la desviación.
+func effectiveStd(stream string, b *ewmaBaseline) float64 {
+	spec := anomalyStreams[stream]
+	std := math.Sqrt(b.Variance)
+	floor := math.Max(spec.MinStd, math.Abs(b.Mean)*spec.MinStdPct/100)
+	return math.Max(std, floor)
+}
+
+// Observe evalúa una muestra contra la línea base previa y luego la actualiza.
+// Devuelve el evento si la muestra es anómala y abre un episodio nuevo: un
+// cambio de nivel sostenido da un solo evento, no uno por muestra.
+func (d *anomalyDetector) Observe(stream string, tsMs int64, value float64) *AnomalyEvent {
+	if !cfg.AnomalyDetection {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b, ok := d.baselines[stream]
+	if !ok {
+		d.baselines[stream] = &ewmaBaseline{Mean: value, Samples: 1, LastTsMs: tsMs}
+		return nil
+	}
+
+	var ev *AnomalyEvent
+	if b.Samples >= cfg.AnomalyWarmupSamples {
+		std := effectiveStd(stream, b)
+		z := (value - b.Mean) / std
+		if math.Abs(z) >= cfg.AnomalyZThreshold {
+			ev = &AnomalyEvent{
+				TsMs:      tsMs,
+				Stream:    stream,
+				Value:     value,
+				Baseline:  b.Mean,
+				StdDev:    std,
+				ZScore:    z,
+				Direction: "high",
+				Lower:     b.Mean - cfg.AnomalyZThreshold*std,
+				Upper:     b.Mean + cfg.AnomalyZThreshold*std,
+			}
+			if z < 0 {
+				ev.Direction = "low"
+			}
+
+			cooldown := int64(cfg.AnomalyCooldownSeconds) * 1000
+			sameEpisode := b.LastAnomalyTsMs > 0 && ev.Direction == b.LastDirection &&
+				tsMs-b.LastAnomalyTsMs < cooldown
+			b.LastAnomalyTsMs = tsMs
+			b.LastDirection = ev.Direction
+			if sameEpisode {
+				ev = nil
+			}
+		}
+	}
+
+	// EWMA de media y varianza (West, 1979)
+	alpha := cfg.AnomalyAlpha
+	diff := value - b.Mean
+	b.Mean += alpha * diff
+	b.Variance = (1 - alpha) * (b.Variance + alpha*diff*diff)
+	b.Samples++
+	b.LastTsMs = tsMs
+	return ev
+}
+
+// ObserveHost alimenta las series de CPU y RAM del host.
+func (d *anomalyDetector) ObserveHost(si SysInfo) []AnomalyEvent {
+	tsMs := int64(si.TsMs)
+	ramUsed := si.RamUsedKB
+	if ramUsed == 0 && si.TotalRAMKB > 0 {
+		ramUsed = si.TotalRAMKB - si.FreeRAMKB
+	}
+	var out []AnomalyEvent
+	if ev := d.Observe(streamHostCPUPct, tsMs, float64(si.CPUUsagePct)); ev != nil {
+		out = append(out, *ev)
+	}
+	if ev := d.Observe(streamHostRAMUsedKB, tsMs, float64(ramUsed)); ev != nil {
+		out = append(out, *ev)
+	}
+	return out
+}
+
+// ObserveContainers alimenta la serie de cantidad de contenedores.
+func (d *anomalyDetector) ObserveContainers(tsMs int64, count int) []AnomalyEvent {
+	if ev := d.Observe(streamContainers, tsMs, float64(count)); ev != nil {
+		return []AnomalyEvent{*ev}
+	}
+	return nil
+}
+
+func (d *anomalyDetector) Status() []AnomalyStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := []AnomalyStatus{}
+	for stream, b := range d.baselines {
+		std := effectiveStd(stream, b)
+		out = append(out, AnomalyStatus{
+			Stream:   stream,
+			Mean:     b.Mean,
+			StdDev:   std,
+			Samples:  b.Samples,
+			WarmedUp: b.Samples >= cfg.AnomalyWarmupSamples,
+			Lower:    b.Mean - cfg.AnomalyZThreshold*std,
+			Upper:    b.Mean + cfg.AnomalyZThreshold*std,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Stream < out[j].Stream })
+	return out
+}
+
+func reportAnomalies(events []AnomalyEvent) {
+	for _, ev := range events {
+		logger.Warn("anomalía detectada", "serie", ev.Stream, "valor", ev.Value,
+			"linea_base", fmt.Sprintf("%.2f", ev.Baseline), "z", fmt.Sprintf("%.2f", ev.ZScore))
+	}
+}
+
+func CreateAnomalyEventsTable(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS anomaly_events (
+        id          INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms       BIGINT NOT NULL,
+        stream      VARCHAR(32) NOT NULL,
+        value       REAL NOT NULL,
+        baseline    REAL NOT NULL,
+        stddev      REAL NOT NULL,
+        z_score     REAL NOT NULL,
+        direction   VARCHAR(8) NOT NULL,
+        lower_bound REAL,
+        upper_bound REAL,
+        created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla anomaly_events: %w", err)
+	}
+
+	idx := `CREATE INDEX IF NOT EXISTS idx_anomaly_events_ts ON anomaly_events(stream, ts_ms);`
+	if _, err := db.Exec(idx); err != nil {
+		return fmt.Errorf("error creando índice idx_anomaly_events_ts: %w", err)
+	}
+
+	// Anotaciones para superponer en los paneles de Grafana (datasource SQLite)
+	view := `
+    CREATE VIEW IF NOT EXISTS anomaly_annotations AS
+    SELECT
+        ts_ms AS time,
+        printf('Anomalía %s (%s): %.1f vs línea base %.1f (z=%.1f)',
+               stream, direction, value, baseline, z_score) AS text,
+        'anomaly,' || stream AS tags
+    FROM anomaly_events;
+    `
+	if _, err := db.Exec(view); err != nil {
+		return fmt.Errorf("error creando vista anomaly_annotations: %w", err)
+	}
+	return nil
+}
+
+func InsertAnomalyEvents(db *sql.DB, events []AnomalyEvent) error {
+	for _, ev := range events {
+		_, err := db.Exec(`
+            INSERT INTO anomaly_events (
+                ts_ms,
+                stream,
+                value,
+                baseline,
+                stddev,
+                z_score,
+                direction,
+                lower_bound,
+                upper_bound
+            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+        `,
+			ev.TsMs,
+			ev.Stream,
+			ev.Value,
+			ev.Baseline,
+			ev.StdDev,
+			ev.ZScore,
+			ev.Direction,
+			ev.Lower,
+			ev.Upper,
+		)
+		if err != nil {
+			return fmt.Errorf("error insertando anomalía de %s en anomaly_events: %w", ev.Stream, err)
+		}
+	}
+	return nil
+}
+
+// QueryAnomalyEvents devuelve las últimas anomalías (stream "" = todas).
+func QueryAnomalyEvents(db *sql.DB, stream string, limit int) ([]AnomalyEvent, error) {
+	rows, err := db.Query(`
+        SELECT ts_ms, stream, value, baseline, stddev, z_score, direction,
+               COALESCE(lower_bound, 0), COALESCE(upper_bound, 0)
+        FROM anomaly_events
+        WHERE ? = '' OR stream = ?
+        ORDER BY ts_ms DESC, id DESC
+        LIMIT ?;
+    `, stream, stream, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando anomaly_events: %w", err)
+	}
+	defer rows.Close()
+
+	var result []AnomalyEvent
+	for rows.Next() {
+		var ev AnomalyEvent
+		if err := rows.Scan(&ev.TsMs, &ev.Stream, &ev.Value, &ev.Baseline, &ev.StdDev,
+			&ev.ZScore, &ev.Direction, &ev.Lower, &ev.Upper); err != nil {
+			return nil, fmt.Errorf("error leyendo anomaly_events: %w", err)
+		}
+		result = append(result, ev)
+	}
+	return result, rows.Err()
+}
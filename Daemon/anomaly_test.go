@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+// Un cambio de nivel sostenido da un solo evento; tras el cooldown sin
+// anomalías, o en la dirección opuesta, se registra otro.
+func TestAnomalyCooldown(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = defaultConfig()
+	cfg.AnomalyWarmupSamples = 5
+	cfg.AnomalyZThreshold = 3
+	cfg.AnomalyAlpha = 0.01 // la línea base casi no se mueve durante la prueba
+
+	cases := []struct {
+		name     string
+		cooldown int
+		want     int
+	}{
+		{name: "con cooldown", cooldown: 60, want: 3},
+		{name: "sin cooldown", cooldown: 0, want: 8},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.AnomalyCooldownSeconds = tc.cooldown
+			d := &anomalyDetector{baselines: make(map[string]*ewmaBaseline)}
+
+			ts := int64(0)
+			observe := func(v float64, n int) int {
+				events := 0
+				for i := 0; i < n; i++ {
+					ts += 10000
+					if d.Observe(streamHostCPUPct, ts, v) != nil {
+						events++
+					}
+				}
+				return events
+			}
+
+			got := observe(10, 10)   // calentamiento
+			got += observe(1000, 5)  // episodio alto sostenido
+			got += observe(10, 10)   // vuelve a la normalidad: 100 s > cooldown
+			got += observe(1000, 1)  // episodio nuevo
+			got += observe(-1000, 2) // dirección opuesta
+			if got != tc.want {
+				t.Errorf("eventos = %d, se esperaban %d", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Dirección de la API HTTP local del daemon
+const apiAddr = "127.0.0.1:8090"
+
+// StartAPIServer levanta la API en segundo plano. Solo lectura de la DB
+// y del estado en memoria del daemon.
+func StartAPIServer(addr string, db *sql.DB) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/containers/exits", func(w http.ResponseWriter, r *http.Request) {
+		limit := queryInt(r, "limit", 50)
+		exits, err := QueryContainerExits(db, limit)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, exits)
+	})
+
+	mux.HandleFunc("/api/stops", func(w http.ResponseWriter, r *http.Request) {
+		counters, inFlight := stopper.Status()
+		writeJSON(w, map[string]interface{}{
+			"counters":  counters,
+			"in_flight": inFlight,
+		})
+	})
+
+	mux.HandleFunc("/api/workload", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, workload.Status())
+	})
+
+	// POST /api/workload/start con un escenario JSON opcional (si no, el de la config)
+	mux.HandleFunc("/api/workload/start", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("usar POST"))
+			return
+		}
+		scn := cfg.Workload
+		if r.ContentLength != 0 {
+			scn = WorkloadScenario{}
+			if err := json.NewDecoder(r.Body).Decode(&scn); err != nil {
+				writeJSONError(w, http.StatusBadRequest, fmt.Errorf("escenario inválido: %w", err))
+				return
+			}
+		}
+		if err := workload.Start(scn); err != nil {
+			writeJSONError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, workload.Status())
+	})
+
+	mux.HandleFunc("/api/workload/stop", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("usar POST"))
+			return
+		}
+		workload.Stop()
+		writeJSON(w, workload.Status())
+	})
+
+	mux.HandleFunc("/api/processes", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, supervisor.Status())
+	})
+
+	// árbol de procesos del último snapshot; ?root=PID devuelve solo ese subárbol
+	mux.HandleFunc("/api/process-tree", func(w http.ResponseWriter, r *http.Request) {
+		tree := collected.procTree()
+		if tree == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, fmt.Errorf("aún no hay snapshot de sysinfo"))
+			return
+		}
+		if root := queryInt(r, "root", 0); root != 0 {
+			node, ok := tree.ByPid[root]
+			if !ok {
+				writeJSONError(w, http.StatusNotFound, fmt.Errorf("PID %d no está en el snapshot", root))
+				return
+			}
+			writeJSON(w, node)
+			return
+		}
+		writeJSON(w, tree.Roots)
+	})
+
+	// eventos de procesos colgados (D) y zombies (Z); ?kind=hung_task|zombie
+	mux.HandleFunc("/api/process-events", func(w http.ResponseWriter, r *http.Request) {
+		events, err := QueryProcessStateEvents(db, r.URL.Query().Get("kind"), queryInt(r, "limit", 50))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, events)
+	})
+
+	// fugas activas (tendencia actual) e historial persistido
+	mux.HandleFunc("/api/leaks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, leaks.Active())
+	})
+
+	mux.HandleFunc("/api/leaks/history", func(w http.ResponseWriter, r *http.Request) {
+		findings, err := QueryLeakFindings(db, queryInt(r, "limit", 50))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, findings)
+	})
+
+	// líneas base actuales e historial de anomalías (?stream=host_cpu_pct|...)
+	mux.HandleFunc("/api/anomalies", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, anomalies.Status())
+	})
+
+	mux.HandleFunc("/api/anomalies/history", func(w http.ResponseWriter, r *http.Request) {
+		events, err := QueryAnomalyEvents(db, r.URL.Query().Get("stream"), queryInt(r, "limit", 50))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, events)
+	})
+
+	// alertas en pending/firing, historial y estado de los notificadores
+	mux.HandleFunc("/api/alerts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, alerts.Active())
+	})
+
+	mux.HandleFunc("/api/alerts/history", func(w http.ResponseWriter, r *http.Request) {
+		events, err := QueryAlertEvents(db, queryInt(r, "limit", 50))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, events)
+	})
+
+	mux.HandleFunc("/api/alerts/notifiers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, dispatcher.Status())
+	})
+
+	// POST /api/alerts/test envía una alerta de prueba a todos los notificadores
+	mux.HandleFunc("/api/alerts/test", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("usar POST"))
+			return
+		}
+		writeJSON(w, dispatcher.SendTest())
+	})
+
+	mux.HandleFunc("/api/pipeline", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, writer.Status())
+	})
+
+	mux.HandleFunc("/api/sampling", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, sampler.Status())
+	})
+
+	mux.HandleFunc("/api/modules", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, kmods.Status())
+	})
+
+	mux.HandleFunc("/api/scenario", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, scenarios.Status())
+	})
+
+	// POST /api/scenario/start?file=escenario.yaml
+	mux.HandleFunc("/api/scenario/start", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("usar POST"))
+			return
+		}
+		scn, err := LoadScenario(r.URL.Query().Get("file"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := scenarios.Start(scn); err != nil {
+			writeJSONError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, scenarios.Status())
+	})
+
+	mux.HandleFunc("/api/scenario/stop", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("usar POST"))
+			return
+		}
+		scenarios.Stop()
+		writeJSON(w, scenarios.Status())
+	})
+
+	go func() {
+		fmt.Println("API del daemon escuchando en http://" + addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Println("Error en API del daemon:", err)
+		}
+	}()
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Println("Error escribiendo respuesta JSON:", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func queryInt(r *http.Request, key string, def int) int {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
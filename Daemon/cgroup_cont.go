@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Raíz del cgroupfs v2. Es variable para poder apuntar a un árbol falso.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// containerCgroupDir busca el directorio cgroup v2 de un contenedor docker
+// (ID completo). Soporta el driver systemd y el driver cgroupfs.
+func containerCgroupDir(root, fullID string) (string, error) {
+	if fullID == "" {
+		return "", fmt.Errorf("ID de contenedor vacío")
+	}
+
+	candidates := []string{
+		filepath.Join(root, "system.slice", "docker-"+fullID+".scope"),
+		filepath.Join(root, "docker", fullID),
+		filepath.Join(root, "docker.slice", "docker-"+fullID+".scope"),
+	}
+	for _, dir := range candidates {
+		if st, err := os.Stat(dir); err == nil && st.IsDir() {
+			return dir, nil
+		}
+	}
+
+	// último recurso: buscar el scope en cualquier slice de primer nivel
+	matches, _ := filepath.Glob(filepath.Join(root, "*", "*"+fullID+"*"))
+	for _, dir := range matches {
+		if st, err := os.Stat(dir); err == nil && st.IsDir() {
+			return dir, nil
+		}
+	}
+
+	return "", fmt.Errorf("no se encontró cgroup para el contenedor %s en %s", shortID(fullID), root)
+}
+
+// readCgroupKeyValues lee archivos "clave valor" como memory.events o cpu.stat.
+func readCgroupKeyValues(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo abrir %s: %w", path, err)
+	}
+	defer f.Close()
+
+	result := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) != 2 {
+			continue
+		}
+		val, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		result[parts[0]] = val
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", path, err)
+	}
+	return result, nil
+}
+
+// readCgroupUint lee archivos de un solo valor (memory.current, pids.current).
+// "max" se devuelve como 0 con unlimited=true.
+func readCgroupUint(path string) (val uint64, unlimited bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false, fmt.Errorf("no se pudo leer %s: %w", path, err)
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, true, nil
+	}
+	val, err = strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("valor inválido en %s: %q", path, s)
+	}
+	return val, false, nil
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// CgroupStats son los contadores cgroup v2 de un contenedor en un instante.
+type CgroupStats struct {
+	TsMs        int64
+	ContainerID string
+	Name        string
+
+	// cpu.stat / cpu.max
+	CPUUsageUsec  uint64
+	CPUUserUsec   uint64
+	CPUSystemUsec uint64
+	NrPeriods     uint64
+	NrThrottled   uint64
+	ThrottledUsec uint64
+	CPULimitCores float64 // 0 = sin límite
+
+	// memory.current / memory.max / memory.stat
+	MemCurrentBytes uint64
+	MemMaxBytes     uint64 // 0 = sin límite
+	MemAnonBytes    uint64
+	MemFileBytes    uint64
+	MemKernelBytes  uint64
+
+	// io.stat (sumado sobre todos los dispositivos)
+	IOReadBytes  uint64
+	IOWriteBytes uint64
+	IOReadOps    uint64
+	IOWriteOps   uint64
+
+	// pids.current
+	PidsCurrent uint64
+}
+
+// ReadCgroupStats lee los archivos cgroup v2 de un directorio de contenedor.
+// memory.current y cpu.stat son obligatorios; el resto es opcional.
+func ReadCgroupStats(dir string) (CgroupStats, error) {
+	var st CgroupStats
+
+	cpuStat, err := readCgroupKeyValues(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return st, err
+	}
+	st.CPUUsageUsec = cpuStat["usage_usec"]
+	st.CPUUserUsec = cpuStat["user_usec"]
+	st.CPUSystemUsec = cpuStat["system_usec"]
+	st.NrPeriods = cpuStat["nr_periods"]
+	st.NrThrottled = cpuStat["nr_throttled"]
+	st.ThrottledUsec = cpuStat["throttled_usec"]
+
+	if cores, err := readCgroupCPUMax(filepath.Join(dir, "cpu.max")); err == nil {
+		st.CPULimitCores = cores
+	}
+
+	st.MemCurrentBytes, _, err = readCgroupUint(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return st, err
+	}
+	if memMax, unlimited, err := readCgroupUint(filepath.Join(dir, "memory.max")); err == nil && !unlimited {
+		st.MemMaxBytes = memMax
+	}
+
+	if memStat, err := readCgroupKeyValues(filepath.Join(dir, "memory.stat")); err == nil {
+		st.MemAnonBytes = memStat["anon"]
+		st.MemFileBytes = memStat["file"]
+		// "kernel" existe desde 5.18; antes hay que sumar sus partes
+		if k, ok := memStat["kernel"]; ok {
+			st.MemKernelBytes = k
+		} else {
+			st.MemKernelBytes = memStat["kernel_stack"] + memStat["slab"] + memStat["sock"] + memStat["pagetables"]
+		}
+	}
+
+	if rb, wb, rios, wios, err := readCgroupIOStat(filepath.Join(dir, "io.stat")); err == nil {
+		st.IOReadBytes, st.IOWriteBytes, st.IOReadOps, st.IOWriteOps = rb, wb, rios, wios
+	}
+
+	if pids, _, err := readCgroupUint(filepath.Join(dir, "pids.current")); err == nil {
+		st.PidsCurrent = pids
+	}
+
+	return st, nil
+}
+
+// readCgroupCPUMax interpreta cpu.max ("$MAX $PERIOD") como núcleos; "max" = 0.
+func readCgroupCPUMax(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("no se pudo leer %s: %w", path, err)
+	}
+	parts := strings.Fields(string(data))
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("formato inválido en %s: %q", path, string(data))
+	}
+	if parts[0] == "max" {
+		return 0, nil
+	}
+	quota, err1 := strconv.ParseFloat(parts[0], 64)
+	period, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil || period <= 0 {
+		return 0, fmt.Errorf("valores inválidos en %s: %q", path, string(data))
+	}
+	return quota / period, nil
+}
+
+// readCgroupIOStat suma rbytes/wbytes/rios/wios de todas las líneas de io.stat.
+func readCgroupIOStat(path string) (rbytes, wbytes, rios, wios uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("no se pudo abrir %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			v, perr := strconv.ParseUint(kv[1], 10, 64)
+			if perr != nil {
+				continue
+			}
+			switch kv[0] {
+			case "rbytes":
+				rbytes += v
+			case "wbytes":
+				wbytes += v
+			case "rios":
+				rios += v
+			case "wios":
+				wios += v
+			}
+		}
+	}
+	return rbytes, wbytes, rios, wios, scanner.Err()
+}
+
+// CollectCgroupStats lee las estadísticas de todos los contenedores dados.
+// Los que no tienen cgroup (ya terminaron, cgroup v1) se omiten.
+func CollectCgroupStats(root string, containers []ContainerInfo, tsMs int64) []CgroupStats {
+	var result []CgroupStats
+	for _, c := range containers {
+		dir, err := containerCgroupDir(root, c.ID)
+		if err != nil {
+			continue
+		}
+		st, err := ReadCgroupStats(dir)
+		if err != nil {
+			fmt.Printf("Error leyendo cgroup de %s: %v\n", c.Name, err)
+			continue
+		}
+		st.TsMs = tsMs
+		st.ContainerID = c.ID
+		st.Name = c.Name
+		result = append(result, st)
+	}
+	return result
+}
+
+// CgroupUsage son las tasas derivadas entre dos lecturas del mismo contenedor.
+type CgroupUsage struct {
+	HasDelta      bool    // hubo lectura previa válida; sin ella CPU y throttling no tienen valor
+	CPUPct        float64 // sobre todos los CPUs del host
+	CPUPctOfLimit float64 // sobre cpu.max (0 si no hay límite)
+	ThrottledPct  float64 // periodos con throttling / periodos
+	ThrottledUsec uint64  // tiempo throttled en el intervalo
+	MemPctOfLimit float64 // memory.current / memory.max (0 si no hay límite)
+}
+
+// BuildCgroupUsage calcula el uso por contenedor respecto a la lectura previa.
+func BuildCgroupUsage(prev map[string]CgroupStats, curr []CgroupStats, numCPUs int) map[string]CgroupUsage {
+	result := make(map[string]CgroupUsage, len(curr))
+
+	for _, c := range curr {
+		var u CgroupUsage
+		if c.MemMaxBytes > 0 {
+			u.MemPctOfLimit = float64(c.MemCurrentBytes) * 100.0 / float64(c.MemMaxBytes)
+		}
+
+		p, ok := prev[c.ContainerID]
+		if ok && c.TsMs > p.TsMs && c.CPUUsageUsec >= p.CPUUsageUsec {
+			deltaWallUsec := float64(c.TsMs-p.TsMs) * 1000.0
+			deltaCPU := float64(c.CPUUsageUsec - p.CPUUsageUsec)
+			u.HasDelta = true
+
+			if numCPUs > 0 {
+				u.CPUPct = deltaCPU / deltaWallUsec * 100.0 / float64(numCPUs)
+			}
+			if c.CPULimitCores > 0 {
+				u.CPUPctOfLimit = deltaCPU / deltaWallUsec * 100.0 / c.CPULimitCores
+			}
+			if c.NrPeriods > p.NrPeriods && c.NrThrottled >= p.NrThrottled {
+				u.ThrottledPct = float64(c.NrThrottled-p.NrThrottled) * 100.0 / float64(c.NrPeriods-p.NrPeriods)
+			}
+			if c.ThrottledUsec >= p.ThrottledUsec {
+				u.ThrottledUsec = c.ThrottledUsec - p.ThrottledUsec
+			}
+		}
+
+		result[c.ContainerID] = u
+	}
+	return result
+}
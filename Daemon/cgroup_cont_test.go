@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCgroupFiles crea los archivos dados dentro de dir.
+func writeCgroupFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// fakeCgroupTree arma un cgroupfs con dos contenedores: "limitado" (driver
+// systemd, con límites) y "libre" (driver cgroupfs, límites "max" y sin io.stat).
+func fakeCgroupTree(t *testing.T) (root, limitedID, freeID string) {
+	t.Helper()
+	root = t.TempDir()
+	limitedID = "aaaaaaaaaaaa1111111111111111111111111111111111111111111111111111"
+	freeID = "bbbbbbbbbbbb2222222222222222222222222222222222222222222222222222"
+
+	writeCgroupFiles(t, filepath.Join(root, "system.slice", "docker-"+limitedID+".scope"), map[string]string{
+		"cpu.stat": "usage_usec 2000000\nuser_usec 1500000\nsystem_usec 500000\n" +
+			"nr_periods 100\nnr_throttled 25\nthrottled_usec 300000\n",
+		"cpu.max":        "50000 100000\n",
+		"memory.current": "104857600\n",
+		"memory.max":     "209715200\n",
+		"memory.stat":    "anon 73400320\nfile 20971520\nkernel 1048576\nsock 0\n",
+		"io.stat": "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0\n" +
+			"8:16 rbytes=1000 wbytes=0 rios=3 wios=0 dbytes=0 dios=0\n",
+		"pids.current": "7\n",
+	})
+	writeCgroupFiles(t, filepath.Join(root, "docker", freeID), map[string]string{
+		"cpu.stat":       "usage_usec 500\nuser_usec 300\nsystem_usec 200\nnr_periods 0\nnr_throttled 0\nthrottled_usec 0\n",
+		"cpu.max":        "max 100000\n",
+		"memory.current": "4096\n",
+		"memory.max":     "max\n",
+		// kernel anterior a 5.18: sin "kernel", se suman sus partes
+		"memory.stat": "anon 1024\nfile 2048\nkernel_stack 16\nslab 32\nsock 8\npagetables 4\n",
+	})
+	return root, limitedID, freeID
+}
+
+func TestReadCgroupStats(t *testing.T) {
+	root, limitedID, freeID := fakeCgroupTree(t)
+
+	cases := []struct {
+		name string
+		id   string
+		want CgroupStats
+	}{
+		{
+			name: "con límites",
+			id:   limitedID,
+			want: CgroupStats{
+				CPUUsageUsec: 2000000, CPUUserUsec: 1500000, CPUSystemUsec: 500000,
+				NrPeriods: 100, NrThrottled: 25, ThrottledUsec: 300000,
+				CPULimitCores:   0.5,
+				MemCurrentBytes: 104857600, MemMaxBytes: 209715200,
+				MemAnonBytes: 73400320, MemFileBytes: 20971520, MemKernelBytes: 1048576,
+				IOReadBytes: 5096, IOWriteBytes: 8192, IOReadOps: 4, IOWriteOps: 2,
+				PidsCurrent: 7,
+			},
+		},
+		{
+			name: "límites max y sin io.stat",
+			id:   freeID,
+			want: CgroupStats{
+				CPUUsageUsec: 500, CPUUserUsec: 300, CPUSystemUsec: 200,
+				MemCurrentBytes: 4096,
+				MemAnonBytes:    1024, MemFileBytes: 2048, MemKernelBytes: 16 + 32 + 8 + 4,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := containerCgroupDir(root, tc.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadCgroupStats(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("ReadCgroupStats =\n%+v\nse esperaba\n%+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadCgroupStatsMissingRequired(t *testing.T) {
+	dir := t.TempDir()
+	writeCgroupFiles(t, dir, map[string]string{"memory.current": "1\n"})
+	if _, err := ReadCgroupStats(dir); err == nil {
+		t.Errorf("sin cpu.stat debería dar error")
+	}
+
+	writeCgroupFiles(t, dir, map[string]string{"cpu.stat": "usage_usec 1\n"})
+	os.Remove(filepath.Join(dir, "memory.current"))
+	if _, err := ReadCgroupStats(dir); err == nil {
+		t.Errorf("sin memory.current debería dar error")
+	}
+}
+
+func TestCollectCgroupStats(t *testing.T) {
+	root, limitedID, freeID := fakeCgroupTree(t)
+	containers := []ContainerInfo{
+		{ID: limitedID, Name: "limitado"},
+		{ID: freeID, Name: "libre"},
+		{ID: "cccccccccccc3333333333333333333333333333333333333333333333333333", Name: "terminado"},
+	}
+
+	stats := CollectCgroupStats(root, containers, 5000)
+	if len(stats) != 2 {
+		t.Fatalf("CollectCgroupStats devolvió %d contenedores, se esperaban 2", len(stats))
+	}
+	for _, st := range stats {
+		if st.TsMs != 5000 {
+			t.Errorf("%s: TsMs = %d, se esperaba 5000", st.Name, st.TsMs)
+		}
+	}
+	if stats[0].ContainerID != limitedID || stats[0].Name != "limitado" {
+		t.Errorf("primer contenedor = %s (%s)", stats[0].Name, shortID(stats[0].ContainerID))
+	}
+	if stats[1].ContainerID != freeID || stats[1].Name != "libre" {
+		t.Errorf("segundo contenedor = %s (%s)", stats[1].Name, shortID(stats[1].ContainerID))
+	}
+}
+
+func TestBuildCgroupUsage(t *testing.T) {
+	prev := map[string]CgroupStats{
+		"a": {TsMs: 1000, ContainerID: "a", CPUUsageUsec: 1000000, NrPeriods: 100, NrThrottled: 10, ThrottledUsec: 1000},
+		"b": {TsMs: 1000, ContainerID: "b", CPUUsageUsec: 9000000},
+	}
+	curr := []CgroupStats{
+		// 1 s de CPU en 2 s de pared: 50% de un CPU
+		{TsMs: 3000, ContainerID: "a", CPUUsageUsec: 2000000, NrPeriods: 120, NrThrottled: 15, ThrottledUsec: 4000,
+			CPULimitCores: 0.5, MemCurrentBytes: 50, MemMaxBytes: 200},
+		// contador reiniciado: sin tasas de CPU
+		{TsMs: 3000, ContainerID: "b", CPUUsageUsec: 10},
+		// sin lectura previa
+		{TsMs: 3000, ContainerID: "c", CPUUsageUsec: 10},
+	}
+
+	got := BuildCgroupUsage(prev, curr, 2)
+	want := map[string]CgroupUsage{
+		"a": {HasDelta: true, CPUPct: 25, CPUPctOfLimit: 100, ThrottledPct: 25, ThrottledUsec: 3000, MemPctOfLimit: 25},
+		"b": {},
+		"c": {},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("BuildCgroupUsage = %v", got)
+	}
+	for id, w := range want {
+		if got[id] != w {
+			t.Errorf("%s: %+v, se esperaba %+v", id, got[id], w)
+		}
+	}
+}
+
+// Sin lectura previa las tasas de CPU y throttling quedan en NULL, no en 0.
+func TestInsertCgroupMetricsFirstSampleNull(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := CreateContainerCgroupMetricsTable(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, col := range []string{"scenario_run_id", "scenario_phase"} {
+		if err := addColumnIfMissing(db, "container_cgroup_metrics", col, "VARCHAR(128)"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prev := map[string]CgroupStats{"b": {TsMs: 1000, ContainerID: "b", CPUUsageUsec: 1000000}}
+	curr := []CgroupStats{
+		{TsMs: 3000, ContainerID: "a", Name: "nuevo", CPUUsageUsec: 500000, CPULimitCores: 1},
+		{TsMs: 3000, ContainerID: "b", Name: "viejo", CPUUsageUsec: 2000000, CPULimitCores: 1},
+	}
+	if err := InsertContainerCgroupMetricsBulk(db, curr, BuildCgroupUsage(prev, curr, 2), scenarioTag{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		id       string
+		wantNull bool
+	}{
+		{"a", true},
+		{"b", false},
+	}
+	for _, tc := range cases {
+		var cpuPct, cpuPctLimit, throttledPct sql.NullFloat64
+		var throttledUsec sql.NullInt64
+		if err := db.QueryRow(`SELECT cpu_pct, cpu_pct_of_limit, throttled_usec, throttled_pct
+			FROM container_cgroup_metrics WHERE container_id = ?`, tc.id).
+			Scan(&cpuPct, &cpuPctLimit, &throttledUsec, &throttledPct); err != nil {
+			t.Fatal(err)
+		}
+		for name, valid := range map[string]bool{
+			"cpu_pct": cpuPct.Valid, "cpu_pct_of_limit": cpuPctLimit.Valid,
+			"throttled_usec": throttledUsec.Valid, "throttled_pct": throttledPct.Valid,
+		} {
+			if valid == tc.wantNull {
+				t.Errorf("%s: %s válido = %v, se esperaba NULL = %v", tc.id, name, valid, tc.wantNull)
+			}
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 )
 
+// Valores por defecto de las clases (ver defaultClassSpecs)
 const (
 	desiredLowContainers  = 3
 	desiredHighContainers = 2
@@ -19,18 +20,22 @@ const (
 const grafanaContainerName = "grafana-sqlite"
 
 const (
-	stressPrefix  = "stress-"
 	lowPrefix     = "stress-low-"
 	highCPUPrefix = "stress-high-cpu-"
 	highRAMPrefix = "stress-high-ram-"
 )
 
 type ContainerInfo struct {
-	ID    string
-	Name  string
-	Image string
+	ID        string
+	Name      string
+	Image     string
+	CreatedAt time.Time
+	Labels    map[string]string
 }
 
+// formato de {{.CreatedAt}} en docker ps
+const dockerCreatedAtLayout = "2006-01-02 15:04:05 -0700 MST"
+
 func runCmd(timeout time.Duration, name string, args ...string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -48,125 +53,231 @@ func runCmd(timeout time.Duration, name string, args ...string) (string, error)
 	return out.String(), nil
 }
 
-func listStressContainers() (lows []ContainerInfo, highsCPU []ContainerInfo, highsRAM []ContainerInfo, err error) {
-	out, err := runCmd(5*time.Second,
-		"docker", "ps",
-		"--filter", "status=running",
-		"--filter", "name="+stressPrefix,
-		"--format", "{{.ID}} {{.Names}} {{.Image}}",
-	)
-	if err != nil {
-		return nil, nil, nil, err
-	}
+// Formato de docker ps compartido; separado por tabs porque CreatedAt y Labels llevan espacios.
+const dockerPsFormat = "{{.ID}}\t{{.Names}}\t{{.Image}}\t{{.CreatedAt}}\t{{.Labels}}"
+
+// parseDockerPs interpreta la salida de docker ps con dockerPsFormat.
+func parseDockerPs(out string) ([]ContainerInfo, error) {
+	var result []ContainerInfo
 
 	scanner := bufio.NewScanner(strings.NewReader(out))
 	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Fields(line)
+		parts := strings.Split(scanner.Text(), "\t")
 		if len(parts) < 2 {
 			continue
 		}
-		id := parts[0]
-		name := parts[1]
-		image := ""
-		if len(parts) >= 3 {
-			image = parts[2]
-		}
 
 		ci := ContainerInfo{
-			ID:    id,
-			Name:  name,
-			Image: image,
+			ID:   strings.TrimSpace(parts[0]),
+			Name: strings.TrimSpace(parts[1]),
+		}
+		if len(parts) >= 3 {
+			ci.Image = parts[2]
 		}
+		if len(parts) >= 4 {
+			ci.CreatedAt, _ = time.Parse(dockerCreatedAtLayout, parts[3])
+		}
+		if len(parts) >= 5 && parts[4] != "" {
+			ci.Labels = make(map[string]string)
+			for _, kv := range strings.Split(parts[4], ",") {
+				k, v, _ := strings.Cut(kv, "=")
+				ci.Labels[k] = v
+			}
+		}
+		result = append(result, ci)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
-		switch {
-		case strings.HasPrefix(name, lowPrefix):
-			lows = append(lows, ci)
-		case strings.HasPrefix(name, highCPUPrefix):
-			highsCPU = append(highsCPU, ci)
-		case strings.HasPrefix(name, highRAMPrefix):
-			highsRAM = append(highsRAM, ci)
-		default:
+// classContainers agrupa los contenedores en ejecución por clase activa, según
+// el prefijo de sus plantillas y en el orden de las plantillas. Omite los que
+// ya están en la escalera de detención.
+func classContainers(classes []ContainerClassSpec, running []ContainerInfo) map[string][]ContainerInfo {
+	alive := withoutStopping(running)
+	result := make(map[string][]ContainerInfo, len(classes))
+	for _, spec := range classes {
+		for _, members := range classMembers(spec, alive) {
+			result[spec.Name] = append(result[spec.Name], members...)
+		}
+	}
+	return result
+}
 
+// excessReason es el motivo registrado al detener o limitar un contenedor sobrante.
+func excessReason(spec ContainerClassSpec, c ContainerInfo) string {
+	for _, tpl := range spec.Templates {
+		if strings.HasPrefix(c.Name, tpl.NamePrefix) {
+			return fmt.Sprintf("exceso en la clase %s (%s)", spec.Name, strings.TrimSuffix(tpl.NamePrefix, "-"))
 		}
 	}
+	return "exceso en la clase " + spec.Name
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, nil, nil, err
+// listRunningContainersFull lista los contenedores en ejecución con el ID completo
+// (necesario para ubicar su cgroup y cruzarlo con docker events).
+func listRunningContainersFull() ([]ContainerInfo, error) {
+	out, err := runCmd(5*time.Second,
+		"docker", "ps",
+		"--no-trunc",
+		"--filter", "status=running",
+		"--format", dockerPsFormat,
+	)
+	if err != nil {
+		return nil, err
 	}
-	return lows, highsCPU, highsRAM, nil
+	return parseDockerPs(out)
 }
 
 func stopContainer(c ContainerInfo, reason string) {
 	fmt.Printf("  -> Deteniendo contenedor %s (%s) [motivo: %s]\n",
 		c.Name, c.ID, reason)
-	_, err := runCmd(10*time.Second, "docker", "stop", c.ID)
-	if err != nil {
-		fmt.Printf("     (error al detener %s: %v)\n", c.Name, err)
+	exitTracker.MarkStoppedByDaemon(c)
+	stopper.Begin(c, reason)
+}
+
+// withoutStopping quita los contenedores que ya están en la escalera de detención.
+func withoutStopping(list []ContainerInfo) []ContainerInfo {
+	var result []ContainerInfo
+	for _, c := range list {
+		if !stopper.IsStopping(c.ID) {
+			result = append(result, c)
+		}
 	}
+	return result
 }
 
-func enforceRules() {
-	lows, highsCPU, highsRAM, err := listStressContainers()
+func enforceRules(si *SysInfo, cont *ContInfoSnapshot, stats []CgroupStats, usage map[string]CgroupUsage) {
+	now := time.Now()
+	allowNew := policy.BeginCycle(si, now)
+	defer policy.EndCycle(now)
+
+	// Guardas: vista del kernel reciente y coherente con docker, mínimo de contenedores vivos
+	running, err := listRunningContainersFull()
 	if err != nil {
 		fmt.Printf(" Error listando contenedores: %v\n", err)
 		return
 	}
-
-	lowCount := len(lows)
-	highCount := len(highsCPU) + len(highsRAM)
+	safetyErr := checkEnforcementSafety(cont, running, now)
+	if allowNew && safetyErr != nil {
+		policy.Refuse(safetyErr)
+		allowNew = false
+	}
+	classes := activeClasses()
+	members := classContainers(classes, running)
+	policy.SetStopBudget(stopBudget(members))
 
 	fmt.Println("===========================================")
-	fmt.Println("Estado actual de contenedores stress-*")
-	fmt.Printf("  Bajo consumo (low):       %d\n", lowCount)
-	fmt.Printf("  Alto consumo CPU:         %d\n", len(highsCPU))
-	fmt.Printf("  Alto consumo RAM:         %d\n", len(highsRAM))
-	fmt.Printf("  Alto consumo TOTAL (CPU+RAM): %d\n", highCount)
+	fmt.Println("Estado actual de contenedores por clase")
+	for _, spec := range classes {
+		fmt.Printf("  %-24s %d (deseados: %d)\n", spec.Name+":", len(members[spec.Name]), spec.Desired)
+	}
 	fmt.Println("===========================================")
 
-	if highCount > desiredHighContainers {
-		toKill := highCount - desiredHighContainers
-		fmt.Printf("⚠ Hay %d contenedores de ALTO consumo extra, se eliminarán...\n", toKill)
+	statsByID := make(map[string]CgroupStats, len(stats))
+	for _, st := range stats {
+		statsByID[st.ContainerID] = st
+	}
+	applyPendingAfter(statsByID, usage)
 
-		for _, c := range highsCPU {
-			if toKill <= 0 {
-				break
-			}
-			stopContainer(c, "exceso de alto consumo CPU")
-			toKill--
+	// Reconciliar hacia abajo, en el orden de las clases configuradas. La clase
+	// de alto consumo se limita en vez de detenerse si EnforceAction lo indica.
+	for _, spec := range classes {
+		if spec.Name == classHigh && cfg.EnforceAction != enforceActionStop {
+			enforceHighByThrottling(spec, members[spec.Name], statsByID, usage, allowNew)
+			continue
 		}
-		for _, c := range highsRAM {
-			if toKill <= 0 {
-				break
-			}
-			stopContainer(c, "exceso de alto consumo RAM")
-			toKill--
+		scaleDown(spec, members[spec.Name], allowNew)
+	}
+
+	// Reconciliar hacia arriba: crear contenedores si alguna clase quedó por debajo
+	if safetyErr == nil {
+		if running, err := listRunningContainersFull(); err != nil {
+			fmt.Printf(" Error listando contenedores para escalar: %v\n", err)
+		} else {
+			scaleUp(running)
 		}
-	} else {
-		fmt.Println(" No hay exceso de contenedores de ALTO consumo.")
 	}
 
-	lows, highsCPU, highsRAM, err = listStressContainers()
-	if err != nil {
-		fmt.Printf(" Error listando contenedores tras eliminar altos: %v\n", err)
+	fmt.Println()
+}
+
+// scaleDown detiene los contenedores que sobran en la clase.
+func scaleDown(spec ContainerClassSpec, members []ContainerInfo, allowNew bool) {
+	excess := len(members) - spec.Desired
+	if excess <= 0 {
+		fmt.Printf(" No hay exceso de contenedores en la clase %s.\n", spec.Name)
+		return
+	}
+	if !allowNew {
+		fmt.Printf(" Sin acciones nuevas sobre la clase %s en este ciclo.\n", spec.Name)
 		return
 	}
-	lowCount = len(lows)
 
-	if lowCount > desiredLowContainers {
-		toKill := lowCount - desiredLowContainers
-		fmt.Printf("Hay %d contenedores de BAJO consumo extra, se eliminarán...\n", toKill)
+	fmt.Printf("⚠ Hay %d contenedores extra en la clase %s, se eliminarán...\n", excess, spec.Name)
+	for _, c := range members {
+		if excess <= 0 {
+			break
+		}
+		if !policy.AllowStop(c) {
+			continue
+		}
+		stopContainer(c, excessReason(spec, c))
+		excess--
+	}
+}
+
+// enforceHighByThrottling limita (en vez de detener) los contenedores de alto
+// consumo en exceso y libera los que ya no hace falta limitar.
+func enforceHighByThrottling(spec ContainerClassSpec, highs []ContainerInfo,
+	stats map[string]CgroupStats, usage map[string]CgroupUsage, allowNew bool) {
+	defer saveThrottledState()
 
-		for _, c := range lows {
-			if toKill <= 0 {
-				break
+	running := make(map[string]ContainerInfo, len(highs))
+	for _, c := range highs {
+		running[c.ID] = c
+	}
+
+	countUnthrottled := func() []ContainerInfo {
+		var free []ContainerInfo
+		for _, c := range highs {
+			if _, ok := throttled[c.ID]; !ok {
+				free = append(free, c)
 			}
-			stopContainer(c, "exceso de bajo consumo")
-			toKill--
 		}
-	} else {
-		fmt.Println(" No hay exceso de contenedores de BAJO consumo.")
+		return free
 	}
 
-	fmt.Println()
+	reconcileThrottled(running, len(countUnthrottled()), stats, usage)
+
+	unthrottled := countUnthrottled()
+	fmt.Printf("  Alto consumo sin limitar:  %d (limitados: %d)\n", len(unthrottled), len(throttled))
+
+	toThrottle := len(unthrottled) - spec.Desired
+	if !allowNew {
+		fmt.Println(" Sin acciones nuevas sobre ALTO consumo en este ciclo.")
+		return
+	}
+	if toThrottle <= 0 {
+		fmt.Println(" No hay exceso de contenedores de ALTO consumo sin limitar.")
+		return
+	}
+
+	fmt.Printf("⚠ Hay %d contenedores de ALTO consumo extra, se limitarán con %s...\n", toThrottle, cfg.EnforceAction)
+	for _, c := range unthrottled {
+		if toThrottle <= 0 {
+			break
+		}
+		if !policy.AllowAction(c) {
+			continue
+		}
+		if err := throttleContainer(c, excessReason(spec, c), stats[c.ID], usage[c.ID]); err != nil {
+			fmt.Println("    ", err)
+			continue
+		}
+		toThrottle--
+	}
 }
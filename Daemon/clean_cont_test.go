@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassContainers(t *testing.T) {
+	classes := append(defaultClassSpecs(), ContainerClassSpec{
+		Name:    "batch",
+		Desired: 1,
+		Templates: []ContainerTemplate{
+			{NamePrefix: "job-io-", Image: "job-io:latest"},
+			{NamePrefix: "job-cpu-", Image: "job-cpu:latest"},
+		},
+	})
+	running := []ContainerInfo{
+		{ID: "1", Name: "stress-low-a"},
+		{ID: "2", Name: "job-cpu-a"},
+		{ID: "3", Name: "stress-high-ram-a"},
+		{ID: "4", Name: "job-io-a"},
+		{ID: "5", Name: "stress-high-cpu-a"},
+		{ID: "6", Name: "grafana-sqlite"},
+		{ID: "7", Name: "job-io-b"},
+	}
+
+	got := classContainers(classes, running)
+	names := func(list []ContainerInfo) []string {
+		var out []string
+		for _, c := range list {
+			out = append(out, c.Name)
+		}
+		return out
+	}
+
+	want := map[string][]string{
+		classLow:  {"stress-low-a"},
+		classHigh: {"stress-high-cpu-a", "stress-high-ram-a"},
+		"batch":   {"job-io-a", "job-io-b", "job-cpu-a"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("clases = %v", got)
+	}
+	for class, w := range want {
+		if g := names(got[class]); !reflect.DeepEqual(g, w) {
+			t.Errorf("clase %s = %v, se esperaba %v", class, g, w)
+		}
+	}
+
+	if r := excessReason(classes[2], running[1]); r != "exceso en la clase batch (job-cpu)" {
+		t.Errorf("excessReason = %q", r)
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// collectedState guarda la última muestra de cada colector para el orquestador.
+type collectedState struct {
+	mu      sync.Mutex
+	sys     *SysInfo
+	tree    *ProcTree
+	cont    *ContInfoSnapshot
+	cgStats []CgroupStats
+	cgUsage map[string]CgroupUsage
+}
+
+var collected = &collectedState{}
+
+func (s *collectedState) setSys(si SysInfo, tree ProcTree) {
+	s.mu.Lock()
+	s.sys = &si
+	s.tree = &tree
+	s.mu.Unlock()
+}
+
+// procTree devuelve el árbol de procesos del último snapshot (nil si no hay).
+func (s *collectedState) procTree() *ProcTree {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tree
+}
+
+func (s *collectedState) setCont(snap ContInfoSnapshot) {
+	s.mu.Lock()
+	s.cont = &snap
+	s.mu.Unlock()
+}
+
+func (s *collectedState) setCgroup(stats []CgroupStats, usage map[string]CgroupUsage) {
+	s.mu.Lock()
+	s.cgStats = stats
+	s.cgUsage = usage
+	s.mu.Unlock()
+}
+
+// latest devuelve las últimas muestras (nil si el colector aún no leyó nada).
+func (s *collectedState) latest() (*SysInfo, *ContInfoSnapshot, []CgroupStats, map[string]CgroupUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sys, s.cont, s.cgStats, s.cgUsage
+}
+
+// sysinfoCollector lee /proc/sysinfo_* y encola métricas de sistema y procesos.
+type sysinfoCollector struct {
+	prev     SysInfo
+	havePrev bool
+	numCPUs  int
+	states   *stateDetector
+}
+
+func (c *sysinfoCollector) Collect(rec *cycleRecord) {
+	start := time.Now()
+	data, err := os.ReadFile(sysinfoPath)
+	rec.stage(stageRead, start)
+	if err != nil {
+		fmt.Println(" Error leyendo sysinfo:", err)
+		rec.fail()
+		submitCycle(rec, nil)
+		return
+	}
+
+	start = time.Now()
+	si, err := ParseSysinfo(sysinfoPath, data)
+	rec.stage(stageParse, start)
+	if err != nil {
+		fmt.Println(" Error leyendo sysinfo:", err)
+		rec.fail()
+		submitCycle(rec, nil)
+		return
+	}
+	PrintSysInfo(si)
+
+	// %CPU por proceso (si tenemos snapshot previo). Usa el tiempo de cada
+	// snapshot, así sigue siendo correcto aunque el intervalo cambie.
+	start = time.Now()
+	if si.SchemaVersion < 4 {
+		fillFromProcStat(&si)
+	}
+	var (
+		cpuPctProc map[int]float64
+		intervalMs int64
+		churn      *ProcessChurn
+	)
+	if c.havePrev {
+		cpuPctProc = BuildProcCpuPct(c.prev, si, c.numCPUs)
+		intervalMs = sampleIntervalMs(int64(c.prev.TsMs), int64(si.TsMs))
+		ch := BuildProcessChurn(c.prev, si)
+		churn = &ch
+	}
+	tree := BuildProcessTree(si, cpuPctProc)
+	users, comms := BuildProcessAggregates(si, cpuPctProc)
+	stateEvents := c.states.Observe(si)
+	leakFindings := leaks.ObserveProcesses(si)
+	hostAnomalies := anomalies.ObserveHost(si)
+	rec.stage(stageCalc, start)
+	c.prev = si
+	c.havePrev = true
+	collected.setSys(si, tree)
+	sampler.ObserveHost(si)
+	reportStateEvents(stateEvents)
+	reportLeaks(leakFindings)
+	reportAnomalies(hostAnomalies)
+
+	submitCycle(rec, func(db *sql.DB) error {
+		if _, err := InsertSystemMetrics(db, si, intervalMs, rec.TickTs.UnixMilli(), rec.Scenario); err != nil {
+			return err
+		}
+		if err := InsertProcessMetricsBulk(db, si, cpuPctProc, tree, rec.Scenario); err != nil {
+			return err
+		}
+		if err := InsertProcessStateSummary(db, si, rec.Scenario); err != nil {
+			return err
+		}
+		if err := InsertProcessAggregates(db, int64(si.TsMs), users, comms, cpuPctProc != nil, rec.Scenario); err != nil {
+			return err
+		}
+		if err := UpsertProcessesFromSnapshot(db, si); err != nil {
+			return err
+		}
+		if err := InsertProcessStateEvents(db, stateEvents); err != nil {
+			return err
+		}
+		if err := InsertLeakFindings(db, leakFindings); err != nil {
+			return err
+		}
+		if err := InsertAnomalyEvents(db, hostAnomalies); err != nil {
+			return err
+		}
+		if churn != nil {
+			return InsertProcessChurn(db, *churn)
+		}
+		return nil
+	})
+}
+
+// continfoCollector lee /proc/continfo_* y encola el ciclo de vida y métricas de contenedores.
+type continfoCollector struct {
+	prev     ContInfoSnapshot
+	havePrev bool
+	numCPUs  int
+}
+
+func (c *continfoCollector) Collect(rec *cycleRecord) {
+	start := time.Now()
+	data, err := os.ReadFile(continfoPath)
+	rec.stage(stageRead, start)
+	if err != nil {
+		fmt.Println("Error leyendo continfo:", err)
+		rec.fail()
+		submitCycle(rec, nil)
+		return
+	}
+
+	start = time.Now()
+	snap, err := ParseContInfo(continfoPath, data)
+	rec.stage(stageParse, start)
+	if err != nil {
+		fmt.Println("Error leyendo continfo:", err)
+		rec.fail()
+		submitCycle(rec, nil)
+		return
+	}
+
+	start = time.Now()
+	var cpuPctCont map[string]float64
+	var intervalMs int64
+	if c.havePrev {
+		cpuPctCont = BuildContainerCpuPct(c.prev, snap, c.numCPUs)
+		intervalMs = sampleIntervalMs(c.prev.TsMs, snap.TsMs)
+	}
+	rec.stage(stageCalc, start)
+	c.prev = snap
+	c.havePrev = true
+	containerCount := snapshotContainerCount(snap)
+	contAnomalies := anomalies.ObserveContainers(snap.TsMs, containerCount)
+	collected.setCont(snap)
+	sampler.ObserveContainers(containerCount)
+	reportAnomalies(contAnomalies)
+
+	submitCycle(rec, func(db *sql.DB) error {
+		if err := UpsertContainersFromSnapshot(db, snap); err != nil {
+			return err
+		}
+		totalDeletedAcc, err := GetTotalDeletedContainers(db)
+		if err != nil {
+			fmt.Println("Error GetTotalDeletedContainers:", err)
+			rec.fail()
+			totalDeletedAcc = 0
+		}
+		if _, err := InsertContainerHostMetrics(db, snap, totalDeletedAcc, intervalMs, rec.Scenario); err != nil {
+			return err
+		}
+		if err := InsertContainerMetricsBulk(db, snap, cpuPctCont, rec.Scenario); err != nil {
+			return err
+		}
+		return InsertAnomalyEvents(db, contAnomalies)
+	})
+}
+
+// cgroupCollector lee cgroup v2 de los contenedores en ejecución (incluye oom_kill).
+type cgroupCollector struct {
+	prev    map[string]CgroupStats
+	numCPUs int
+}
+
+func (c *cgroupCollector) Collect(rec *cycleRecord) {
+	start := time.Now()
+	running, err := listRunningContainersFull()
+	if err != nil {
+		rec.stage(stageRead, start)
+		fmt.Println("Error listando contenedores para cgroup:", err)
+		rec.fail()
+		submitCycle(rec, nil)
+		return
+	}
+	PollContainerCgroups(running)
+	tsMs := time.Now().UnixMilli()
+	stats := CollectCgroupStats(cgroupRoot, running, tsMs)
+	rec.stage(stageRead, start)
+
+	start = time.Now()
+	usage := BuildCgroupUsage(c.prev, stats, c.numCPUs)
+	var availableKB uint64
+	if si, _, _, _ := collected.latest(); si != nil {
+		availableKB = si.AvailableKB
+	}
+	leakFindings := leaks.ObserveContainers(stats, tsMs, availableKB)
+	rec.stage(stageCalc, start)
+	c.prev = make(map[string]CgroupStats, len(stats))
+	for _, st := range stats {
+		c.prev[st.ContainerID] = st
+	}
+	collected.setCgroup(stats, usage)
+	reportLeaks(leakFindings)
+
+	submitCycle(rec, func(db *sql.DB) error {
+		if err := InsertContainerCgroupMetricsBulk(db, stats, usage, rec.Scenario); err != nil {
+			return err
+		}
+		return InsertLeakFindings(db, leakFindings)
+	})
+}
+
+// hostCollector lee PSI, swap, carga y /proc/stat. ts_ms es el momento de la
+// lectura; tick_ts_ms es el tick del ciclo. Corre en el mismo ciclo que
+// sysinfo (ver StartCollectors), así el tick coincide con el de system_metrics
+// y las filas de ambos colectores se pueden unir.
+type hostCollector struct {
+	prev      *HostPressure
+	warnedPSI bool
+}
+
+func (c *hostCollector) Collect(rec *cycleRecord) {
+	start := time.Now()
+	hp, err := ReadHostPressure(start.UnixMilli())
+	rec.stage(stageRead, start)
+	if err != nil {
+		fmt.Println("Error leyendo métricas de host:", err)
+		rec.fail()
+		submitCycle(rec, nil)
+		return
+	}
+	if hp.CPU == nil && !c.warnedPSI {
+		fmt.Println(" /proc/pressure no disponible (kernel sin PSI): se guardan solo swap, carga y CPUs")
+		c.warnedPSI = true
+	}
+
+	start = time.Now()
+	var usage []CPUUsage
+	if c.prev != nil {
+		usage = BuildCPUUsage(c.prev.CPUs, hp.CPUs)
+	}
+	rec.stage(stageCalc, start)
+	prev := c.prev
+	c.prev = &hp
+
+	submitCycle(rec, func(db *sql.DB) error {
+		return InsertHostPressure(db, hp, prev, usage, rec.TickTs.UnixMilli(), rec.Scenario)
+	})
+}
+
+// runModules recarga los módulos del kernel que desaparecieron. Va en su propio
+// ciclo: una compilación (make -C) no debe frenar al orquestador.
+func runModules(rec *cycleRecord) {
+	start := time.Now()
+	if err := kmods.Ensure(); err != nil {
+		fmt.Println(" Error en módulos del kernel:", err)
+		rec.fail()
+	}
+	rec.stage(stageEnforce, start)
+	submitCycle(rec, nil)
+}
+
+// runOrchestrator aplica las reglas sobre la última muestra de cada colector
+// y persiste los eventos acumulados (salidas, detenciones, escenarios).
+func runOrchestrator(rec *cycleRecord) {
+	fmt.Println("\n\n========== CICLO DEL ORQUESTADOR ==========")
+	fmt.Printf("%s\n", time.Now().Format(time.RFC3339))
+
+	si, cont, cgStats, cgUsage := collected.latest()
+
+	// Avanzar detenciones en curso (SIGTERM -> SIGKILL -> verificación)
+	start := time.Now()
+	stopper.Advance(cont)
+	enforceRules(si, cont, cgStats, cgUsage)
+	transitions := alerts.Evaluate(time.Now(), cfg.AlertRules, alertInputs{
+		Sys:     si,
+		Tree:    collected.procTree(),
+		CgStats: cgStats,
+		CgUsage: cgUsage,
+	})
+	for _, t := range transitions {
+		if t.State == alertFiring || t.State == alertResolved {
+			fmt.Println(" ALERTA", t.Message)
+		}
+	}
+	rec.stage(stageEnforce, start)
+
+	// síncrono: los eventos no se descartan aunque la cola esté llena
+	if err := writer.Do(cycleWriteFunc(rec, func(db *sql.DB) error {
+		if err := InsertContainerExits(db, exitTracker.Drain()); err != nil {
+			return err
+		}
+		if err := InsertStopEvents(db); err != nil {
+			return err
+		}
+		if err := InsertAlertTransitions(db, transitions); err != nil {
+			return err
+		}
+		return InsertScenarioEvents(db)
+	})); err != nil {
+		fmt.Println("Error guardando eventos:", err)
+		return
+	}
+	// solo se notifica lo que quedó registrado en alert_events
+	dispatcher.Enqueue(transitions)
+}
+
+// StartCollectors lanza los colectores, el orquestador y el escritor. Al
+// cancelarse ctx espera a que terminen los ciclos en curso, vacía la cola del
+// escritor y cierra el canal devuelto.
+func StartCollectors(ctx context.Context) <-chan struct{} {
+	numCPUs := runtime.NumCPU()
+
+	// el escritor sigue hasta que paren los colectores, así recibe su último lote
+	writerCtx, stopWriter := context.WithCancel(context.Background())
+	go writer.Run(writerCtx)
+	go dispatcher.Run()
+	var wg sync.WaitGroup
+	start := func(name string, interval func() time.Duration, changed func() <-chan struct{}, fn func(rec *cycleRecord)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runAligned(ctx, name, interval, changed, fn)
+		}()
+	}
+
+	sysC := &sysinfoCollector{numCPUs: numCPUs, states: newStateDetector()}
+	contC := &continfoCollector{numCPUs: numCPUs}
+	cgC := &cgroupCollector{prev: make(map[string]CgroupStats), numCPUs: numCPUs}
+	hostC := &hostCollector{}
+
+	every := func(seconds int) func() time.Duration {
+		return func() time.Duration { return time.Duration(seconds) * time.Second }
+	}
+	// con muestreo adaptativo cada colector sigue su propio intervalo en el
+	// sampler, que parte del configurado y despierta al colector si cambia
+	adaptiveIntervals := map[string]int{
+		"sysinfo":  cfg.SysinfoIntervalSeconds,
+		"continfo": cfg.ContinfoIntervalSeconds,
+		"cgroup":   cfg.CgroupIntervalSeconds,
+	}
+	bases := make(map[string]time.Duration, len(adaptiveIntervals))
+	for name, seconds := range adaptiveIntervals {
+		bases[name] = time.Duration(seconds) * time.Second
+	}
+	sampler.reset(bases)
+	run := func(name string, fn func(rec *cycleRecord)) {
+		if !cfg.AdaptiveSampling {
+			start(name, every(adaptiveIntervals[name]), nil, fn)
+			return
+		}
+		start(name, sampler.Interval(name), sampler.Changed, fn)
+	}
+
+	// host va detrás de sysinfo en el mismo tick, con muestreo fijo o adaptativo
+	run("sysinfo", func(rec *cycleRecord) {
+		sysC.Collect(rec)
+		hostC.Collect(rec.sibling("host"))
+	})
+	run("continfo", contC.Collect)
+	run("cgroup", cgC.Collect)
+	start("orchestrator", every(cfg.EnforceIntervalSeconds), nil, runOrchestrator)
+	if cfg.ModuleMode == moduleModeManager {
+		start("modules", every(cfg.EnforceIntervalSeconds), nil, runModules)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		dispatcher.Close()
+		<-dispatcher.Done()
+		stopWriter()
+		<-writer.Done()
+		close(done)
+	}()
+	return done
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Archivo de configuración opcional del daemon (JSON). Si no existe se usan los valores por defecto.
+const defaultConfigPath = "daemon_config.json"
+
+// DaemonConfig agrupa los parámetros ajustables del orquestador.
+type DaemonConfig struct {
+	// Acción sobre contenedores de alto consumo en exceso:
+	// "stop" (docker stop), "cgroup" (cpu.max/memory.high), "docker-update" o "pause".
+	EnforceAction string `json:"enforce_action"`
+
+	// Límites aplicados al limitar (cgroup / docker-update)
+	ThrottleCPUCores     float64 `json:"throttle_cpu_cores"`
+	ThrottleMemoryMB     uint64  `json:"throttle_memory_mb"`
+	ReleaseBelowPctOfCap float64 `json:"release_below_pct_of_cap"` // [0, 100); 0 = no liberar por uso
+
+	// Escalera de detención: SIGTERM, gracia, SIGKILL, verificación
+	StopGraceSeconds  int `json:"stop_grace_seconds"`
+	StopVerifySeconds int `json:"stop_verify_seconds"`
+	StopMaxRetries    int `json:"stop_max_retries"`
+
+	// Política del orquestador. ActAbove*=0 desactiva la histéresis.
+	MinContainerAgeSeconds int     `json:"min_container_age_seconds"`
+	ActionCooldownSeconds  int     `json:"action_cooldown_seconds"`
+	MaxKillsPerMinute      int     `json:"max_kills_per_minute"`
+	ActAboveCPUPct         float64 `json:"act_above_cpu_pct"`
+	ActAboveRAMPct         float64 `json:"act_above_ram_pct"`
+	StopBelowCPUPct        float64 `json:"stop_below_cpu_pct"`
+	StopBelowRAMPct        float64 `json:"stop_below_ram_pct"`
+
+	// Guardas de seguridad
+	ProtectedNames         []string `json:"protected_names"`
+	ProtectedLabels        []string `json:"protected_labels"`
+	ProtectedImages        []string `json:"protected_images"`
+	MinRunningContainers   int      `json:"min_running_containers"`
+	MaxSnapshotAgeSeconds  int      `json:"max_snapshot_age_seconds"`
+	MaxViewDisagreementPct float64  `json:"max_view_disagreement_pct"`
+
+	// Estado deseado por clase y reconciliación hacia arriba
+	Classes           []ContainerClassSpec `json:"classes"`
+	ScaleUpEnabled    bool                 `json:"scale_up_enabled"`
+	MaxStartsPerCycle int                  `json:"max_starts_per_cycle"`
+
+	// Generador de carga: "native", "script" u "off"
+	WorkloadMode string           `json:"workload_mode"`
+	Workload     WorkloadScenario `json:"workload"`
+
+	// Intervalos de cada colector y del orquestador
+	SysinfoIntervalSeconds  int `json:"sysinfo_interval_seconds"`
+	ContinfoIntervalSeconds int `json:"continfo_interval_seconds"`
+	CgroupIntervalSeconds   int `json:"cgroup_interval_seconds"`
+	EnforceIntervalSeconds  int `json:"enforce_interval_seconds"`
+
+	// Muestreo adaptativo de sysinfo/continfo/cgroup (host va en el ciclo de
+	// sysinfo): cada colector parte de su intervalo, baja al mínimo con CPU/RAM
+	// sobre los umbrales o si cambian muchos contenedores, y se duplica hasta el
+	// máximo al estabilizarse
+	AdaptiveSampling         bool    `json:"adaptive_sampling"`
+	MinSampleIntervalSeconds int     `json:"min_sample_interval_seconds"`
+	MaxSampleIntervalSeconds int     `json:"max_sample_interval_seconds"`
+	FastSampleCPUPct         float64 `json:"fast_sample_cpu_pct"`
+	FastSampleRAMPct         float64 `json:"fast_sample_ram_pct"`
+	FastSampleContainerDelta int     `json:"fast_sample_container_delta"`
+	StableSamplesToSlowDown  int     `json:"stable_samples_to_slow_down"`
+
+	// Detectores de estado: snapshots seguidos en D (colgado) o Z (zombie)
+	// antes de generar un evento; 0 desactiva el detector
+	HungTaskSnapshots int `json:"hung_task_snapshots"`
+	ZombieSnapshots   int `json:"zombie_snapshots"`
+
+	// Detección de fugas: tendencia lineal del RSS sobre una ventana deslizante
+	LeakDetection         bool    `json:"leak_detection"`
+	LeakWindowSeconds     int     `json:"leak_window_seconds"`
+	LeakMinSamples        int     `json:"leak_min_samples"`
+	LeakMinGrowthKBPerMin float64 `json:"leak_min_growth_kb_per_min"`
+	LeakMinR2             float64 `json:"leak_min_r2"`
+
+	// Detección de anomalías (EWMA + z-score) sobre CPU, RAM y cantidad de
+	// contenedores: alfa del promedio, umbral de z y muestras de calentamiento.
+	// Las anomalías de una serie en la misma dirección separadas por menos de
+	// anomaly_cooldown_seconds son un mismo episodio y se registran una vez (0 = todas)
+	AnomalyDetection       bool    `json:"anomaly_detection"`
+	AnomalyAlpha           float64 `json:"anomaly_alpha"`
+	AnomalyZThreshold      float64 `json:"anomaly_z_threshold"`
+	AnomalyWarmupSamples   int     `json:"anomaly_warmup_samples"`
+	AnomalyCooldownSeconds int     `json:"anomaly_cooldown_seconds"`
+
+	// Alertas: reglas evaluadas en cada ciclo del orquestador y destinos
+	AlertRules []AlertRule    `json:"alert_rules"`
+	Notifiers  []NotifierSpec `json:"notifiers"`
+
+	// Escritor de la DB: tamaño de la cola y política si se llena
+	// ("drop-newest", "drop-oldest" o "block")
+	WriterQueueSize  int    `json:"writer_queue_size"`
+	WriterDropPolicy string `json:"writer_drop_policy"`
+
+	// Módulos del kernel: "manager", "script" u "off"
+	ModuleMode            string `json:"module_mode"`
+	KernelDir             string `json:"kernel_dir"`
+	ModuleAutoLoad        bool   `json:"module_auto_load"`
+	ModuleAutoBuild       bool   `json:"module_auto_build"`
+	ModuleMaxLoadAttempts int    `json:"module_max_load_attempts"` // cargas fallidas seguidas antes de abandonar
+
+	// Escenario YAML a ejecutar al arrancar ("" = ninguno)
+	ScenarioFile string `json:"scenario_file"`
+}
+
+var cfg = defaultConfig()
+
+func defaultConfig() DaemonConfig {
+	return DaemonConfig{
+		EnforceAction:        enforceActionStop,
+		ThrottleCPUCores:     0.25,
+		ThrottleMemoryMB:     128,
+		ReleaseBelowPctOfCap: 50,
+		StopGraceSeconds:     10,
+		StopVerifySeconds:    5,
+		StopMaxRetries:       3,
+
+		MinContainerAgeSeconds: 30,
+		ActionCooldownSeconds:  30,
+		MaxKillsPerMinute:      5,
+
+		ProtectedNames:         []string{grafanaContainerName},
+		ProtectedLabels:        []string{"so1.protected=true"},
+		ProtectedImages:        []string{"grafana/"},
+		MinRunningContainers:   1,
+		MaxSnapshotAgeSeconds:  90,
+		MaxViewDisagreementPct: 50,
+
+		Classes:           defaultClassSpecs(),
+		ScaleUpEnabled:    true,
+		MaxStartsPerCycle: 3,
+
+		WorkloadMode: workloadModeNative,
+		Workload:     defaultWorkloadScenario(),
+
+		SysinfoIntervalSeconds:   20,
+		ContinfoIntervalSeconds:  20,
+		CgroupIntervalSeconds:    20,
+		EnforceIntervalSeconds:   20,
+		AdaptiveSampling:         true,
+		MinSampleIntervalSeconds: 5,
+		MaxSampleIntervalSeconds: 60,
+		FastSampleCPUPct:         80,
+		FastSampleRAMPct:         85,
+		FastSampleContainerDelta: 3,
+		StableSamplesToSlowDown:  3,
+
+		HungTaskSnapshots: 3,
+		ZombieSnapshots:   3,
+
+		LeakDetection:         true,
+		LeakWindowSeconds:     900,
+		LeakMinSamples:        6,
+		LeakMinGrowthKBPerMin: 1024,
+		LeakMinR2:             0.8,
+
+		AnomalyDetection:       true,
+		AnomalyAlpha:           0.1,
+		AnomalyZThreshold:      3,
+		AnomalyWarmupSamples:   10,
+		AnomalyCooldownSeconds: 300,
+
+		AlertRules: []AlertRule{
+			{Name: "host_ram_alta", Scope: alertScopeHost, Metric: "ram_pct", Op: ">=", Threshold: 95,
+				ForSeconds: 60, Severity: "critical"},
+			{Name: "host_cpu_alta", Scope: alertScopeHost, Metric: "cpu_pct", Op: ">=", Threshold: 90,
+				ForSeconds: 120, Severity: "warning"},
+		},
+		Notifiers: []NotifierSpec{
+			{Name: "archivo", Type: notifierFile, Path: "alerts.jsonl"},
+		},
+
+		WriterQueueSize:  64,
+		WriterDropPolicy: writerDropOldest,
+
+		ModuleMode:            moduleModeManager,
+		KernelDir:             "../kernel",
+		ModuleAutoLoad:        true,
+		ModuleAutoBuild:       false, // compilar como root es opt-in
+		ModuleMaxLoadAttempts: 5,
+	}
+}
+
+// LoadConfig lee el archivo JSON indicado (o DAEMON_CONFIG) sobre los valores por defecto.
+func LoadConfig(path string) (DaemonConfig, error) {
+	c := defaultConfig()
+
+	if env := os.Getenv("DAEMON_CONFIG"); env != "" {
+		path = env
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("no se pudo leer config %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("error parseando config %s: %w", path, err)
+	}
+
+	if err := c.validate(); err != nil {
+		return c, fmt.Errorf("config inválida en %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c DaemonConfig) validate() error {
+	switch c.EnforceAction {
+	case enforceActionStop, enforceActionCgroup, enforceActionDockerUpdate, enforceActionPause:
+	default:
+		return fmt.Errorf("enforce_action desconocida: %q", c.EnforceAction)
+	}
+	if c.ThrottleCPUCores <= 0 {
+		return fmt.Errorf("throttle_cpu_cores debe ser > 0")
+	}
+	if c.ThrottleMemoryMB == 0 {
+		return fmt.Errorf("throttle_memory_mb debe ser > 0")
+	}
+	if c.ReleaseBelowPctOfCap < 0 || c.ReleaseBelowPctOfCap >= 100 {
+		return fmt.Errorf("release_below_pct_of_cap debe estar entre 0 y 100 (0 = no liberar por uso)")
+	}
+	if c.StopGraceSeconds < 0 || c.StopVerifySeconds < 0 {
+		return fmt.Errorf("stop_grace_seconds y stop_verify_seconds no pueden ser negativos")
+	}
+	if c.StopMaxRetries < 1 {
+		return fmt.Errorf("stop_max_retries debe ser >= 1")
+	}
+	for _, name := range []string{classLow, classHigh} {
+		found := false
+		for _, spec := range c.Classes {
+			if spec.Name == name {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("falta la clase %q en classes", name)
+		}
+	}
+	for _, spec := range c.Classes {
+		if spec.Desired < 0 {
+			return fmt.Errorf("desired de la clase %q no puede ser negativo", spec.Name)
+		}
+		for _, tpl := range spec.Templates {
+			if tpl.NamePrefix == "" || tpl.Image == "" {
+				return fmt.Errorf("plantilla de la clase %q sin name_prefix o image", spec.Name)
+			}
+		}
+	}
+	switch c.WorkloadMode {
+	case workloadModeNative:
+		if err := c.Workload.validate(); err != nil {
+			return fmt.Errorf("workload: %w", err)
+		}
+	case workloadModeScript, workloadModeOff:
+	default:
+		return fmt.Errorf("workload_mode desconocido: %q", c.WorkloadMode)
+	}
+	if c.SysinfoIntervalSeconds < 1 || c.ContinfoIntervalSeconds < 1 ||
+		c.CgroupIntervalSeconds < 1 || c.EnforceIntervalSeconds < 1 {
+		return fmt.Errorf("los intervalos de colectores y orquestador deben ser >= 1s")
+	}
+	if c.AdaptiveSampling {
+		if c.MinSampleIntervalSeconds < 1 || c.MaxSampleIntervalSeconds < c.MinSampleIntervalSeconds {
+			return fmt.Errorf("se requiere 1 <= min_sample_interval_seconds <= max_sample_interval_seconds")
+		}
+		// cada colector adaptativo arranca en su intervalo y se mueve en [mín, máx]
+		for _, iv := range []struct {
+			name    string
+			seconds int
+		}{
+			{"sysinfo_interval_seconds", c.SysinfoIntervalSeconds},
+			{"continfo_interval_seconds", c.ContinfoIntervalSeconds},
+			{"cgroup_interval_seconds", c.CgroupIntervalSeconds},
+		} {
+			if iv.seconds < c.MinSampleIntervalSeconds || iv.seconds > c.MaxSampleIntervalSeconds {
+				return fmt.Errorf("%s debe estar entre el mínimo y el máximo de muestreo", iv.name)
+			}
+		}
+		if c.StableSamplesToSlowDown < 1 {
+			return fmt.Errorf("stable_samples_to_slow_down debe ser >= 1")
+		}
+	}
+	// el snapshot de continfo envejece hasta un intervalo del colector entre
+	// lecturas; con un máximo menor el orquestador se negaría a actuar siempre
+	if c.MaxSnapshotAgeSeconds > 0 {
+		slowest := c.ContinfoIntervalSeconds
+		if c.AdaptiveSampling && c.MaxSampleIntervalSeconds > slowest {
+			slowest = c.MaxSampleIntervalSeconds
+		}
+		if c.MaxSnapshotAgeSeconds <= slowest {
+			return fmt.Errorf("max_snapshot_age_seconds (%d) debe ser mayor que el intervalo más lento de continfo (%ds)",
+				c.MaxSnapshotAgeSeconds, slowest)
+		}
+	}
+	if c.HungTaskSnapshots < 0 || c.ZombieSnapshots < 0 {
+		return fmt.Errorf("hung_task_snapshots y zombie_snapshots no pueden ser negativos")
+	}
+	if c.LeakDetection {
+		if c.LeakWindowSeconds < 1 || c.LeakMinSamples < 3 {
+			return fmt.Errorf("leak_window_seconds debe ser >= 1 y leak_min_samples >= 3")
+		}
+		if c.LeakMinGrowthKBPerMin <= 0 || c.LeakMinR2 < 0 || c.LeakMinR2 > 1 {
+			return fmt.Errorf("se requiere leak_min_growth_kb_per_min > 0 y 0 <= leak_min_r2 <= 1")
+		}
+	}
+	if c.AnomalyDetection {
+		if c.AnomalyAlpha <= 0 || c.AnomalyAlpha >= 1 {
+			return fmt.Errorf("anomaly_alpha debe estar entre 0 y 1 (exclusivo)")
+		}
+		if c.AnomalyZThreshold <= 0 || c.AnomalyWarmupSamples < 1 {
+			return fmt.Errorf("se requiere anomaly_z_threshold > 0 y anomaly_warmup_samples >= 1")
+		}
+		if c.AnomalyCooldownSeconds < 0 {
+			return fmt.Errorf("anomaly_cooldown_seconds no puede ser negativo")
+		}
+	}
+	notifierNames := make(map[string]bool)
+	for _, n := range c.Notifiers {
+		if err := n.validate(); err != nil {
+			return err
+		}
+		if notifierNames[n.Name] {
+			return fmt.Errorf("notificador %q duplicado", n.Name)
+		}
+		notifierNames[n.Name] = true
+	}
+	ruleNames := make(map[string]bool)
+	for _, r := range c.AlertRules {
+		if err := r.validate(c.Notifiers); err != nil {
+			return err
+		}
+		if ruleNames[r.Name] {
+			return fmt.Errorf("regla de alerta %q duplicada", r.Name)
+		}
+		ruleNames[r.Name] = true
+	}
+	if c.WriterQueueSize < 1 {
+		return fmt.Errorf("writer_queue_size debe ser >= 1")
+	}
+	switch c.WriterDropPolicy {
+	case writerDropNewest, writerDropOldest, writerBlock:
+	default:
+		return fmt.Errorf("writer_drop_policy desconocida: %q", c.WriterDropPolicy)
+	}
+	switch c.ModuleMode {
+	case moduleModeManager:
+		if c.KernelDir == "" {
+			return fmt.Errorf("kernel_dir no puede estar vacío con module_mode=manager")
+		}
+		if c.ModuleMaxLoadAttempts < 1 {
+			return fmt.Errorf("module_max_load_attempts debe ser >= 1")
+		}
+	case moduleModeScript, moduleModeOff:
+	default:
+		return fmt.Errorf("module_mode desconocido: %q", c.ModuleMode)
+	}
+	if c.MinRunningContainers < 0 {
+		return fmt.Errorf("min_running_containers no puede ser negativo")
+	}
+	// cada dimensión de la histéresis necesita sus dos umbrales
+	if (c.ActAboveCPUPct > 0) != (c.StopBelowCPUPct > 0) {
+		return fmt.Errorf("act_above_cpu_pct y stop_below_cpu_pct deben configurarse juntos")
+	}
+	if (c.ActAboveRAMPct > 0) != (c.StopBelowRAMPct > 0) {
+		return fmt.Errorf("act_above_ram_pct y stop_below_ram_pct deben configurarse juntos")
+	}
+	if c.ActAboveCPUPct > 0 && c.StopBelowCPUPct > c.ActAboveCPUPct {
+		return fmt.Errorf("stop_below_cpu_pct no puede ser mayor que act_above_cpu_pct")
+	}
+	if c.ActAboveRAMPct > 0 && c.StopBelowRAMPct > c.ActAboveRAMPct {
+		return fmt.Errorf("stop_below_ram_pct no puede ser mayor que act_above_ram_pct")
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Resultados posibles de un chequeo de doctor
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// doctorCheck es el resultado de un chequeo con su sugerencia de solución.
+type doctorCheck struct {
+	Name   string
+	Result string
+	Detail string
+	Hint   string
+}
+
+const grafanaSQLitePlugin = "frser-sqlite-datasource"
+
+// Ruta donde el contenedor de Grafana monta la DB (ver grafana/docker-compose.yaml)
+const grafanaDBMountPath = "/db/monitoring.db"
+
+// Tablas que el daemon crea al arrancar
+var expectedTables = []string{
+	"system_metrics",
+	"host_pressure_metrics",
+	"host_cpu_metrics",
+	"process_metrics",
+	"process_state_summary",
+	"processes",
+	"process_churn",
+	"process_user_summary",
+	"process_comm_summary",
+	"process_state_events",
+	"leak_findings",
+	"anomaly_events",
+	"alerts",
+	"alert_events",
+	"container_host_metrics",
+	"containers",
+	"container_metrics",
+	"container_exits",
+	"container_cgroup_metrics",
+	"enforcement_actions",
+	"stop_events",
+	"orchestrator_state",
+	"scenario_events",
+	"collector_cycles",
+}
+
+// expectedColumns son las columnas que las migraciones agregan a tablas
+// existentes: si faltan, la DB es de una versión anterior y no se migró.
+func expectedColumns() map[string][]string {
+	cols := map[string][]string{
+		"system_metrics":         {"sample_interval_ms", "tick_ts_ms"},
+		"host_pressure_metrics":  {"tick_ts_ms"},
+		"container_host_metrics": {"sample_interval_ms"},
+		"collector_cycles":       {"actual_interval_ms"},
+		"processes":              {"ppid", "uid"},
+		"process_metrics":        {"start_time_ns", "ppid", "subtree_rss_kb", "subtree_cpu_pct"},
+	}
+	for _, table := range scenarioTaggedTables {
+		cols[table] = append(cols[table], "scenario_run_id", "scenario_phase")
+	}
+	return cols
+}
+
+// runDoctor ejecuta todos los chequeos, imprime el resultado y devuelve el
+// código de salida (1 si alguno falló).
+func runDoctor(exec Executor) int {
+	var checks []doctorCheck
+	checks = append(checks, checkConfig())
+	checks = append(checks, checkProcFile(snapshotSysinfo, sysinfoPath))
+	checks = append(checks, checkProcFile(snapshotContinfo, continfoPath))
+
+	docker := checkDocker(exec)
+	checks = append(checks, docker)
+	checks = append(checks, checkDatabase(dbPath)...)
+
+	if docker.Result == checkFail {
+		checks = append(checks, doctorCheck{Name: "grafana", Result: checkWarn,
+			Detail: "no se revisa: docker no responde"})
+	} else {
+		checks = append(checks, checkGrafana(exec, dbPath)...)
+	}
+
+	failed := 0
+	fmt.Println("=== daemon doctor ===")
+	for _, c := range checks {
+		fmt.Printf("[%s] %-22s %s\n", c.Result, c.Name, c.Detail)
+		if c.Result != checkPass && c.Hint != "" {
+			fmt.Printf("       -> %s\n", c.Hint)
+		}
+		if c.Result == checkFail {
+			failed++
+		}
+	}
+	fmt.Println()
+	if failed > 0 {
+		fmt.Printf("%d chequeo(s) fallaron.\n", failed)
+		return 1
+	}
+	fmt.Println("Todo en orden.")
+	return 0
+}
+
+func checkConfig() doctorCheck {
+	c := doctorCheck{Name: "config"}
+	loaded, err := LoadConfig(defaultConfigPath)
+	if err != nil {
+		c.Result = checkFail
+		c.Detail = err.Error()
+		c.Hint = "corregir daemon_config.json (o el archivo de DAEMON_CONFIG)"
+		return c
+	}
+	cfg = loaded
+	c.Result = checkPass
+	c.Detail = "configuración válida"
+	return c
+}
+
+func checkProcFile(kind, path string) doctorCheck {
+	c := doctorCheck{Name: "proc " + kind}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.Result = checkFail
+		c.Detail = fmt.Sprintf("no se pudo leer %s: %v", path, err)
+		c.Hint = "cargar los módulos: module_mode=manager o make && insmod en ../kernel"
+		return c
+	}
+	if err := validateSnapshot(kind, data); err != nil {
+		c.Result = checkFail
+		c.Detail = err.Error()
+		c.Hint = "recompilar y recargar el módulo (rmmod, make, insmod) para que coincida con el daemon"
+		return c
+	}
+	c.Result = checkPass
+	c.Detail = fmt.Sprintf("%s presente, JSON válido", path)
+	return c
+}
+
+func checkDocker(exec Executor) doctorCheck {
+	c := doctorCheck{Name: "docker"}
+	out, err := exec.Run(10*time.Second, "docker", "info", "--format", "{{.ServerVersion}}")
+	if err != nil {
+		c.Result = checkFail
+		c.Detail = fmt.Sprintf("docker no responde: %v", err)
+		c.Hint = "iniciar el servicio (systemctl start docker) y revisar permisos sobre /var/run/docker.sock"
+		return c
+	}
+	c.Result = checkPass
+	c.Detail = "servidor " + strings.TrimSpace(out)
+	return c
+}
+
+// checkDatabase revisa que la DB se pueda escribir y tenga las tablas del daemon.
+func checkDatabase(path string) []doctorCheck {
+	writable := doctorCheck{Name: "db escritura"}
+	schema := doctorCheck{Name: "db esquema"}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		writable.Result = checkWarn
+		writable.Detail = fmt.Sprintf("%s no existe todavía", path)
+		writable.Hint = "el daemon la crea al arrancar"
+		schema.Result = checkWarn
+		schema.Detail = "sin DB"
+		return []doctorCheck{writable, schema}
+	}
+
+	db, err := OpenDB(path)
+	if err != nil {
+		writable.Result = checkFail
+		writable.Detail = err.Error()
+		writable.Hint = "revisar permisos del archivo y del directorio"
+		return []doctorCheck{writable}
+	}
+	defer db.Close()
+
+	if err := probeWrite(db); err != nil {
+		writable.Result = checkFail
+		writable.Detail = fmt.Sprintf("%s no se puede escribir: %v", path, err)
+		writable.Hint = "revisar permisos (el daemon corre como root) o si otro proceso tiene la DB bloqueada"
+	} else {
+		writable.Result = checkPass
+		writable.Detail = path + " escribible"
+	}
+
+	missing, err := missingTables(db)
+	var missingCols []string
+	if err == nil {
+		missingCols, err = missingColumns(db, missing)
+	}
+	switch {
+	case err != nil:
+		schema.Result = checkFail
+		schema.Detail = err.Error()
+	case len(missing) > 0 || len(missingCols) > 0:
+		var parts []string
+		if len(missing) > 0 {
+			parts = append(parts, "faltan tablas: "+strings.Join(missing, ", "))
+		}
+		if len(missingCols) > 0 {
+			parts = append(parts, "faltan columnas: "+strings.Join(missingCols, ", "))
+		}
+		schema.Result = checkWarn
+		schema.Detail = strings.Join(parts, "; ")
+		schema.Hint = "arrancar el daemon una vez para crear/migrar las tablas"
+	default:
+		schema.Result = checkPass
+		schema.Detail = fmt.Sprintf("%d tablas del daemon presentes y migradas", len(expectedTables))
+	}
+	return []doctorCheck{writable, schema}
+}
+
+// probeWrite intenta una escritura dentro de una transacción que se revierte.
+func probeWrite(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`CREATE TABLE doctor_probe (x INT);`); err != nil {
+		return err
+	}
+	return nil
+}
+
+func missingTables(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table';`)
+	if err != nil {
+		return nil, fmt.Errorf("error listando tablas: %w", err)
+	}
+	defer rows.Close()
+
+	present := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error listando tablas: %w", err)
+		}
+		present[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listando tablas: %w", err)
+	}
+
+	var missing []string
+	for _, t := range expectedTables {
+		if !present[t] {
+			missing = append(missing, t)
+		}
+	}
+	return missing, nil
+}
+
+// missingColumns devuelve "tabla.columna" por cada columna migrada que falta,
+// salteando las tablas que ya se informaron como ausentes.
+func missingColumns(db *sql.DB, missingTables []string) ([]string, error) {
+	absent := make(map[string]bool, len(missingTables))
+	for _, t := range missingTables {
+		absent[t] = true
+	}
+
+	expected := expectedColumns()
+	var missing []string
+	for _, table := range expectedTables {
+		if absent[table] || len(expected[table]) == 0 {
+			continue
+		}
+		present, err := tableColumns(db, table)
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range expected[table] {
+			if !present[col] {
+				missing = append(missing, table+"."+col)
+			}
+		}
+	}
+	return missing, nil
+}
+
+type dockerMount struct {
+	Source      string `json:"Source"`
+	Destination string `json:"Destination"`
+}
+
+// checkGrafana revisa que grafana-sqlite corra, monte esta DB y tenga el plugin SQLite.
+func checkGrafana(exec Executor, path string) []doctorCheck {
+	running := doctorCheck{Name: "grafana"}
+	mount := doctorCheck{Name: "grafana montaje db"}
+	plugin := doctorCheck{Name: "grafana plugin"}
+
+	out, err := exec.Run(10*time.Second, "docker", "inspect", "--format", "{{.State.Running}}", grafanaContainerName)
+	if err != nil || strings.TrimSpace(out) != "true" {
+		running.Result = checkFail
+		running.Detail = grafanaContainerName + " no está corriendo"
+		running.Hint = "docker compose up -d en el directorio grafana/"
+		return []doctorCheck{running}
+	}
+	running.Result = checkPass
+	running.Detail = grafanaContainerName + " corriendo"
+
+	absDB, _ := filepath.Abs(path)
+	out, err = exec.Run(10*time.Second, "docker", "inspect", "--format", "{{json .Mounts}}", grafanaContainerName)
+	var mounts []dockerMount
+	if err == nil {
+		err = json.Unmarshal([]byte(out), &mounts)
+	}
+	switch {
+	case err != nil:
+		mount.Result = checkWarn
+		mount.Detail = fmt.Sprintf("no se pudieron leer los montajes: %v", err)
+	default:
+		mount.Result = checkFail
+		mount.Detail = fmt.Sprintf("%s no monta %s", grafanaContainerName, absDB)
+		mount.Hint = "ajustar el volumen de monitoring.db en grafana/docker-compose.yaml a la ruta real de la DB"
+		for _, m := range mounts {
+			if m.Source == absDB || m.Source == filepath.Dir(absDB) {
+				mount.Result = checkPass
+				mount.Detail = fmt.Sprintf("%s -> %s", m.Source, m.Destination)
+				mount.Hint = ""
+				break
+			}
+			if m.Destination == grafanaDBMountPath {
+				mount.Detail = fmt.Sprintf("%s monta %s, pero el daemon escribe en %s", grafanaContainerName, m.Source, absDB)
+			}
+		}
+	}
+
+	out, err = exec.Run(10*time.Second, "docker", "exec", grafanaContainerName, "ls", "/var/lib/grafana/plugins")
+	switch {
+	case err != nil:
+		plugin.Result = checkWarn
+		plugin.Detail = fmt.Sprintf("no se pudo listar plugins: %v", err)
+	case strings.Contains(out, grafanaSQLitePlugin):
+		plugin.Result = checkPass
+		plugin.Detail = grafanaSQLitePlugin + " instalado"
+	default:
+		plugin.Result = checkFail
+		plugin.Detail = grafanaSQLitePlugin + " no instalado"
+		plugin.Hint = "GF_INSTALL_PLUGINS=" + grafanaSQLitePlugin + " en docker-compose.yaml y recrear el contenedor"
+	}
+
+	return []doctorCheck{running, mount, plugin}
+}
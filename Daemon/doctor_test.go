@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Una DB de una versión anterior tiene las tablas pero no las columnas que
+// agregan las migraciones; doctor debe señalarlas.
+func TestDoctorMissingColumns(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	for _, ddl := range []string{
+		`CREATE TABLE system_metrics (id INTEGER PRIMARY KEY, ts_ms BIGINT, sample_interval_ms BIGINT);`,
+		`CREATE TABLE processes (pid INT, comm TEXT, ppid INT, uid INT);`,
+		`CREATE TABLE process_metrics (pid INT, ts_ms BIGINT, ppid INT, subtree_rss_kb BIGINT,
+		     subtree_cpu_pct REAL, scenario_run_id TEXT, scenario_phase TEXT);`,
+	} {
+		if _, err := db.Exec(ddl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	missing, err := missingTables(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := missingColumns(db, missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"system_metrics.tick_ts_ms",
+		"system_metrics.scenario_run_id",
+		"system_metrics.scenario_phase",
+		"process_metrics.start_time_ns",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("columnas faltantes = %v, se esperaba %v", got, want)
+	}
+}
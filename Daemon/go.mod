@@ -3,3 +3,5 @@ module Daemon
 go 1.25.5
 
 require github.com/mattn/go-sqlite3 v1.14.32
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// protectedReason indica por qué un contenedor no se puede tocar ("" si no está protegido).
+// Se protege por nombre exacto, por etiqueta ("clave" o "clave=valor") y por prefijo de imagen.
+func protectedReason(c ContainerInfo) string {
+	for _, name := range cfg.ProtectedNames {
+		if c.Name == name {
+			return "nombre protegido " + name
+		}
+	}
+
+	for _, label := range cfg.ProtectedLabels {
+		key, want, hasValue := strings.Cut(label, "=")
+		got, ok := c.Labels[key]
+		if ok && (!hasValue || got == want) {
+			return "etiqueta protegida " + label
+		}
+	}
+
+	for _, image := range cfg.ProtectedImages {
+		if strings.HasPrefix(c.Image, image) {
+			return "imagen protegida " + image
+		}
+	}
+	return ""
+}
+
+// checkEnforcementSafety decide si el orquestador puede actuar con la vista
+// actual: el snapshot del kernel debe ser reciente y coincidir razonablemente
+// con lo que dice docker. Devuelve el motivo para no actuar, o nil.
+func checkEnforcementSafety(snap *ContInfoSnapshot, running []ContainerInfo, now time.Time) error {
+	if snap == nil {
+		return fmt.Errorf("no hay snapshot de continfo en este ciclo")
+	}
+
+	maxAge := time.Duration(cfg.MaxSnapshotAgeSeconds) * time.Second
+	age := now.Sub(time.UnixMilli(snap.TsMs))
+	if maxAge > 0 && age > maxAge {
+		return fmt.Errorf("snapshot de continfo desactualizado (%s, máximo %s)", age.Round(time.Second), maxAge)
+	}
+
+	if len(running) == 0 || cfg.MaxViewDisagreementPct <= 0 {
+		return nil
+	}
+
+	missing := 0
+	for _, c := range running {
+		if !containerInSnapshot(*snap, c.ID) {
+			missing++
+		}
+	}
+	pct := float64(missing) * 100.0 / float64(len(running))
+	if pct > cfg.MaxViewDisagreementPct {
+		return fmt.Errorf("docker y el kernel no coinciden: %d de %d contenedores no aparecen en continfo (%.0f%%)",
+			missing, len(running), pct)
+	}
+	return nil
+}
+
+// stopBudget cuántos contenedores se pueden detener sin bajar de
+// MinRunningContainers. Solo cuentan los que el orquestador puede tocar: los
+// de alguna clase, sin protección y que no se están deteniendo (grafana no
+// sostiene el mínimo).
+func stopBudget(members map[string][]ContainerInfo) int {
+	alive := 0
+	for _, list := range members {
+		for _, c := range list {
+			if protectedReason(c) == "" && !stopper.IsStopping(c.ID) {
+				alive++
+			}
+		}
+	}
+	budget := alive - cfg.MinRunningContainers
+	if budget < 0 {
+		return 0
+	}
+	return budget
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxSnapshotAgeValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		adaptive bool
+		maxAge   int
+		wantErr  bool
+	}{
+		{name: "por defecto", adaptive: true, maxAge: 90},
+		{name: "igual al máximo adaptativo", adaptive: true, maxAge: 60, wantErr: true},
+		{name: "sin adaptativo basta superar continfo", adaptive: false, maxAge: 30},
+		{name: "menor que continfo", adaptive: false, maxAge: 5, wantErr: true},
+		{name: "desactivado", adaptive: true, maxAge: 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := defaultConfig()
+			c.AdaptiveSampling = tc.adaptive
+			c.MaxSampleIntervalSeconds = 60
+			c.ContinfoIntervalSeconds = 10
+			c.MaxSnapshotAgeSeconds = tc.maxAge
+			if err := c.validate(); (err != nil) != tc.wantErr {
+				t.Errorf("validate() = %v, se esperaba error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckEnforcementSafety(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.MaxSnapshotAgeSeconds = 90
+	cfg.MaxViewDisagreementPct = 50
+
+	now := time.UnixMilli(1_000_000)
+	shim := func(id string) ContProcess {
+		return ContProcess{CmdlineOrContID: "containerd-shim -namespace moby -id " + id}
+	}
+	running := []ContainerInfo{{ID: "aaaa"}, {ID: "bbbb"}, {ID: "cccc"}}
+
+	cases := []struct {
+		name    string
+		snap    *ContInfoSnapshot
+		wantErr bool
+	}{
+		{name: "sin snapshot", snap: nil, wantErr: true},
+		{name: "snapshot de un intervalo adaptativo lento",
+			snap: &ContInfoSnapshot{TsMs: now.Add(-60 * time.Second).UnixMilli(),
+				Procesos: []ContProcess{shim("aaaa"), shim("bbbb"), shim("cccc")}}},
+		{name: "snapshot desactualizado",
+			snap:    &ContInfoSnapshot{TsMs: now.Add(-91 * time.Second).UnixMilli()},
+			wantErr: true},
+		{name: "uno de tres falta en el kernel",
+			snap: &ContInfoSnapshot{TsMs: now.UnixMilli(), Procesos: []ContProcess{shim("aaaa"), shim("bbbb")}}},
+		{name: "dos de tres faltan en el kernel",
+			snap:    &ContInfoSnapshot{TsMs: now.UnixMilli(), Procesos: []ContProcess{shim("aaaa")}},
+			wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := checkEnforcementSafety(tc.snap, running, now); (err != nil) != tc.wantErr {
+				t.Errorf("checkEnforcementSafety() = %v, se esperaba error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// Los contenedores protegidos o fuera de las clases no cuentan para el mínimo.
+func TestStopBudget(t *testing.T) {
+	saved, savedStopper := cfg, stopper
+	t.Cleanup(func() { cfg, stopper = saved, savedStopper })
+	cfg.ProtectedNames = []string{"grafana-sqlite"}
+	stopper = newStopLadder(&fakeDocker{running: map[string]bool{}})
+	stopper.inFlight["deteniendo"] = &stopState{Info: ContainerInfo{ID: "deteniendo"}}
+
+	low := []ContainerInfo{{ID: "l1", Name: "stress-low-a"}, {ID: "l2", Name: "stress-low-b"}}
+	cases := []struct {
+		name    string
+		min     int
+		members map[string][]ContainerInfo
+		want    int
+	}{
+		{name: "solo grafana", min: 1,
+			members: map[string][]ContainerInfo{"otros": {{ID: "g", Name: "grafana-sqlite"}}}, want: 0},
+		{name: "dos de clase", min: 1, members: map[string][]ContainerInfo{classLow: low}, want: 1},
+		{name: "grafana no suma", min: 2,
+			members: map[string][]ContainerInfo{classLow: low, "otros": {{ID: "g", Name: "grafana-sqlite"}}}, want: 0},
+		{name: "el que se detiene no suma", min: 1,
+			members: map[string][]ContainerInfo{classLow: append(low, ContainerInfo{ID: "deteniendo"})}, want: 1},
+		{name: "sin mínimo", min: 0, members: map[string][]ContainerInfo{classLow: low}, want: 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.MinRunningContainers = tc.min
+			if got := stopBudget(tc.members); got != tc.want {
+				t.Errorf("stopBudget = %d, se esperaba %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProtectedReason(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.ProtectedNames = []string{"grafana-sqlite"}
+	cfg.ProtectedLabels = []string{"so1.protected=true", "so1.keep"}
+	cfg.ProtectedImages = []string{"grafana/"}
+
+	cases := []struct {
+		name string
+		c    ContainerInfo
+		want string
+	}{
+		{name: "nombre exacto", c: ContainerInfo{Name: "grafana-sqlite"}, want: "nombre protegido grafana-sqlite"},
+		{name: "nombre parecido", c: ContainerInfo{Name: "grafana-sqlite-2"}},
+		{name: "etiqueta con valor", c: ContainerInfo{Labels: map[string]string{"so1.protected": "true"}},
+			want: "etiqueta protegida so1.protected=true"},
+		{name: "etiqueta con otro valor", c: ContainerInfo{Labels: map[string]string{"so1.protected": "false"}}},
+		{name: "etiqueta sin valor", c: ContainerInfo{Labels: map[string]string{"so1.keep": ""}},
+			want: "etiqueta protegida so1.keep"},
+		{name: "prefijo de imagen", c: ContainerInfo{Image: "grafana/grafana:10"}, want: "imagen protegida grafana/"},
+		{name: "contenedor de estrés", c: ContainerInfo{Name: "stress-low-a", Image: "stress-low:so1"}},
+	}
+	for _, tc := range cases {
+		if got := protectedReason(tc.c); got != tc.want {
+			t.Errorf("%s: protectedReason = %q, se esperaba %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PSILine es una línea de /proc/pressure/* ("some" o "full"): porcentaje de
+// tiempo con tareas demoradas por el recurso en 10/60/300 s y total en µs.
+type PSILine struct {
+	Avg10   float64
+	Avg60   float64
+	Avg300  float64
+	TotalUs uint64
+}
+
+// PSIResource es la presión de un recurso; Full es nil si el kernel no la
+// reporta (cpu "full" existe desde 5.13).
+type PSIResource struct {
+	Some PSILine
+	Full *PSILine
+}
+
+// CPUTimes son los contadores de una línea cpu/cpuN de /proc/stat (ticks).
+type CPUTimes struct {
+	Name    string
+	User    uint64
+	Nice    uint64
+	System  uint64
+	Idle    uint64
+	IOWait  uint64
+	IRQ     uint64
+	SoftIRQ uint64
+	Steal   uint64
+}
+
+func (t CPUTimes) total() uint64 {
+	return t.User + t.Nice + t.System + t.Idle + t.IOWait + t.IRQ + t.SoftIRQ + t.Steal
+}
+
+// CPUUsage es la utilización de un CPU entre dos lecturas de /proc/stat.
+type CPUUsage struct {
+	CPU       string
+	BusyPct   float64
+	UserPct   float64
+	SystemPct float64
+	IOWaitPct float64
+	StealPct  float64
+}
+
+// HostPressure es una muestra del colector de host: PSI, swap, carga y CPUs.
+type HostPressure struct {
+	TsMs int64
+
+	// nil si el kernel no tiene PSI (CONFIG_PSI o psi=0)
+	CPU    *PSIResource
+	Memory *PSIResource
+	IO     *PSIResource
+
+	SwapTotalKB  uint64
+	SwapFreeKB   uint64
+	SwapInPages  uint64 // pswpin acumulado
+	SwapOutPages uint64 // pswpout acumulado
+
+	Load1         float64
+	Load5         float64
+	Load15        float64
+	RunnableTasks int
+	TotalTasks    int
+
+	CPUs []CPUTimes // "cpu" (total) primero y luego cpuN
+}
+
+// ReadHostPressure lee todas las fuentes de /proc. PSI es opcional; el resto
+// es obligatorio.
+func ReadHostPressure(tsMs int64) (HostPressure, error) {
+	hp := HostPressure{TsMs: tsMs}
+
+	hp.CPU, _ = readPSI(filepath.Join(procRoot, "pressure", "cpu"))
+	hp.Memory, _ = readPSI(filepath.Join(procRoot, "pressure", "memory"))
+	hp.IO, _ = readPSI(filepath.Join(procRoot, "pressure", "io"))
+
+	data, err := os.ReadFile(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return hp, fmt.Errorf("no se pudo leer meminfo: %w", err)
+	}
+	meminfo := parseMeminfo(string(data))
+	hp.SwapTotalKB = meminfo["SwapTotal"]
+	hp.SwapFreeKB = meminfo["SwapFree"]
+
+	if vmstat, err := readCgroupKeyValues(filepath.Join(procRoot, "vmstat")); err == nil {
+		hp.SwapInPages = vmstat["pswpin"]
+		hp.SwapOutPages = vmstat["pswpout"]
+	}
+
+	data, err = os.ReadFile(filepath.Join(procRoot, "loadavg"))
+	if err != nil {
+		return hp, fmt.Errorf("no se pudo leer loadavg: %w", err)
+	}
+	if err := parseLoadavg(string(data), &hp); err != nil {
+		return hp, err
+	}
+
+	data, err = os.ReadFile(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return hp, fmt.Errorf("no se pudo leer /proc/stat: %w", err)
+	}
+	hp.CPUs = parseProcStatCPUs(string(data))
+	if len(hp.CPUs) == 0 {
+		return hp, fmt.Errorf("/proc/stat sin líneas cpu")
+	}
+	return hp, nil
+}
+
+func readPSI(path string) (*PSIResource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePSI(string(data))
+}
+
+// parsePSI interpreta "some avg10=0.00 avg60=0.00 avg300=0.00 total=0" (+ "full ...").
+func parsePSI(data string) (*PSIResource, error) {
+	var res PSIResource
+	haveSome := false
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		var pl PSILine
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "avg10":
+				pl.Avg10, _ = strconv.ParseFloat(kv[1], 64)
+			case "avg60":
+				pl.Avg60, _ = strconv.ParseFloat(kv[1], 64)
+			case "avg300":
+				pl.Avg300, _ = strconv.ParseFloat(kv[1], 64)
+			case "total":
+				pl.TotalUs, _ = strconv.ParseUint(kv[1], 10, 64)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			res.Some = pl
+			haveSome = true
+		case "full":
+			full := pl
+			res.Full = &full
+		}
+	}
+	if !haveSome {
+		return nil, fmt.Errorf("PSI sin línea some")
+	}
+	return &res, nil
+}
+
+// parseMeminfo devuelve los campos de /proc/meminfo en kB ("SwapTotal: 123 kB").
+func parseMeminfo(data string) map[string]uint64 {
+	result := make(map[string]uint64)
+	for _, line := range strings.Split(data, "\n") {
+		key, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			result[key] = v
+		}
+	}
+	return result
+}
+
+// parseLoadavg interpreta "0.60 0.27 0.14 2/71 12026".
+func parseLoadavg(data string, hp *HostPressure) error {
+	fields := strings.Fields(data)
+	if len(fields) < 4 {
+		return fmt.Errorf("formato inválido en loadavg: %q", data)
+	}
+	var err error
+	if hp.Load1, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return fmt.Errorf("loadavg inválido: %w", err)
+	}
+	if hp.Load5, err = strconv.ParseFloat(fields[1], 64); err != nil {
+		return fmt.Errorf("loadavg inválido: %w", err)
+	}
+	if hp.Load15, err = strconv.ParseFloat(fields[2], 64); err != nil {
+		return fmt.Errorf("loadavg inválido: %w", err)
+	}
+	if running, total, ok := strings.Cut(fields[3], "/"); ok {
+		hp.RunnableTasks, _ = strconv.Atoi(running)
+		hp.TotalTasks, _ = strconv.Atoi(total)
+	}
+	return nil
+}
+
+// parseProcStatCPUs devuelve las líneas "cpu" y "cpuN" de /proc/stat.
+func parseProcStatCPUs(data string) []CPUTimes {
+	var out []CPUTimes
+	for _, line := range strings.Split(data, "\n") {
+		if !strings.HasPrefix(line, "cpu") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 9 {
+			continue
+		}
+		vals := make([]uint64, 8)
+		for i := range vals {
+			vals[i], _ = strconv.ParseUint(fields[i+1], 10, 64)
+		}
+		out = append(out, CPUTimes{
+			Name:    fields[0],
+			User:    vals[0],
+			Nice:    vals[1],
+			System:  vals[2],
+			Idle:    vals[3],
+			IOWait:  vals[4],
+			IRQ:     vals[5],
+			SoftIRQ: vals[6],
+			Steal:   vals[7],
+		})
+	}
+	return out
+}
+
+// BuildCPUUsage calcula la utilización de cada CPU entre dos lecturas. Un CPU
+// sin lectura previa (hotplug) o con contadores reiniciados se omite.
+func BuildCPUUsage(prev, curr []CPUTimes) []CPUUsage {
+	prevByName := make(map[string]CPUTimes, len(prev))
+	for _, p := range prev {
+		prevByName[p.Name] = p
+	}
+
+	var out []CPUUsage
+	for _, c := range curr {
+		p, ok := prevByName[c.Name]
+		if !ok || c.total() <= p.total() {
+			continue
+		}
+		total := float64(c.total() - p.total())
+		pct := func(now, before uint64) float64 {
+			if now < before {
+				return 0
+			}
+			return float64(now-before) * 100.0 / total
+		}
+		idle := pct(c.Idle+c.IOWait, p.Idle+p.IOWait)
+		out = append(out, CPUUsage{
+			CPU:       c.Name,
+			BusyPct:   100 - idle,
+			UserPct:   pct(c.User+c.Nice, p.User+p.Nice),
+			SystemPct: pct(c.System+c.IRQ+c.SoftIRQ, p.System+p.IRQ+p.SoftIRQ),
+			IOWaitPct: pct(c.IOWait, p.IOWait),
+			StealPct:  pct(c.Steal, p.Steal),
+		})
+	}
+	return out
+}
+
+// swapRate es páginas por segundo entre dos lecturas (nil sin previa).
+func swapRate(prev, curr uint64, intervalMs int64) interface{} {
+	if intervalMs <= 0 || curr < prev {
+		return nil
+	}
+	return float64(curr-prev) * 1000.0 / float64(intervalMs)
+}
+
+func CreateHostPressureTables(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS host_pressure_metrics (
+        id                   INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms                BIGINT NOT NULL,
+        tick_ts_ms           BIGINT,
+        sample_interval_ms   BIGINT,
+        psi_cpu_some_avg10   REAL,
+        psi_cpu_some_avg60   REAL,
+        psi_cpu_full_avg10   REAL,
+        psi_mem_some_avg10   REAL,
+        psi_mem_some_avg60   REAL,
+        psi_mem_full_avg10   REAL,
+        psi_mem_full_avg60   REAL,
+        psi_io_some_avg10    REAL,
+        psi_io_some_avg60    REAL,
+        psi_io_full_avg10    REAL,
+        psi_io_full_avg60    REAL,
+        swap_total_kb        BIGINT NOT NULL,
+        swap_used_kb         BIGINT NOT NULL,
+        swap_in_pages_per_s  REAL,
+        swap_out_pages_per_s REAL,
+        load1                REAL NOT NULL,
+        load5                REAL NOT NULL,
+        load15               REAL NOT NULL,
+        runnable_tasks       INT,
+        total_tasks          INT,
+        cpu_busy_pct         REAL,
+        cpu_iowait_pct       REAL,
+        cpu_steal_pct        REAL,
+        created_at           TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla host_pressure_metrics: %w", err)
+	}
+	idx1 := `CREATE INDEX IF NOT EXISTS idx_host_pressure_ts ON host_pressure_metrics(ts_ms);`
+	if _, err := db.Exec(idx1); err != nil {
+		return fmt.Errorf("error creando índice idx_host_pressure_ts: %w", err)
+	}
+
+	perCPU := `
+    CREATE TABLE IF NOT EXISTS host_cpu_metrics (
+        id          INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms       BIGINT NOT NULL,
+        cpu         VARCHAR(16) NOT NULL,
+        busy_pct    REAL NOT NULL,
+        user_pct    REAL NOT NULL,
+        system_pct  REAL NOT NULL,
+        iowait_pct  REAL NOT NULL,
+        steal_pct   REAL NOT NULL,
+        created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(perCPU); err != nil {
+		return fmt.Errorf("error creando tabla host_cpu_metrics: %w", err)
+	}
+	idx2 := `CREATE INDEX IF NOT EXISTS idx_host_cpu_ts ON host_cpu_metrics(ts_ms, cpu);`
+	if _, err := db.Exec(idx2); err != nil {
+		return fmt.Errorf("error creando índice idx_host_cpu_ts: %w", err)
+	}
+	return nil
+}
+
+// InsertHostPressure guarda la muestra; prev (puede ser nil) da las tasas de
+// swap, usage es la utilización por CPU ("cpu" = total del host) y tickTsMs el
+// tick del ciclo del colector.
+func InsertHostPressure(db *sql.DB, hp HostPressure, prev *HostPressure, usage []CPUUsage, tickTsMs int64, tag scenarioTag) error {
+	psi := func(r *PSIResource, full bool, avg60 bool) interface{} {
+		if r == nil {
+			return nil
+		}
+		line := &r.Some
+		if full {
+			if r.Full == nil {
+				return nil
+			}
+			line = r.Full
+		}
+		if avg60 {
+			return line.Avg60
+		}
+		return line.Avg10
+	}
+
+	var intervalMs int64
+	var swapIn, swapOut interface{}
+	if prev != nil {
+		intervalMs = sampleIntervalMs(prev.TsMs, hp.TsMs)
+		swapIn = swapRate(prev.SwapInPages, hp.SwapInPages, intervalMs)
+		swapOut = swapRate(prev.SwapOutPages, hp.SwapOutPages, intervalMs)
+	}
+	var busy, iowait, steal interface{}
+	for _, u := range usage {
+		if u.CPU == "cpu" {
+			busy, iowait, steal = u.BusyPct, u.IOWaitPct, u.StealPct
+		}
+	}
+	swapUsed := int64(0)
+	if hp.SwapTotalKB > hp.SwapFreeKB {
+		swapUsed = int64(hp.SwapTotalKB - hp.SwapFreeKB)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error iniciando transacción para host_pressure_metrics: %w", err)
+	}
+
+	runID, phase := tag.RunID, tag.Phase
+	if _, err := tx.Exec(`
+        INSERT INTO host_pressure_metrics (
+            ts_ms,
+            tick_ts_ms,
+            sample_interval_ms,
+            psi_cpu_some_avg10,
+            psi_cpu_some_avg60,
+            psi_cpu_full_avg10,
+            psi_mem_some_avg10,
+            psi_mem_some_avg60,
+            psi_mem_full_avg10,
+            psi_mem_full_avg60,
+            psi_io_some_avg10,
+            psi_io_some_avg60,
+            psi_io_full_avg10,
+            psi_io_full_avg60,
+            swap_total_kb,
+            swap_used_kb,
+            swap_in_pages_per_s,
+            swap_out_pages_per_s,
+            load1,
+            load5,
+            load15,
+            runnable_tasks,
+            total_tasks,
+            cpu_busy_pct,
+            cpu_iowait_pct,
+            cpu_steal_pct,
+            scenario_run_id,
+            scenario_phase
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+    `,
+		hp.TsMs,
+		nullIfZero(tickTsMs),
+		nullIfZero(intervalMs),
+		psi(hp.CPU, false, false),
+		psi(hp.CPU, false, true),
+		psi(hp.CPU, true, false),
+		psi(hp.Memory, false, false),
+		psi(hp.Memory, false, true),
+		psi(hp.Memory, true, false),
+		psi(hp.Memory, true, true),
+		psi(hp.IO, false, false),
+		psi(hp.IO, false, true),
+		psi(hp.IO, true, false),
+		psi(hp.IO, true, true),
+		int64(hp.SwapTotalKB),
+		swapUsed,
+		swapIn,
+		swapOut,
+		hp.Load1,
+		hp.Load5,
+		hp.Load15,
+		hp.RunnableTasks,
+		hp.TotalTasks,
+		busy,
+		iowait,
+		steal,
+		nullIfEmpty(runID),
+		nullIfEmpty(phase),
+	); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error insertando en host_pressure_metrics: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+        INSERT INTO host_cpu_metrics (
+            ts_ms,
+            cpu,
+            busy_pct,
+            user_pct,
+            system_pct,
+            iowait_pct,
+            steal_pct
+        ) VALUES (?, ?, ?, ?, ?, ?, ?);
+    `)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error preparando INSERT en host_cpu_metrics: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, u := range usage {
+		if u.CPU == "cpu" {
+			continue // el total va en host_pressure_metrics
+		}
+		if _, err := stmt.Exec(hp.TsMs, u.CPU, u.BusyPct, u.UserPct, u.SystemPct, u.IOWaitPct, u.StealPct); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error insertando %s en host_cpu_metrics: %w", u.CPU, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error haciendo commit en host_pressure_metrics: %w", err)
+	}
+	return nil
+}
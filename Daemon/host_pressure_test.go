@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePSI(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     string
+		wantErr  bool
+		wantSome PSILine
+		wantFull *PSILine
+	}{
+		{
+			name: "some y full",
+			data: "some avg10=1.50 avg60=0.75 avg300=0.10 total=123456\n" +
+				"full avg10=0.50 avg60=0.25 avg300=0.00 total=6543\n",
+			wantSome: PSILine{Avg10: 1.5, Avg60: 0.75, Avg300: 0.1, TotalUs: 123456},
+			wantFull: &PSILine{Avg10: 0.5, Avg60: 0.25, TotalUs: 6543},
+		},
+		{
+			name:     "cpu sin full (kernel < 5.13)",
+			data:     "some avg10=0.00 avg60=0.00 avg300=0.00 total=42\n",
+			wantSome: PSILine{TotalUs: 42},
+		},
+		{name: "vacío", data: "", wantErr: true},
+		{name: "solo full", data: "full avg10=0.00 avg60=0.00 avg300=0.00 total=0\n", wantErr: true},
+	}
+	for _, tc := range cases {
+		res, err := parsePSI(tc.data)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: se esperaba error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error inesperado: %v", tc.name, err)
+			continue
+		}
+		if res.Some != tc.wantSome {
+			t.Errorf("%s: some = %+v, se esperaba %+v", tc.name, res.Some, tc.wantSome)
+		}
+		if (res.Full == nil) != (tc.wantFull == nil) || (res.Full != nil && *res.Full != *tc.wantFull) {
+			t.Errorf("%s: full = %+v, se esperaba %+v", tc.name, res.Full, tc.wantFull)
+		}
+	}
+}
+
+func TestParseLoadavg(t *testing.T) {
+	cases := []struct {
+		data    string
+		wantErr bool
+		want    HostPressure
+	}{
+		{data: "0.60 0.27 0.14 2/71 12026\n", want: HostPressure{Load1: 0.6, Load5: 0.27, Load15: 0.14, RunnableTasks: 2, TotalTasks: 71}},
+		{data: "12.00 8.50 4.25 10/1024 1\n", want: HostPressure{Load1: 12, Load5: 8.5, Load15: 4.25, RunnableTasks: 10, TotalTasks: 1024}},
+		{data: "0.60 0.27", wantErr: true},
+		{data: "x 0.27 0.14 2/71 12026", wantErr: true},
+	}
+	for _, tc := range cases {
+		var hp HostPressure
+		err := parseLoadavg(tc.data, &hp)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: error = %v", tc.data, err)
+			continue
+		}
+		if !tc.wantErr && (hp.Load1 != tc.want.Load1 || hp.Load5 != tc.want.Load5 || hp.Load15 != tc.want.Load15 ||
+			hp.RunnableTasks != tc.want.RunnableTasks || hp.TotalTasks != tc.want.TotalTasks) {
+			t.Errorf("%q: = %+v, se esperaba %+v", tc.data, hp, tc.want)
+		}
+	}
+}
+
+func TestParseProcStatCPUs(t *testing.T) {
+	data := "cpu  100 5 50 1000 20 1 2 3 0 0\n" +
+		"cpu0 60 5 30 500 10 1 1 2 0 0\n" +
+		"cpu1 40 0 20 500 10 0 1 1 0 0\n" +
+		"cpu2 1 2 3\n" + // truncada: se ignora
+		"intr 12345 0 0\n" +
+		"ctxt 999\n"
+	cpus := parseProcStatCPUs(data)
+	if len(cpus) != 3 {
+		t.Fatalf("cpus = %+v, se esperaban 3 (total, cpu0, cpu1)", cpus)
+	}
+	want := CPUTimes{Name: "cpu", User: 100, Nice: 5, System: 50, Idle: 1000, IOWait: 20, IRQ: 1, SoftIRQ: 2, Steal: 3}
+	if cpus[0] != want {
+		t.Errorf("cpu = %+v, se esperaba %+v", cpus[0], want)
+	}
+	if cpus[1].Name != "cpu0" || cpus[2].Name != "cpu1" {
+		t.Errorf("nombres = %s, %s", cpus[1].Name, cpus[2].Name)
+	}
+}
+
+func TestBuildCPUUsage(t *testing.T) {
+	prev := []CPUTimes{{Name: "cpu0", User: 100, System: 100, Idle: 800}}
+	cases := []struct {
+		name string
+		curr []CPUTimes
+		want []CPUUsage
+	}{
+		{
+			name: "mitad ocupado",
+			curr: []CPUTimes{{Name: "cpu0", User: 150, System: 150, Idle: 900}},
+			want: []CPUUsage{{CPU: "cpu0", BusyPct: 50, UserPct: 25, SystemPct: 25}},
+		},
+		{
+			name: "cpu nuevo por hotplug",
+			curr: []CPUTimes{{Name: "cpu1", User: 10, Idle: 10}},
+		},
+		{
+			name: "contadores reiniciados",
+			curr: []CPUTimes{{Name: "cpu0", User: 1, Idle: 1}},
+		},
+	}
+	for _, tc := range cases {
+		got := BuildCPUUsage(prev, tc.curr)
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: uso = %+v, se esperaba %+v", tc.name, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: uso = %+v, se esperaba %+v", tc.name, got[i], tc.want[i])
+			}
+		}
+	}
+}
+
+// Sin /proc/pressure (kernel sin PSI) se leen igual swap, carga y CPUs.
+func TestReadHostPressureWithoutPSI(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"meminfo": "MemTotal: 1000 kB\nSwapTotal: 2048 kB\nSwapFree: 1024 kB\n",
+		"vmstat":  "pswpin 7\npswpout 9\n",
+		"loadavg": "1.00 0.50 0.25 3/100 42\n",
+		"stat":    "cpu  1 0 1 10 0 0 0 0 0 0\ncpu0 1 0 1 10 0 0 0 0 0 0\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := procRoot
+	t.Cleanup(func() { procRoot = saved })
+	procRoot = root
+
+	hp, err := ReadHostPressure(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hp.CPU != nil || hp.Memory != nil || hp.IO != nil {
+		t.Errorf("PSI inesperado sin /proc/pressure")
+	}
+	if hp.SwapTotalKB != 2048 || hp.SwapFreeKB != 1024 || hp.SwapInPages != 7 || hp.SwapOutPages != 9 {
+		t.Errorf("swap = %+v", hp)
+	}
+	if hp.Load1 != 1 || hp.RunnableTasks != 3 || len(hp.CPUs) != 2 {
+		t.Errorf("carga/CPUs = %+v", hp)
+	}
+}
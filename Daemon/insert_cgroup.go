@@ -0,0 +1,154 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func CreateContainerCgroupMetricsTable(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS container_cgroup_metrics (
+        id                INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms             BIGINT NOT NULL,
+        container_id      VARCHAR(128) NOT NULL,
+        container_name    VARCHAR(128),
+        cpu_usage_usec    BIGINT NOT NULL,
+        cpu_pct           REAL,
+        cpu_limit_cores   REAL,
+        cpu_pct_of_limit  REAL,
+        nr_throttled      BIGINT,
+        throttled_usec    BIGINT,
+        throttled_pct     REAL,
+        mem_current_kb    BIGINT NOT NULL,
+        mem_max_kb        BIGINT,
+        mem_pct_of_limit  REAL,
+        mem_anon_kb       BIGINT,
+        mem_file_kb       BIGINT,
+        mem_kernel_kb     BIGINT,
+        io_read_bytes     BIGINT,
+        io_write_bytes    BIGINT,
+        io_read_ops       BIGINT,
+        io_write_ops      BIGINT,
+        pids_current      INT,
+        created_at        TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla container_cgroup_metrics: %w", err)
+	}
+
+	idx1 := `CREATE INDEX IF NOT EXISTS idx_cgroup_ts ON container_cgroup_metrics(ts_ms);`
+	idx2 := `CREATE INDEX IF NOT EXISTS idx_cgroup_cid_ts ON container_cgroup_metrics(container_id, ts_ms);`
+
+	if _, err := db.Exec(idx1); err != nil {
+		return fmt.Errorf("error creando índice idx_cgroup_ts: %w", err)
+	}
+	if _, err := db.Exec(idx2); err != nil {
+		return fmt.Errorf("error creando índice idx_cgroup_cid_ts: %w", err)
+	}
+
+	return nil
+}
+
+// InsertContainerCgroupMetricsBulk insert de las lecturas cgroup v2 de un ciclo.
+func InsertContainerCgroupMetricsBulk(db *sql.DB, stats []CgroupStats, usage map[string]CgroupUsage, tag scenarioTag) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error iniciando transacción para container_cgroup_metrics: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+        INSERT INTO container_cgroup_metrics (
+            ts_ms,
+            container_id,
+            container_name,
+            cpu_usage_usec,
+            cpu_pct,
+            cpu_limit_cores,
+            cpu_pct_of_limit,
+            nr_throttled,
+            throttled_usec,
+            throttled_pct,
+            mem_current_kb,
+            mem_max_kb,
+            mem_pct_of_limit,
+            mem_anon_kb,
+            mem_file_kb,
+            mem_kernel_kb,
+            io_read_bytes,
+            io_write_bytes,
+            io_read_ops,
+            io_write_ops,
+            pids_current,
+            scenario_run_id,
+            scenario_phase
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+    `)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error preparando INSERT en container_cgroup_metrics: %w", err)
+	}
+	defer stmt.Close()
+
+	runID, phase := tag.RunID, tag.Phase
+	for _, st := range stats {
+		u := usage[st.ContainerID]
+
+		// tasas de CPU y throttling: NULL en la primera lectura (no hay intervalo)
+		var cpuPct, throttledUsec, throttledPct interface{}
+		if u.HasDelta {
+			cpuPct, throttledUsec, throttledPct = u.CPUPct, int64(u.ThrottledUsec), u.ThrottledPct
+		}
+
+		// límites opcionales: NULL si no hay límite configurado
+		var cpuLimit, cpuPctLimit, memMax, memPctLimit interface{}
+		if st.CPULimitCores > 0 {
+			cpuLimit = st.CPULimitCores
+			if u.HasDelta {
+				cpuPctLimit = u.CPUPctOfLimit
+			}
+		}
+		if st.MemMaxBytes > 0 {
+			memMax = int64(st.MemMaxBytes / 1024)
+			memPctLimit = u.MemPctOfLimit
+		}
+
+		if _, err := stmt.Exec(
+			st.TsMs,
+			st.ContainerID,
+			st.Name,
+			int64(st.CPUUsageUsec),
+			cpuPct,
+			cpuLimit,
+			cpuPctLimit,
+			int64(st.NrThrottled),
+			throttledUsec,
+			throttledPct,
+			int64(st.MemCurrentBytes/1024),
+			memMax,
+			memPctLimit,
+			int64(st.MemAnonBytes/1024),
+			int64(st.MemFileBytes/1024),
+			int64(st.MemKernelBytes/1024),
+			int64(st.IOReadBytes),
+			int64(st.IOWriteBytes),
+			int64(st.IOReadOps),
+			int64(st.IOWriteOps),
+			int64(st.PidsCurrent),
+			nullIfEmpty(runID),
+			nullIfEmpty(phase),
+		); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error insertando cgroup de %s en container_cgroup_metrics: %w", st.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error haciendo commit en container_cgroup_metrics: %w", err)
+	}
+	return nil
+}
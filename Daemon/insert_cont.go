@@ -31,8 +31,8 @@ func CreateContainerHostMetricsTable(db *sql.DB) error {
 	return nil
 }
 
-// insert un snapshot de métricas de host de contenedores.
-func InsertContainerHostMetrics(db *sql.DB, snap ContInfoSnapshot, totalDeletedAcc int) (int64, error) {
+// snapshotContainerCount cuenta los contenedores distintos del snapshot.
+func snapshotContainerCount(snap ContInfoSnapshot) int {
 	contIDs := make(map[string]struct{})
 	for _, p := range snap.Procesos {
 		if p.ContainerRelated != "yes" {
@@ -43,7 +43,13 @@ func InsertContainerHostMetrics(db *sql.DB, snap ContInfoSnapshot, totalDeletedA
 		}
 		contIDs[p.CmdlineOrContID] = struct{}{}
 	}
-	totalContainers := len(contIDs)
+	return len(contIDs)
+}
+
+// insert un snapshot de métricas de host de contenedores.
+// intervalMs es el tiempo real desde la muestra anterior (0 = primera muestra).
+func InsertContainerHostMetrics(db *sql.DB, snap ContInfoSnapshot, totalDeletedAcc int, intervalMs int64, tag scenarioTag) (int64, error) {
+	totalContainers := snapshotContainerCount(snap)
 
 	query := `
         INSERT INTO container_host_metrics (
@@ -52,9 +58,13 @@ func InsertContainerHostMetrics(db *sql.DB, snap ContInfoSnapshot, totalDeletedA
             free_ram_kb,
             used_ram_kb,
             total_containers,
-            total_deleted_acc
-        ) VALUES (?, ?, ?, ?, ?, ?);
+            total_deleted_acc,
+            scenario_run_id,
+            scenario_phase,
+            sample_interval_ms
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
     `
+	runID, phase := tag.RunID, tag.Phase
 	res, err := db.Exec(
 		query,
 		snap.TsMs,
@@ -63,6 +73,9 @@ func InsertContainerHostMetrics(db *sql.DB, snap ContInfoSnapshot, totalDeletedA
 		int64(snap.UsedRAMKB),
 		totalContainers,
 		totalDeletedAcc,
+		nullIfEmpty(runID),
+		nullIfEmpty(phase),
+		nullIfZero(intervalMs),
 	)
 	if err != nil {
 		return 0, fmt.Errorf("error insertando en container_host_metrics: %w", err)
@@ -252,7 +265,7 @@ func CreateContainerMetricsTable(db *sql.DB) error {
 	return nil
 }
 
-func InsertContainerMetricsBulk(db *sql.DB, snap ContInfoSnapshot, cpuPctMap map[string]float64) error {
+func InsertContainerMetricsBulk(db *sql.DB, snap ContInfoSnapshot, cpuPctMap map[string]float64, tag scenarioTag) error {
 	if len(snap.Procesos) == 0 {
 		return nil
 	}
@@ -272,8 +285,10 @@ func InsertContainerMetricsBulk(db *sql.DB, snap ContInfoSnapshot, cpuPctMap map
             container_id,
             rss_kb,
             cpu_time_ns,
-            cpu_pct
-        ) VALUES (?, ?, ?, ?, ?);
+            cpu_pct,
+            scenario_run_id,
+            scenario_phase
+        ) VALUES (?, ?, ?, ?, ?, ?, ?);
     `)
 	if err != nil {
 		tx.Rollback()
@@ -282,6 +297,7 @@ func InsertContainerMetricsBulk(db *sql.DB, snap ContInfoSnapshot, cpuPctMap map
 	defer stmt.Close()
 
 	insertCount := 0
+	runID, phase := tag.RunID, tag.Phase
 
 	for _, p := range snap.Procesos {
 
@@ -320,6 +336,8 @@ func InsertContainerMetricsBulk(db *sql.DB, snap ContInfoSnapshot, cpuPctMap map
 			int64(p.RSSKB),
 			int64(p.CPUTimeNs),
 			cpuPct,
+			nullIfEmpty(runID),
+			nullIfEmpty(phase),
 		); err != nil {
 			tx.Rollback()
 			return fmt.Errorf("error insertando métricas de contenedor %s (PID=%d): %w",
@@ -64,7 +64,8 @@ func CreateProcessMetricsTable(db *sql.DB) error {
 }
 
 // InsertSystemMetrics insert en system_metrics con datos de SysInfo.
-func InsertSystemMetrics(db *sql.DB, si SysInfo) (int64, error) {
+// intervalMs es el tiempo real desde la muestra anterior (0 = primera muestra).
+func InsertSystemMetrics(db *sql.DB, si SysInfo, intervalMs, tickTsMs int64, tag scenarioTag) (int64, error) {
 	ramUsed := int64(si.RamUsedKB)
 	if ramUsed == 0 && si.TotalRAMKB > 0 {
 		ramUsed = int64(si.TotalRAMKB - si.FreeRAMKB)
@@ -86,10 +87,15 @@ func InsertSystemMetrics(db *sql.DB, si SysInfo) (int64, error) {
             available_kb,
             ram_used_kb,
             total_procs,
-            cpu_usage_pct
-        ) VALUES (?, ?, ?, ?, ?, ?, ?);
+            cpu_usage_pct,
+            scenario_run_id,
+            scenario_phase,
+            sample_interval_ms,
+            tick_ts_ms
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
     `
 
+	runID, phase := tag.RunID, tag.Phase
 	res, err := db.Exec(
 		query,
 		int64(si.TsMs),
@@ -99,6 +105,10 @@ func InsertSystemMetrics(db *sql.DB, si SysInfo) (int64, error) {
 		ramUsed,
 		int64(si.TotalProcs),
 		cpuPct,
+		nullIfEmpty(runID),
+		nullIfEmpty(phase),
+		nullIfZero(intervalMs),
+		nullIfZero(tickTsMs),
 	)
 	if err != nil {
 		return 0, fmt.Errorf("error insertando en system_metrics: %w", err)
@@ -112,8 +122,9 @@ func InsertSystemMetrics(db *sql.DB, si SysInfo) (int64, error) {
 	return id, nil
 }
 
-// InsertProcessMetricsBulk insert de procesos de  SysInfo en process_metrics.
-func InsertProcessMetricsBulk(db *sql.DB, si SysInfo, cpuPctMap map[int]float64) error {
+// InsertProcessMetricsBulk insert de procesos de  SysInfo en process_metrics,
+// con el ppid y los totales del subárbol de cada uno.
+func InsertProcessMetricsBulk(db *sql.DB, si SysInfo, cpuPctMap map[int]float64, tree ProcTree, tag scenarioTag) error {
 	if len(si.Procesos) == 0 {
 		return nil // nada que insertar
 	}
@@ -132,8 +143,14 @@ func InsertProcessMetricsBulk(db *sql.DB, si SysInfo, cpuPctMap map[int]float64)
             rss_kb,
             utime,
             stime,
-            cpu_pct
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+            cpu_pct,
+            scenario_run_id,
+            scenario_phase,
+            start_time_ns,
+            ppid,
+            subtree_rss_kb,
+            subtree_cpu_pct
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
     `)
 	if err != nil {
 		tx.Rollback()
@@ -141,6 +158,7 @@ func InsertProcessMetricsBulk(db *sql.DB, si SysInfo, cpuPctMap map[int]float64)
 	}
 	defer stmt.Close()
 
+	runID, phase := tag.RunID, tag.Phase
 	for _, p := range si.Procesos {
 		// cpu_pct opcional por PID
 		var cpuPct interface{} = nil
@@ -149,6 +167,11 @@ func InsertProcessMetricsBulk(db *sql.DB, si SysInfo, cpuPctMap map[int]float64)
 				cpuPct = val
 			}
 		}
+		var subRss, subCPU interface{}
+		if node, ok := tree.ByPid[p.Pid]; ok {
+			subRss = int64(node.SubtreeRssKB)
+			subCPU = node.SubtreeCPUPct
+		}
 
 		if _, err := stmt.Exec(
 			int64(si.TsMs),
@@ -159,6 +182,12 @@ func InsertProcessMetricsBulk(db *sql.DB, si SysInfo, cpuPctMap map[int]float64)
 			int64(p.Utime),
 			int64(p.Stime),
 			cpuPct,
+			nullIfEmpty(runID),
+			nullIfEmpty(phase),
+			nullIfZero(int64(p.StartTimeNs)),
+			p.PPid,
+			subRss,
+			subCPU,
 		); err != nil {
 			tx.Rollback()
 			return fmt.Errorf("error insertando proceso PID=%d en process_metrics: %w", p.Pid, err)
@@ -172,40 +201,52 @@ func InsertProcessMetricsBulk(db *sql.DB, si SysInfo, cpuPctMap map[int]float64)
 	return nil
 }
 
-func BuildProcCpuPct(prev, curr SysInfo, numCPUs int, hz float64) map[int]float64 {
+// BuildProcCpuPct calcula %CPU por PID entre dos snapshots (normalizado por
+// cantidad de CPUs, 0-100). Un proceso solo se compara consigo mismo: si el PID
+// se reutilizó (otro start_time) o el contador bajó, se toma como muestra nueva.
+func BuildProcCpuPct(prev, curr SysInfo, numCPUs int) map[int]float64 {
 	result := make(map[int]float64)
 
 	if numCPUs <= 0 {
 		return result
 	}
-	if curr.TsMs <= prev.TsMs {
-		return result
-	}
-
-	deltaTimeSec := float64(curr.TsMs-prev.TsMs) / 1000.0
-	if deltaTimeSec <= 0 {
+	intervalNs, ok := snapshotIntervalNs(prev, curr)
+	if !ok {
 		return result
 	}
 
-	prevTicks := make(map[int]uint64, len(prev.Procesos))
+	prevByKey := make(map[procKey]uint64, len(prev.Procesos))
+	prevByPid := make(map[int]Process, len(prev.Procesos))
 	for _, p := range prev.Procesos {
-		prevTicks[p.Pid] = p.Utime + p.Stime
+		prevByKey[p.key()] = cpuTimeNs(prev, p)
+		prevByPid[p.Pid] = p
 	}
 
 	for _, p := range curr.Procesos {
-		currTicks := p.Utime + p.Stime
-		oldTicks, ok := prevTicks[p.Pid]
-		if !ok {
-			continue
+		var (
+			oldNs uint64
+			found bool
+		)
+		if old, ok := prevByPid[p.Pid]; ok && (old.StartTimeNs == 0 || p.StartTimeNs == 0) {
+			// sin start_time en alguno de los dos: solo se puede comparar por PID
+			oldNs, found = cpuTimeNs(prev, old), true
+		} else {
+			oldNs, found = prevByKey[p.key()]
 		}
-		if currTicks <= oldTicks {
+		if !found {
 			continue
 		}
 
-		deltaTicks := float64(currTicks - oldTicks)
-		cpuTimeSec := deltaTicks / hz
-		cpuPct := (cpuTimeSec / deltaTimeSec) * 100.0 / float64(numCPUs)
+		currNs := cpuTimeNs(curr, p)
+		if currNs < oldNs {
+			// contador reiniciado
+			continue
+		}
 
+		cpuPct := float64(currNs-oldNs) / float64(intervalNs) * 100.0 / float64(numCPUs)
+		if cpuPct > 100 {
+			cpuPct = 100
+		}
 		result[p.Pid] = cpuPct
 	}
 
@@ -233,7 +274,7 @@ func CreateProcessStateSummaryTable(db *sql.DB) error {
 }
 
 // InsertProcessStateSummary insert de resumen de estados de procesos para un snapshot.
-func InsertProcessStateSummary(db *sql.DB, si SysInfo) error {
+func InsertProcessStateSummary(db *sql.DB, si SysInfo, tag scenarioTag) error {
 	if len(si.Procesos) == 0 {
 		return nil
 	}
@@ -259,8 +300,10 @@ func InsertProcessStateSummary(db *sql.DB, si SysInfo) error {
         INSERT INTO process_state_summary (
             ts_ms,
             state,
-            count
-        ) VALUES (?, ?, ?);
+            count,
+            scenario_run_id,
+            scenario_phase
+        ) VALUES (?, ?, ?, ?, ?);
     `)
 	if err != nil {
 		tx.Rollback()
@@ -268,11 +311,14 @@ func InsertProcessStateSummary(db *sql.DB, si SysInfo) error {
 	}
 	defer stmt.Close()
 
+	runID, phase := tag.RunID, tag.Phase
 	for state, cnt := range counts {
 		if _, err := stmt.Exec(
 			int64(si.TsMs),
 			state,
 			cnt,
+			nullIfEmpty(runID),
+			nullIfEmpty(phase),
 		); err != nil {
 			tx.Rollback()
 			return fmt.Errorf("error insertando resumen state=%s en process_state_summary: %w", state, err)
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Tipos de objetivo y acciones de un hallazgo de fuga de memoria
+const (
+	leakKindProcess   = "process"
+	leakKindContainer = "container"
+
+	leakRaised  = "raised"
+	leakCleared = "cleared"
+)
+
+// LeakFinding es una fuga detectada (o su fin) con la tendencia al momento.
+type LeakFinding struct {
+	TsMs          int64   `json:"ts_ms"`
+	Action        string  `json:"action"`
+	Kind          string  `json:"kind"`
+	TargetID      string  `json:"target_id"` // pid:start_time_ns o container_id
+	Name          string  `json:"name"`
+	Pid           int     `json:"pid,omitempty"`
+	SlopeKBPerMin float64 `json:"slope_kb_per_min"`
+	R2            float64 `json:"r2"`
+	Samples       int     `json:"samples"`
+	WindowSec     int64   `json:"window_sec"`
+	FirstRssKB    uint64  `json:"first_rss_kb"`
+	LastRssKB     uint64  `json:"last_rss_kb"`
+	AvailableKB   uint64  `json:"available_kb"`
+	// segundos hasta agotar la RAM disponible del host a este ritmo (0 = sin estimación)
+	ExhaustSeconds int64 `json:"exhaust_seconds,omitempty"`
+}
+
+type rssPoint struct {
+	TsMs  int64
+	RssKB uint64
+}
+
+// leakSample es la medición de un objetivo en un snapshot.
+type leakSample struct {
+	Name  string
+	Pid   int
+	RssKB uint64
+	TsMs  int64 // 0 = el ts_ms de la observación
+}
+
+type rssSeries struct {
+	name   string
+	pid    int
+	points []rssPoint
+	active *LeakFinding // no nil mientras la fuga está levantada
+}
+
+// leakDetector ajusta una recta al RSS de cada proceso y contenedor sobre una
+// ventana deslizante y marca los crecimientos sostenidos. Lo alimentan el
+// colector de sysinfo (procesos) y el de cgroup (contenedores).
+type leakDetector struct {
+	mu     sync.Mutex
+	series map[string]map[string]*rssSeries // kind -> target -> serie
+}
+
+var leaks = &leakDetector{series: map[string]map[string]*rssSeries{
+	leakKindProcess:   {},
+	leakKindContainer: {},
+}}
+
+// ObserveProcesses alimenta el detector con un snapshot de sysinfo. Los hilos
+// de kernel (RSS 0) no se siguen.
+func (d *leakDetector) ObserveProcesses(si SysInfo) []LeakFinding {
+	samples := make(map[string]leakSample, len(si.Procesos))
+	for _, p := range si.Procesos {
+		if p.RssKB == 0 {
+			continue
+		}
+		id := strconv.Itoa(p.Pid) + ":" + strconv.FormatUint(p.StartTimeNs, 10)
+		samples[id] = leakSample{Name: p.Comm, Pid: p.Pid, RssKB: p.RssKB}
+	}
+	return d.observe(leakKindProcess, int64(si.TsMs), samples, si.AvailableKB)
+}
+
+// ObserveContainers usa la memoria anónima del cgroup de cada contenedor
+// (memory.stat anon): memory.current incluye la page cache y cualquier
+// contenedor que escriba archivos parecería una fuga. Cada muestra lleva el
+// ts_ms de su lectura; tsMs es el del ciclo (cierre de contenedores que ya no están).
+func (d *leakDetector) ObserveContainers(stats []CgroupStats, tsMs int64, availableKB uint64) []LeakFinding {
+	samples := make(map[string]leakSample, len(stats))
+	for _, st := range stats {
+		samples[st.ContainerID] = leakSample{Name: st.Name, RssKB: st.MemAnonBytes / 1024, TsMs: st.TsMs}
+	}
+	return d.observe(leakKindContainer, tsMs, samples, availableKB)
+}
+
+func (d *leakDetector) observe(kind string, tsMs int64, samples map[string]leakSample, availableKB uint64) []LeakFinding {
+	if !cfg.LeakDetection {
+		return nil
+	}
+	window := int64(cfg.LeakWindowSeconds) * 1000
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	series := d.series[kind]
+	var findings []LeakFinding
+	for id, smp := range samples {
+		s, ok := series[id]
+		if !ok {
+			s = &rssSeries{}
+			series[id] = s
+		}
+		ts := smp.TsMs
+		if ts == 0 {
+			ts = tsMs
+		}
+		s.name = smp.Name
+		s.pid = smp.Pid
+		s.points = append(s.points, rssPoint{TsMs: ts, RssKB: smp.RssKB})
+		// descartar lo que quedó fuera de la ventana
+		cut := 0
+		for cut < len(s.points) && ts-s.points[cut].TsMs > window {
+			cut++
+		}
+		s.points = s.points[cut:]
+
+		if f, changed := evaluateLeak(kind, id, s, ts, availableKB); changed {
+			findings = append(findings, f)
+		}
+	}
+
+	// objetivos que ya no existen: cerrar su fuga y olvidarlos
+	for id, s := range series {
+		if _, ok := samples[id]; ok {
+			continue
+		}
+		if s.active != nil {
+			f := *s.active
+			f.TsMs = tsMs
+			f.Action = leakCleared
+			findings = append(findings, f)
+		}
+		delete(series, id)
+	}
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].TargetID < findings[j].TargetID })
+	return findings
+}
+
+// evaluateLeak actualiza el estado de la serie. Se levanta con pendiente sobre
+// el umbral y buen ajuste (R²), y se cierra cuando la pendiente cae a menos de
+// la mitad del umbral o el ajuste deja de ser lineal. changed indica evento.
+func evaluateLeak(kind, id string, s *rssSeries, tsMs int64, availableKB uint64) (LeakFinding, bool) {
+	if len(s.points) < cfg.LeakMinSamples {
+		return LeakFinding{}, false
+	}
+	slope, r2 := linearTrend(s.points)
+	first, last := s.points[0], s.points[len(s.points)-1]
+
+	f := LeakFinding{
+		TsMs:          tsMs,
+		Kind:          kind,
+		TargetID:      id,
+		Name:          s.name,
+		Pid:           s.pid,
+		SlopeKBPerMin: slope,
+		R2:            r2,
+		Samples:       len(s.points),
+		WindowSec:     (last.TsMs - first.TsMs) / 1000,
+		FirstRssKB:    first.RssKB,
+		LastRssKB:     last.RssKB,
+		AvailableKB:   availableKB,
+	}
+	if slope > 0 && availableKB > 0 {
+		f.ExhaustSeconds = int64(float64(availableKB) / slope * 60)
+	}
+
+	growing := slope >= cfg.LeakMinGrowthKBPerMin && r2 >= cfg.LeakMinR2
+	switch {
+	case s.active == nil && growing:
+		f.Action = leakRaised
+		s.active = &f
+		return f, true
+	case s.active != nil && (slope < cfg.LeakMinGrowthKBPerMin/2 || r2 < cfg.LeakMinR2):
+		f.Action = leakCleared
+		s.active = nil
+		return f, true
+	case s.active != nil:
+		// sigue activa: refrescar la tendencia para la API
+		f.Action = leakRaised
+		s.active = &f
+	}
+	return LeakFinding{}, false
+}
+
+// linearTrend ajusta rss = a + b*t por mínimos cuadrados; devuelve b en KB/min y R².
+func linearTrend(points []rssPoint) (float64, float64) {
+	n := float64(len(points))
+	if n < 2 {
+		return 0, 0
+	}
+	t0 := points[0].TsMs
+	var sumX, sumY, sumXX, sumXY float64
+	for _, p := range points {
+		x := float64(p.TsMs-t0) / 60000.0
+		y := float64(p.RssKB)
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+	den := n*sumXX - sumX*sumX
+	if den == 0 {
+		return 0, 0
+	}
+	slope := (n*sumXY - sumX*sumY) / den
+	intercept := (sumY - slope*sumX) / n
+
+	meanY := sumY / n
+	var ssTot, ssRes float64
+	for _, p := range points {
+		x := float64(p.TsMs-t0) / 60000.0
+		y := float64(p.RssKB)
+		ssTot += (y - meanY) * (y - meanY)
+		ssRes += (y - intercept - slope*x) * (y - intercept - slope*x)
+	}
+	if ssTot == 0 {
+		// RSS constante: sin tendencia
+		return 0, 0
+	}
+	return slope, math.Max(0, 1-ssRes/ssTot)
+}
+
+// Active devuelve las fugas levantadas con su tendencia más reciente.
+func (d *leakDetector) Active() []LeakFinding {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := []LeakFinding{}
+	for _, series := range d.series {
+		for _, s := range series {
+			if s.active != nil {
+				out = append(out, *s.active)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SlopeKBPerMin > out[j].SlopeKBPerMin })
+	return out
+}
+
+// reportLeaks imprime las fugas nuevas y las que terminaron.
+func reportLeaks(findings []LeakFinding) {
+	for _, f := range findings {
+		if f.Action == leakCleared {
+			logger.Info("fuga de memoria terminada", "tipo", f.Kind, "objetivo", f.TargetID, "nombre", f.Name)
+			continue
+		}
+		args := []any{"tipo", f.Kind, "objetivo", f.TargetID, "nombre", f.Name,
+			"kb_por_min", fmt.Sprintf("%.0f", f.SlopeKBPerMin), "r2", fmt.Sprintf("%.2f", f.R2)}
+		if f.ExhaustSeconds > 0 {
+			args = append(args, "agota_ram_en", time.Duration(f.ExhaustSeconds)*time.Second)
+		}
+		logger.Warn("posible fuga de memoria", args...)
+	}
+}
+
+func CreateLeakFindingsTable(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS leak_findings (
+        id               INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms            BIGINT NOT NULL,
+        action           VARCHAR(16) NOT NULL,
+        kind             VARCHAR(16) NOT NULL,
+        target_id        VARCHAR(128) NOT NULL,
+        name             TEXT,
+        pid              INT,
+        slope_kb_per_min REAL NOT NULL,
+        r2               REAL NOT NULL,
+        samples          INT NOT NULL,
+        window_sec       BIGINT NOT NULL,
+        first_rss_kb     BIGINT,
+        last_rss_kb      BIGINT,
+        available_kb     BIGINT,
+        exhaust_seconds  BIGINT,
+        created_at       TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla leak_findings: %w", err)
+	}
+
+	idx := `CREATE INDEX IF NOT EXISTS idx_leak_findings_target ON leak_findings(kind, target_id, ts_ms);`
+	if _, err := db.Exec(idx); err != nil {
+		return fmt.Errorf("error creando índice idx_leak_findings_target: %w", err)
+	}
+
+	// Anotaciones para Grafana (datasource SQLite): una región desde que se
+	// levanta la fuga hasta que se cierra (timeEnd NULL si sigue activa)
+	view := `
+    CREATE VIEW IF NOT EXISTS leak_annotations AS
+    SELECT
+        r.ts_ms AS time,
+        (SELECT MIN(c.ts_ms) FROM leak_findings c
+          WHERE c.kind = r.kind AND c.target_id = r.target_id
+            AND c.action = 'cleared' AND c.ts_ms >= r.ts_ms) AS timeEnd,
+        printf('Fuga %s %s (%s): +%.0f KB/min, R2 %.2f', r.kind, COALESCE(r.name, ''), r.target_id,
+               r.slope_kb_per_min, r.r2)
+          || CASE WHEN r.exhaust_seconds IS NOT NULL
+                  THEN printf(', RAM agotada en ~%d min', r.exhaust_seconds / 60) ELSE '' END AS text,
+        'leak,' || r.kind AS tags
+    FROM leak_findings r
+    WHERE r.action = 'raised';
+    `
+	if _, err := db.Exec(view); err != nil {
+		return fmt.Errorf("error creando vista leak_annotations: %w", err)
+	}
+	return nil
+}
+
+func InsertLeakFindings(db *sql.DB, findings []LeakFinding) error {
+	for _, f := range findings {
+		var pid interface{}
+		if f.Kind == leakKindProcess {
+			pid = f.Pid
+		}
+		_, err := db.Exec(`
+            INSERT INTO leak_findings (
+                ts_ms,
+                action,
+                kind,
+                target_id,
+                name,
+                pid,
+                slope_kb_per_min,
+                r2,
+                samples,
+                window_sec,
+                first_rss_kb,
+                last_rss_kb,
+                available_kb,
+                exhaust_seconds
+            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+        `,
+			f.TsMs,
+			f.Action,
+			f.Kind,
+			f.TargetID,
+			nullIfEmpty(f.Name),
+			pid,
+			f.SlopeKBPerMin,
+			f.R2,
+			f.Samples,
+			f.WindowSec,
+			int64(f.FirstRssKB),
+			int64(f.LastRssKB),
+			nullIfZero(int64(f.AvailableKB)),
+			nullIfZero(f.ExhaustSeconds),
+		)
+		if err != nil {
+			return fmt.Errorf("error insertando fuga %s %s en leak_findings: %w", f.Kind, f.TargetID, err)
+		}
+	}
+	return nil
+}
+
+// QueryLeakFindings devuelve el historial de fugas (más recientes primero).
+func QueryLeakFindings(db *sql.DB, limit int) ([]LeakFinding, error) {
+	rows, err := db.Query(`
+        SELECT ts_ms, action, kind, target_id, COALESCE(name, ''), COALESCE(pid, 0),
+               slope_kb_per_min, r2, samples, window_sec, COALESCE(first_rss_kb, 0),
+               COALESCE(last_rss_kb, 0), COALESCE(available_kb, 0), COALESCE(exhaust_seconds, 0)
+        FROM leak_findings
+        ORDER BY ts_ms DESC, id DESC
+        LIMIT ?;
+    `, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando leak_findings: %w", err)
+	}
+	defer rows.Close()
+
+	var result []LeakFinding
+	for rows.Next() {
+		var f LeakFinding
+		var first, last, avail int64
+		if err := rows.Scan(&f.TsMs, &f.Action, &f.Kind, &f.TargetID, &f.Name, &f.Pid,
+			&f.SlopeKBPerMin, &f.R2, &f.Samples, &f.WindowSec, &first, &last, &avail,
+			&f.ExhaustSeconds); err != nil {
+			return nil, fmt.Errorf("error leyendo leak_findings: %w", err)
+		}
+		f.FirstRssKB = uint64(first)
+		f.LastRssKB = uint64(last)
+		f.AvailableKB = uint64(avail)
+		result = append(result, f)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+// Un contenedor que solo llena la page cache no es una fuga; uno cuya memoria
+// anónima crece de forma sostenida sí.
+func TestLeakDetectorContainersUseAnonMemory(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.LeakDetection = true
+	cfg.LeakWindowSeconds = 900
+	cfg.LeakMinSamples = 6
+	cfg.LeakMinGrowthKBPerMin = 1024
+	cfg.LeakMinR2 = 0.8
+
+	d := &leakDetector{series: map[string]map[string]*rssSeries{
+		leakKindProcess:   {},
+		leakKindContainer: {},
+	}}
+
+	var raised []LeakFinding
+	for i := int64(0); i < 10; i++ {
+		// muestras cada 30 s, con la lectura 500 ms después del tick del ciclo
+		cycleTs := i * 30000
+		readTs := cycleTs + 500
+		grow := uint64(i) * 10 * 1024 * 1024 // 20 MB/min
+		stats := []CgroupStats{
+			{TsMs: readTs, ContainerID: "cache", Name: "escribe-archivos",
+				MemCurrentBytes: 50<<20 + grow, MemAnonBytes: 40 << 20, MemFileBytes: 10<<20 + grow},
+			{TsMs: readTs, ContainerID: "leak", Name: "con-fuga",
+				MemCurrentBytes: 50<<20 + grow, MemAnonBytes: 40<<20 + grow},
+		}
+		for _, f := range d.ObserveContainers(stats, cycleTs, 8<<20) {
+			if f.Action == leakRaised {
+				raised = append(raised, f)
+			}
+		}
+	}
+
+	if len(raised) != 1 || raised[0].TargetID != "leak" {
+		t.Fatalf("fugas levantadas = %+v, se esperaba solo la de \"leak\"", raised)
+	}
+	f := raised[0]
+	if f.SlopeKBPerMin < 20*1024-1 || f.SlopeKBPerMin > 20*1024+1 {
+		t.Errorf("pendiente = %.1f KB/min, se esperaba %d", f.SlopeKBPerMin, 20*1024)
+	}
+	if f.TsMs%30000 != 500 {
+		t.Errorf("ts_ms = %d, se esperaba el de la lectura del cgroup", f.TsMs)
+	}
+}
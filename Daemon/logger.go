@@ -0,0 +1,10 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// logger estructurado (clave=valor) para salidas de procesos hijos y
+// componentes en segundo plano. La salida de consola del ciclo sigue con fmt.
+var logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
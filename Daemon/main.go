@@ -1,13 +1,13 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
-	"runtime"
 	"syscall"
 	"time"
 
@@ -15,13 +15,13 @@ import (
 )
 
 const (
-	sysinfoPath      = "/proc/sysinfo_so1_201801521"
-	continfoPath     = "/proc/continfo_so1_201801521"
-	dbPath           = "monitoring.db"
-	defaultInterval1 = 20 * time.Second
-)
+	sysinfoPath  = "/proc/sysinfo_so1_201801521"
+	continfoPath = "/proc/continfo_so1_201801521"
+	dbPath       = "monitoring.db"
 
-var stressCmd *exec.Cmd
+	// máximo que se espera a colectores y escritor al apagar
+	shutdownTimeout = 30 * time.Second
+)
 
 // helper: total contenedores eliminados (para container_host_metrics)
 func GetTotalDeletedContainers(db *sql.DB) (int, error) {
@@ -60,33 +60,27 @@ func IsGrafanaRunning() bool {
 }
 
 func main() {
-
-	// ====== MANEJO DE CTRL+C / SIGTERM ======
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		<-sigChan
-		fmt.Println("\nSeñal de parada recibida (Ctrl+C).")
-
-		if stressCmd != nil && stressCmd.Process != nil {
-			fmt.Println("Deteniendo script stress_container.sh...")
-			if err := stressCmd.Process.Kill(); err != nil {
-				fmt.Println("Error al detener stress bash:", err)
-			} else {
-				fmt.Println("Stress bash detenido.")
-			}
+	// Subcomandos: daemon doctor (autodiagnóstico), daemon ps [--tree]
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "doctor":
+			os.Exit(runDoctor(hostExecutor{}))
+		case "ps":
+			os.Exit(runPs(os.Args[2:]))
 		}
+	}
 
-		// 2. Ejecutar script detener.sh
-		fmt.Println("Ejecutando detener.sh...")
-		if err := RunDetenerScript(); err != nil {
-			fmt.Println("Error al ejecutar detener.sh:", err)
-		}
+	var err error
+	cfg, err = LoadConfig(defaultConfigPath)
+	if err != nil {
+		fmt.Println("Error cargando configuración:", err)
+		return
+	}
 
-		fmt.Println("Saliendo del daemon.")
-		os.Exit(0)
-	}()
+	// ====== MANEJO DE CTRL+C / SIGTERM ======
+	// la señal cancela ctx; el apagado ordenado se hace al final de main
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
 	//EJECUCION DE GRAFANA
 	composeDir := "/home/jemima/Documentos/proyecto-1/grafana" // ajusta si cambia la ruta
@@ -101,17 +95,38 @@ func main() {
 		fmt.Println("Grafana ya estaba corriendo.")
 	}
 
-	//EJECUCION DEL SCRIPT PARA CARGAR MODULOS DE KERNEL
-	if err := RunInstallModules(); err != nil {
-		fmt.Println(" No se pudieron instalar los módulos:", err)
-		// decide si quieres terminar aquí o seguir
-		// return
+	//MODULOS DE KERNEL
+	switch cfg.ModuleMode {
+	case moduleModeManager:
+		kmods.configure(cfg)
+		if err := kmods.Ensure(); err != nil {
+			fmt.Println(" No se pudieron cargar los módulos:", err)
+		}
+	case moduleModeScript:
+		if err := RunInstallModules(); err != nil {
+			fmt.Println(" No se pudieron instalar los módulos:", err)
+		}
 	}
-	//CRONJOB
 
-	if err := RunStressContainerScript(); err != nil {
-		fmt.Println("No se pudo ejecutar stress_container.sh:", err)
-		// decide si sigues o no
+	// Compatibilidad del formato JSON de los módulos con este daemon. En modo
+	// manager un módulo que todavía no cargó no es fatal: el manager reintenta.
+	if err := CheckSnapshotSchemas(); errors.Is(err, os.ErrNotExist) && cfg.ModuleMode == moduleModeManager {
+		fmt.Println(" Aviso: módulos del kernel aún no disponibles, se reintenta su carga:", err)
+	} else if err != nil {
+		fmt.Println(" Error: los módulos del kernel no son compatibles con este daemon:", err)
+		fmt.Println(" Recompila y recarga los módulos en ../kernel (make && insmod) e intenta de nuevo.")
+		return
+	}
+	//GENERADOR DE CARGA
+	switch cfg.WorkloadMode {
+	case workloadModeNative:
+		if err := workload.Start(cfg.Workload); err != nil {
+			fmt.Println("No se pudo iniciar el generador de carga:", err)
+		}
+	case workloadModeScript:
+		if err := RunStressContainerScript(); err != nil {
+			fmt.Println("No se pudo ejecutar stress_container.sh:", err)
+		}
 	}
 
 	//LOOP PRINCIPAL
@@ -119,7 +134,9 @@ func main() {
 	fmt.Println("  Monitor + Orquestador de contenedores iniciado")
 	fmt.Printf("   Leyendo sysinfo:  %s\n", sysinfoPath)
 	fmt.Printf("   Leyendo continfo: %s\n", continfoPath)
-	fmt.Printf("   Intervalo:        %s\n", defaultInterval1)
+	fmt.Printf("   Intervalos:       sysinfo+host %ds, continfo %ds, cgroup %ds, orquestador %ds\n",
+		cfg.SysinfoIntervalSeconds, cfg.ContinfoIntervalSeconds, cfg.CgroupIntervalSeconds,
+		cfg.EnforceIntervalSeconds)
 	fmt.Println("   Ctrl+C para detener.")
 	fmt.Println()
 
@@ -143,6 +160,38 @@ func main() {
 		fmt.Println("Error creando process_state_summary:", err)
 		return
 	}
+	if err := CreateProcessesTables(db); err != nil {
+		fmt.Println("Error creando processes:", err)
+		return
+	}
+	if err := MigrateProcessTreeColumns(db); err != nil {
+		fmt.Println("Error migrando columnas del árbol de procesos:", err)
+		return
+	}
+	if err := CreateProcessAggregateTables(db); err != nil {
+		fmt.Println("Error creando agregados por usuario/comando:", err)
+		return
+	}
+	if err := CreateProcessStateEventsTable(db); err != nil {
+		fmt.Println("Error creando process_state_events:", err)
+		return
+	}
+	if err := CreateLeakFindingsTable(db); err != nil {
+		fmt.Println("Error creando leak_findings:", err)
+		return
+	}
+	if err := CreateHostPressureTables(db); err != nil {
+		fmt.Println("Error creando métricas de presión del host:", err)
+		return
+	}
+	if err := CreateAnomalyEventsTable(db); err != nil {
+		fmt.Println("Error creando anomaly_events:", err)
+		return
+	}
+	if err := CreateAlertTables(db); err != nil {
+		fmt.Println("Error creando tablas de alertas:", err)
+		return
+	}
 	if err := CreateContainerHostMetricsTable(db); err != nil {
 		fmt.Println("Error creando container_host_metrics:", err)
 		return
@@ -155,106 +204,116 @@ func main() {
 		fmt.Println("Error creando container_metrics:", err)
 		return
 	}
+	if err := CreateContainerExitsTable(db); err != nil {
+		fmt.Println("Error creando container_exits:", err)
+		return
+	}
+	if err := CreateContainerCgroupMetricsTable(db); err != nil {
+		fmt.Println("Error creando container_cgroup_metrics:", err)
+		return
+	}
+	if err := CreateEnforcementActionsTable(db); err != nil {
+		fmt.Println("Error creando enforcement_actions:", err)
+		return
+	}
+	if err := CreateStopEventsTable(db); err != nil {
+		fmt.Println("Error creando stop_events:", err)
+		return
+	}
+	if err := CreateOrchestratorStateTable(db); err != nil {
+		fmt.Println("Error creando orchestrator_state:", err)
+		return
+	}
+	if err := CreateCollectorCyclesTable(db); err != nil {
+		fmt.Println("Error creando collector_cycles:", err)
+		return
+	}
+	if err := MigrateSampleIntervalColumns(db); err != nil {
+		fmt.Println("Error migrando columnas de intervalo:", err)
+		return
+	}
+	if err := MigrateTickColumns(db); err != nil {
+		fmt.Println("Error migrando columnas de tick:", err)
+		return
+	}
+	if err := CreateScenarioTables(db); err != nil {
+		fmt.Println("Error creando tablas de escenarios:", err)
+		return
+	}
+	if found, err := LoadOrchestratorState(db, policyStateKey, policy); err != nil {
+		fmt.Println("Error cargando estado del orquestador:", err)
+	} else if found {
+		fmt.Println("Estado del orquestador restaurado desde la DB.")
+	}
+	if found, err := LoadOrchestratorState(db, throttledStateKey, &throttled); err != nil {
+		fmt.Println("Error cargando contenedores limitados:", err)
+	} else if found {
+		if throttled == nil {
+			throttled = make(map[string]*throttledContainer)
+		}
+		if len(throttled) > 0 {
+			fmt.Printf("%d contenedores limitados restaurados desde la DB.\n", len(throttled))
+		}
+	}
+	if active, err := LoadActiveAlerts(db); err != nil {
+		fmt.Println("Error cargando alertas en curso:", err)
+	} else if len(active) > 0 {
+		alerts.Restore(active)
+		fmt.Printf("%d alertas en curso restauradas desde la DB.\n", len(active))
+	}
 
-	// Para calcular %CPU necesitamos snapshot previo
-	var (
-		prevSys      SysInfo
-		havePrevSys  bool
-		prevCont     ContInfoSnapshot
-		havePrevCont bool
-	)
+	// Escritor único: se crea antes que la API, que publica su estado
+	writer = newDBWriter(db, cfg.WriterQueueSize, cfg.WriterDropPolicy)
 
-	numCPUs := runtime.NumCPU()
+	// Detección de OOM / salidas de contenedores vía docker events
+	go WatchContainerEvents(ctx)
 
-	for {
-		fmt.Println("\n\n========== CICLO DE MONITOREO ==========")
-		now := time.Now()
-		fmt.Printf("%s\n", now.Format(time.RFC3339))
+	StartAPIServer(apiAddr, db)
 
-		// ===== 1) SYSINFO: procesos del sistema =====
-		si, err := ReadSysinfo(sysinfoPath)
-		if err != nil {
-			fmt.Println(" Error leyendo sysinfo:", err)
-		} else {
-			// 1.a) Mostrar en consola
-			PrintSysInfo(si)
-
-			// 1.b) Insertar métricas globales
-			if _, err := InsertSystemMetrics(db, si); err != nil {
-				fmt.Println(" Error InsertSystemMetrics:", err)
-			}
-
-			// 1.c) Calcular %CPU por proceso (si tenemos snapshot previo)
-			var cpuPctProc map[int]float64
-			if havePrevSys {
-				cpuPctProc = BuildProcCpuPct(prevSys, si, numCPUs, 100.0) // HZ=100 (ajusta si tu kernel usa otro)
-			}
-
-			// 1.d) Insertar procesos
-			if err := InsertProcessMetricsBulk(db, si, cpuPctProc); err != nil {
-				fmt.Println("Error InsertProcessMetricsBulk:", err)
-			}
-
-			// 1.e) Resumen de estados
-			if err := InsertProcessStateSummary(db, si); err != nil {
-				fmt.Println("Error InsertProcessStateSummary:", err)
-			}
-
-			// Actualizar snapshot previo
-			prevSys = si
-			havePrevSys = true
+	// Escenario de carga por fases (opcional)
+	if cfg.ScenarioFile != "" {
+		if scn, err := LoadScenario(cfg.ScenarioFile); err != nil {
+			fmt.Println("No se pudo cargar el escenario:", err)
+		} else if _, err := scenarios.Start(scn); err != nil {
+			fmt.Println("No se pudo iniciar el escenario:", err)
 		}
+	}
 
-		// ===== 2) CONINFO: contenedores =====
-		snap, err := ReadContInfo(continfoPath)
-		if err != nil {
-			fmt.Println("Error leyendo continfo:", err)
-		} else {
+	// Colectores por fuente + escritor único + orquestador, cada uno en su ticker
+	collectorsDone := StartCollectors(ctx)
 
-			// 2.b) Ciclo de vida de contenedores (containers)
-			if err := UpsertContainersFromSnapshot(db, snap); err != nil {
-				fmt.Println(" Error UpsertContainersFromSnapshot:", err)
-			}
-
-			// 2.c) Total contenedores eliminados (acumulado)
-			totalDeletedAcc, err := GetTotalDeletedContainers(db)
-			if err != nil {
-				fmt.Println("Error GetTotalDeletedContainers:", err)
-				totalDeletedAcc = 0
-			}
-
-			// 2.d) Métricas a nivel host de contenedores
-			if _, err := InsertContainerHostMetrics(db, snap, totalDeletedAcc); err != nil {
-				fmt.Println(" Error InsertContainerHostMetrics:", err)
-			}
-
-			// 2.e) Calcular %CPU por contenedor (si tenemos snapshot previo)
-			var cpuPctCont map[string]float64
-			if havePrevCont {
-				cpuPctCont = BuildContainerCpuPct(prevCont, snap, numCPUs)
-			}
-
-			// 2.f) Métricas por contenedor
-			if err := InsertContainerMetricsBulk(db, snap, cpuPctCont); err != nil {
-				fmt.Println(" Error InsertContainerMetricsBulk:", err)
-			}
-
-			// Actualizar snapshot previo
-			prevCont = snap
-			havePrevCont = true
-		}
+	<-ctx.Done()
+	cancel() // un segundo Ctrl+C vuelve a terminar el proceso de inmediato
+	fmt.Println("\nSeñal de parada recibida (Ctrl+C).")
+
+	scenarios.Shutdown()
+	workload.Stop()
+
+	// 1. Esperar el último ciclo de cada colector y vaciar la cola del escritor
+	fmt.Println("Esperando a los colectores y al escritor...")
+	select {
+	case <-collectorsDone:
+	case <-time.After(shutdownTimeout):
+		fmt.Printf("Los colectores no terminaron en %s; pueden perderse escrituras.\n", shutdownTimeout)
+	}
 
-		// ===== 3) Aplicar reglas de eliminación sobre contenedores stress-* =====
-		enforceRules()
+	// 2. Detener procesos supervisados (stress_container.sh)
+	fmt.Println("Deteniendo procesos supervisados...")
+	supervisor.StopAll()
 
-		// ===== 4) Esperar siguiente ciclo
-		time.Sleep(defaultInterval1)
+	// 3. Ejecutar script detener.sh
+	fmt.Println("Ejecutando detener.sh...")
+	if err := RunDetenerScript(); err != nil {
+		fmt.Println("Error al ejecutar detener.sh:", err)
 	}
+
+	fmt.Println("Saliendo del daemon.")
 }
 
 // OpenDB abre (o crea) el archivo SQLite
 func OpenDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	// busy_timeout: la API y Grafana leen mientras el escritor escribe
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000")
 	if err != nil {
 		return nil, fmt.Errorf("no se pudo abrir la DB %s: %w", dbPath, err)
 	}
@@ -268,89 +327,53 @@ func OpenDB(dbPath string) (*sql.DB, error) {
 	return db, nil
 }
 
-func RunInstallModules() error {
-	scriptPath := "../bash/install_modules.sh"
-
-	cmd := exec.Command("bash", scriptPath)
-
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-
-	fmt.Println(" Ejecutando script de instalación de módulos:", scriptPath)
+// Procesos hijos (scripts bash) ejecutados por el supervisor
+const (
+	installModulesScript = "../bash/install_modules.sh"
+	stressScript         = "../cronjob/stress_container.sh"
+	detenerScript        = "../cronjob/detener.sh"
+)
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error ejecutando %s: %w\nstderr:\n%s", scriptPath, err, stderr.String())
+func RunInstallModules() error {
+	fmt.Println(" Ejecutando script de instalación de módulos:", installModulesScript)
+	if err := supervisor.Run(ProcessSpec{
+		Name:    "install_modules",
+		Command: "bash",
+		Args:    []string{installModulesScript},
+		Timeout: 10 * time.Minute,
+	}); err != nil {
+		return err
 	}
-
 	fmt.Println("Script de instalación finalizado.")
-	if out.Len() > 0 {
-		fmt.Println("Salida:")
-		fmt.Println(out.String())
-	}
 	return nil
 }
 
+// RunStressContainerScript deja el script de estrés bajo el supervisor:
+// si muere se reinicia con backoff exponencial.
 func RunStressContainerScript() error {
-	scriptPath := "../cronjob/stress_container.sh"
-
-	stressCmd = exec.Command("bash", scriptPath)
-
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	stressCmd.Stdout = &out
-	stressCmd.Stderr = &stderr
-
-	fmt.Println("Ejecutando script de estrés de contenedores:", scriptPath)
-
-	// Start() para que NO bloquee el main
-	if err := stressCmd.Start(); err != nil {
-		stressCmd = nil
-		return fmt.Errorf("error iniciando %s: %w\nstderr:\n%s", scriptPath, err, stderr.String())
-	}
-
-	// Esperamos en segundo plano, solo para loguear cuando termine
-	go func() {
-		if err := stressCmd.Wait(); err != nil {
-			fmt.Println("stress_container.sh terminó con error:", err)
-		} else {
-			fmt.Println("Script stress_container.sh finalizado.")
-		}
-
-		if out.Len() > 0 {
-			fmt.Println("Salida script stress_container.sh:")
-			fmt.Println(out.String())
-		}
-
-		// cuando termina, limpiamos referencia
-		stressCmd = nil
-	}()
-
-	return nil
+	fmt.Println("Ejecutando script de estrés de contenedores:", stressScript)
+	return supervisor.Start(ProcessSpec{
+		Name:        "stress_container",
+		Command:     "bash",
+		Args:        []string{stressScript},
+		Restart:     restartOnFailure,
+		BackoffMin:  2 * time.Second,
+		BackoffMax:  2 * time.Minute,
+		StableAfter: 5 * time.Minute,
+	})
 }
 
 // Ejecuta el bash que detiene los contenedores de estrés
 func RunDetenerScript() error {
-	scriptPath := "../cronjob/detener.sh"
-
-	cmd := exec.Command("bash", scriptPath)
-
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-
-	fmt.Println("Ejecutando script de limpieza de contenedores:", scriptPath)
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error ejecutando %s: %w\nstderr:\n%s", scriptPath, err, stderr.String())
+	fmt.Println("Ejecutando script de limpieza de contenedores:", detenerScript)
+	if err := supervisor.Run(ProcessSpec{
+		Name:    "detener",
+		Command: "bash",
+		Args:    []string{detenerScript},
+		Timeout: 2 * time.Minute,
+	}); err != nil {
+		return err
 	}
-
 	fmt.Println("Script detener.sh finalizado.")
-	if out.Len() > 0 {
-		fmt.Println("Salida:")
-		fmt.Println(out.String())
-	}
 	return nil
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// addColumnIfMissing agrega una columna a una tabla existente (SQLite no tiene
+// ADD COLUMN IF NOT EXISTS). Sirve para DBs creadas por versiones anteriores.
+func addColumnIfMissing(db *sql.DB, table, column, colType string) error {
+	columns, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+	if columns[column] {
+		return nil
+	}
+
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s;`, table, column, colType)); err != nil {
+		return fmt.Errorf("error agregando columna %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// tableColumns devuelve los nombres de columna de una tabla (PRAGMA table_info).
+// Una tabla inexistente da un conjunto vacío.
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s);`, table))
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo columnas de %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			ctype     string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dfltValue, &pk); err != nil {
+			return nil, fmt.Errorf("error leyendo columnas de %s: %w", table, err)
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterando columnas de %s: %w", table, err)
+	}
+	return columns, nil
+}
+
+// nullIfZero guarda NULL en vez de 0.
+func nullIfZero(v int64) interface{} {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+// nullIfEmpty guarda NULL en vez de cadena vacía.
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Modos de manejo de los módulos del kernel
+const (
+	moduleModeManager = "manager" // el daemon verifica, compila y carga
+	moduleModeScript  = "script"  // ../bash/install_modules.sh
+	moduleModeOff     = "off"     // se asume que ya están cargados
+)
+
+// Espera entre intentos de carga fallidos: se duplica en cada fallo hasta el máximo.
+const (
+	moduleRetryBase = 30 * time.Second
+	moduleRetryMax  = 10 * time.Minute
+)
+
+// Executor ejecuta comandos externos. Se puede reemplazar por uno falso.
+type Executor interface {
+	Run(timeout time.Duration, name string, args ...string) (string, error)
+}
+
+// hostExecutor ejecuta los comandos en el host con runCmd.
+type hostExecutor struct{}
+
+func (hostExecutor) Run(timeout time.Duration, name string, args ...string) (string, error) {
+	return runCmd(timeout, name, args...)
+}
+
+// KernelModule es un módulo del proyecto y el archivo /proc que expone.
+type KernelModule struct {
+	Name     string
+	ProcPath string
+	// validate comprueba que el contenido de ProcPath sea JSON utilizable
+	validate func(data []byte) error
+}
+
+// ModuleStatus es el estado de un módulo (API).
+type ModuleStatus struct {
+	Name          string `json:"name"`
+	Loaded        bool   `json:"loaded"`
+	ProcPresent   bool   `json:"proc_present"`
+	JSONValid     bool   `json:"json_valid"`
+	LastError     string `json:"last_error,omitempty"`
+	Loads         int    `json:"loads"`
+	Reloads       int    `json:"reloads"`
+	LastCheckTsMs int64  `json:"last_check_ts_ms"`
+	LastLoadTsMs  int64  `json:"last_load_ts_ms,omitempty"`
+	// intentos de carga fallidos seguidos; al llegar al máximo se deja de intentar
+	FailedLoads   int   `json:"failed_loads"`
+	NextRetryTsMs int64 `json:"next_retry_ts_ms,omitempty"`
+	GaveUp        bool  `json:"gave_up,omitempty"`
+}
+
+func (s ModuleStatus) healthy() bool {
+	return s.Loaded && s.ProcPresent && s.JSONValid
+}
+
+// moduleManager verifica /proc/modules y los archivos /proc de cada módulo,
+// y si hace falta los compila (make) y carga (insmod) desde KernelDir.
+type moduleManager struct {
+	mu        sync.Mutex // protege el estado; no se retiene durante make/insmod
+	ensureMu  sync.Mutex // una sola verificación/carga a la vez
+	exec      Executor
+	readFile  func(path string) ([]byte, error)
+	statFile  func(path string) (os.FileInfo, error)
+	kernelDir string
+	autoLoad  bool
+	autoBuild bool
+	// maxAttempts es el tope de cargas fallidas seguidas (0 = sin tope)
+	maxAttempts int
+	retryBase   time.Duration
+	retryMax    time.Duration
+	now         func() time.Time
+	modules     []KernelModule
+	status      map[string]*ModuleStatus
+}
+
+func defaultKernelModules() []KernelModule {
+	return []KernelModule{
+		{
+			Name:     "sysinfo_so1_201801521",
+			ProcPath: sysinfoPath,
+			validate: func(data []byte) error {
+				return validateSnapshot(snapshotSysinfo, data)
+			},
+		},
+		{
+			Name:     "continfo_so1_201801521",
+			ProcPath: continfoPath,
+			validate: func(data []byte) error {
+				return validateSnapshot(snapshotContinfo, data)
+			},
+		},
+	}
+}
+
+func newModuleManager(exec Executor, kernelDir string, autoLoad, autoBuild bool, modules []KernelModule) *moduleManager {
+	m := &moduleManager{
+		exec:        exec,
+		readFile:    os.ReadFile,
+		statFile:    os.Stat,
+		kernelDir:   kernelDir,
+		autoLoad:    autoLoad,
+		autoBuild:   autoBuild,
+		maxAttempts: 5,
+		retryBase:   moduleRetryBase,
+		retryMax:    moduleRetryMax,
+		now:         time.Now,
+		modules:     modules,
+		status:      make(map[string]*ModuleStatus, len(modules)),
+	}
+	for _, mod := range modules {
+		m.status[mod.Name] = &ModuleStatus{Name: mod.Name}
+	}
+	return m
+}
+
+var kmods = newModuleManager(hostExecutor{}, "../kernel", true, false, defaultKernelModules())
+
+// configure aplica la configuración del daemon.
+func (m *moduleManager) configure(c DaemonConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kernelDir = c.KernelDir
+	m.autoLoad = c.ModuleAutoLoad
+	m.autoBuild = c.ModuleAutoBuild
+	m.maxAttempts = c.ModuleMaxLoadAttempts
+}
+
+// loadedModules lee los nombres de /proc/modules.
+func (m *moduleManager) loadedModules() (map[string]bool, error) {
+	data, err := m.readFile("/proc/modules")
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer /proc/modules: %w", err)
+	}
+	loaded := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			loaded[fields[0]] = true
+		}
+	}
+	return loaded, nil
+}
+
+// check actualiza el estado de un módulo sin modificar nada.
+func (m *moduleManager) check(mod KernelModule, loaded map[string]bool) ModuleStatus {
+	st := m.status[mod.Name]
+	st.LastCheckTsMs = m.now().UnixMilli()
+	st.Loaded = loaded[mod.Name]
+	st.ProcPresent = false
+	st.JSONValid = false
+	st.LastError = ""
+
+	if !st.Loaded {
+		st.LastError = "no aparece en /proc/modules"
+		return *st
+	}
+	if _, err := m.statFile(mod.ProcPath); err != nil {
+		st.LastError = fmt.Sprintf("%s no existe: %v", mod.ProcPath, err)
+		return *st
+	}
+	st.ProcPresent = true
+
+	data, err := m.readFile(mod.ProcPath)
+	if err != nil {
+		st.LastError = fmt.Sprintf("no se pudo leer %s: %v", mod.ProcPath, err)
+		return *st
+	}
+	if err := mod.validate(data); err != nil {
+		st.LastError = fmt.Sprintf("snapshot inválido en %s: %v", mod.ProcPath, err)
+		return *st
+	}
+	st.JSONValid = true
+	return *st
+}
+
+// Check verifica todos los módulos sin cargarlos.
+func (m *moduleManager) Check() ([]ModuleStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	loaded, err := m.loadedModules()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ModuleStatus, 0, len(m.modules))
+	for _, mod := range m.modules {
+		out = append(out, m.check(mod, loaded))
+	}
+	return out, nil
+}
+
+// loadJob es una carga decidida con el lock tomado y ejecutada sin él.
+type loadJob struct {
+	mod       KernelModule
+	loaded    bool // estaba en /proc/modules: se descarga antes
+	wasLoaded bool // el chequeo anterior lo vio cargado (cuenta como recarga)
+	kernelDir string
+	autoBuild bool
+}
+
+// Ensure verifica los módulos y, con autoLoad, (re)carga los que fallen.
+// Se llama al arrancar y periódicamente para detectar módulos que desaparecen.
+// Una lectura o validación fallida en un módulo que estaba sano se tolera una
+// vez (puede ser transitoria); las cargas fallidas esperan con backoff y tras
+// maxAttempts se abandonan hasta que el módulo vuelva a estar sano.
+// make/rmmod/insmod corren sin m.mu, así Status responde durante una compilación.
+func (m *moduleManager) Ensure() error {
+	m.ensureMu.Lock()
+	defer m.ensureMu.Unlock()
+
+	m.mu.Lock()
+	loaded, err := m.loadedModules()
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+
+	var failed []string
+	var jobs []loadJob
+	for _, mod := range m.modules {
+		status := m.status[mod.Name]
+		// si el chequeo anterior lo vio cargado, desapareció en ejecución
+		wasLoaded := status.Loaded
+		wasHealthy := status.healthy()
+		st := m.check(mod, loaded)
+		if st.healthy() {
+			if status.FailedLoads > 0 || status.GaveUp {
+				fmt.Printf(" Módulo %s recuperado.\n", mod.Name)
+			}
+			status.FailedLoads, status.NextRetryTsMs, status.GaveUp = 0, 0, false
+			continue
+		}
+		if !m.autoLoad {
+			failed = append(failed, fmt.Sprintf("%s: %s", mod.Name, st.LastError))
+			continue
+		}
+		if wasHealthy && st.Loaded && st.ProcPresent {
+			failed = append(failed, fmt.Sprintf("%s: %s (se recarga si se repite)", mod.Name, st.LastError))
+			continue
+		}
+		if status.GaveUp {
+			failed = append(failed, fmt.Sprintf("%s: %s (recarga abandonada tras %d intentos)",
+				mod.Name, st.LastError, status.FailedLoads))
+			continue
+		}
+		now := m.now()
+		if status.NextRetryTsMs > now.UnixMilli() {
+			failed = append(failed, fmt.Sprintf("%s: %s (próximo intento en %s)", mod.Name, st.LastError,
+				time.UnixMilli(status.NextRetryTsMs).Sub(now).Round(time.Second)))
+			continue
+		}
+		fmt.Printf(" Módulo %s con problemas (%s), recargando...\n", mod.Name, st.LastError)
+		jobs = append(jobs, loadJob{mod: mod, loaded: st.Loaded, wasLoaded: wasLoaded,
+			kernelDir: m.kernelDir, autoBuild: m.autoBuild})
+	}
+	m.mu.Unlock()
+
+	for _, job := range jobs {
+		loadErr := m.load(job)
+
+		m.mu.Lock()
+		if msg := m.loadFinished(job, loadErr); msg != "" {
+			failed = append(failed, msg)
+		}
+		m.mu.Unlock()
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("módulos con problemas: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// loadFinished registra el resultado de una carga (con m.mu tomado) y
+// devuelve el problema a informar, o "" si el módulo quedó sano.
+func (m *moduleManager) loadFinished(job loadJob, loadErr error) string {
+	name := job.mod.Name
+	status := m.status[name]
+	now := m.now()
+	if loadErr != nil {
+		status.LastError = loadErr.Error()
+		m.loadFailed(status, now)
+		return fmt.Sprintf("%s: %v", name, loadErr)
+	}
+
+	loaded, err := m.loadedModules()
+	if err != nil {
+		return fmt.Sprintf("%s: %v", name, err)
+	}
+	st := m.check(job.mod, loaded)
+	status.Loads++
+	status.LastLoadTsMs = now.UnixMilli()
+	if job.wasLoaded {
+		status.Reloads++
+	}
+	if !st.healthy() {
+		m.loadFailed(status, now)
+		return fmt.Sprintf("%s: %s", name, st.LastError)
+	}
+	status.FailedLoads, status.NextRetryTsMs = 0, 0
+	fmt.Printf(" Módulo %s cargado.\n", name)
+	return ""
+}
+
+// loadFailed registra una carga fallida y programa el próximo intento.
+func (m *moduleManager) loadFailed(st *ModuleStatus, now time.Time) {
+	st.FailedLoads++
+	if m.maxAttempts > 0 && st.FailedLoads >= m.maxAttempts {
+		st.GaveUp = true
+		st.NextRetryTsMs = 0
+		fmt.Printf(" Módulo %s: %d cargas fallidas seguidas, no se reintenta hasta que vuelva a estar sano.\n",
+			st.Name, st.FailedLoads)
+		return
+	}
+	wait := m.retryBase
+	for i := 1; i < st.FailedLoads && wait < m.retryMax; i++ {
+		wait *= 2
+	}
+	if wait > m.retryMax {
+		wait = m.retryMax
+	}
+	st.NextRetryTsMs = now.Add(wait).UnixMilli()
+}
+
+// load compila (si hace falta) y carga el módulo; si ya estaba cargado lo
+// descarga antes. Corre sin m.mu: solo usa lo que trae job.
+func (m *moduleManager) load(job loadJob) error {
+	mod := job.mod
+	ko := filepath.Join(job.kernelDir, mod.Name+".ko")
+	src := filepath.Join(job.kernelDir, mod.Name+".c")
+
+	// compilar si falta el .ko o si el fuente es más nuevo (p.ej. cambió el schema)
+	needBuild := false
+	if koInfo, err := m.statFile(ko); err != nil {
+		if !job.autoBuild {
+			return fmt.Errorf("no existe %s y module_auto_build está desactivado", ko)
+		}
+		needBuild = true
+	} else if srcInfo, err := m.statFile(src); err == nil && job.autoBuild && srcInfo.ModTime().After(koInfo.ModTime()) {
+		needBuild = true
+	}
+
+	if needBuild {
+		fmt.Println(" Compilando módulos en", job.kernelDir)
+		if _, err := m.exec.Run(5*time.Minute, "make", "-C", job.kernelDir); err != nil {
+			return fmt.Errorf("error compilando módulos: %w", err)
+		}
+		if _, err := m.statFile(ko); err != nil {
+			return fmt.Errorf("no se encontró %s después de compilar", ko)
+		}
+	}
+
+	if job.loaded {
+		if _, err := m.exec.Run(30*time.Second, "rmmod", mod.Name); err != nil {
+			return fmt.Errorf("error descargando %s: %w", mod.Name, err)
+		}
+	}
+	if _, err := m.exec.Run(30*time.Second, "insmod", ko); err != nil {
+		return fmt.Errorf("error cargando %s: %w", ko, err)
+	}
+	return nil
+}
+
+func (m *moduleManager) Status() []ModuleStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]ModuleStatus, 0, len(m.modules))
+	for _, mod := range m.modules {
+		out = append(out, *m.status[mod.Name])
+	}
+	return out
+}
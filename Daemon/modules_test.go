@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testModule   = "sysinfo_test"
+	testProcPath = "/proc/sysinfo_test"
+	testKO       = "/kernel/sysinfo_test.ko"
+	testSrc      = "/kernel/sysinfo_test.c"
+)
+
+// fakeFile es un archivo del sistema de archivos falso.
+type fakeFile struct {
+	data    string
+	modTime time.Time
+}
+
+type fakeFileInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (fi fakeFileInfo) Name() string       { return fi.name }
+func (fi fakeFileInfo) Size() int64        { return 0 }
+func (fi fakeFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi fakeFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fakeFileInfo) IsDir() bool        { return false }
+func (fi fakeFileInfo) Sys() interface{}   { return nil }
+
+// fakeHost simula /proc, el directorio del kernel y los comandos make,
+// insmod y rmmod sobre un solo módulo.
+type fakeHost struct {
+	files     map[string]*fakeFile
+	loaded    bool
+	procData  string // contenido de ProcPath mientras el módulo está cargado
+	buildFail bool
+	commands  []string
+
+	// si no son nil, make avisa en building y espera a release
+	building chan struct{}
+	release  chan struct{}
+}
+
+func (h *fakeHost) Run(timeout time.Duration, name string, args ...string) (string, error) {
+	h.commands = append(h.commands, strings.TrimSpace(name+" "+strings.Join(args, " ")))
+	switch name {
+	case "make":
+		if h.building != nil {
+			close(h.building)
+			<-h.release
+		}
+		if h.buildFail {
+			return "", fmt.Errorf("error de compilación")
+		}
+		h.files[testKO] = &fakeFile{modTime: time.Now()}
+	case "insmod":
+		h.loaded = true
+	case "rmmod":
+		h.loaded = false
+	}
+	return "", nil
+}
+
+func (h *fakeHost) readFile(path string) ([]byte, error) {
+	switch path {
+	case "/proc/modules":
+		if h.loaded {
+			return []byte(testModule + " 16384 0 - Live 0x0000000000000000 (O)\n"), nil
+		}
+		return []byte("ext4 1015808 1 - Live 0x0000000000000000\n"), nil
+	case testProcPath:
+		if h.loaded {
+			return []byte(h.procData), nil
+		}
+	}
+	if f, ok := h.files[path]; ok {
+		return []byte(f.data), nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (h *fakeHost) statFile(path string) (os.FileInfo, error) {
+	if path == testProcPath && h.loaded {
+		return fakeFileInfo{name: path}, nil
+	}
+	if f, ok := h.files[path]; ok {
+		return fakeFileInfo{name: path, modTime: f.modTime}, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// newTestModuleManager arma un manager sobre el host falso con un reloj manual.
+func newTestModuleManager(h *fakeHost, clock *time.Time) *moduleManager {
+	mod := KernelModule{
+		Name:     testModule,
+		ProcPath: testProcPath,
+		validate: func(data []byte) error {
+			if string(data) != "ok" {
+				return fmt.Errorf("contenido inesperado %q", data)
+			}
+			return nil
+		},
+	}
+	m := newModuleManager(h, "/kernel", true, true, []KernelModule{mod})
+	m.readFile = h.readFile
+	m.statFile = h.statFile
+	m.maxAttempts = 3
+	m.now = func() time.Time { return *clock }
+	return m
+}
+
+func TestModuleManagerEnsure(t *testing.T) {
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := old.Add(time.Hour)
+
+	cases := []struct {
+		name         string
+		host         *fakeHost
+		wantErr      bool
+		wantCommands []string
+		wantLoads    int
+		wantFailed   int
+	}{
+		{
+			name: "sano",
+			host: &fakeHost{
+				files:    map[string]*fakeFile{testKO: {modTime: recent}, testSrc: {modTime: old}},
+				loaded:   true,
+				procData: "ok",
+			},
+		},
+		{
+			name: "no cargado con .ko al día",
+			host: &fakeHost{
+				files:    map[string]*fakeFile{testKO: {modTime: recent}, testSrc: {modTime: old}},
+				procData: "ok",
+			},
+			wantCommands: []string{"insmod " + testKO},
+			wantLoads:    1,
+		},
+		{
+			name: "fuente más nuevo que el .ko",
+			host: &fakeHost{
+				files:    map[string]*fakeFile{testKO: {modTime: old}, testSrc: {modTime: recent}},
+				procData: "ok",
+			},
+			wantCommands: []string{"make -C /kernel", "insmod " + testKO},
+			wantLoads:    1,
+		},
+		{
+			name: "cargado con snapshot viejo",
+			host: &fakeHost{
+				files:    map[string]*fakeFile{testKO: {modTime: recent}, testSrc: {modTime: old}},
+				loaded:   true,
+				procData: "schema viejo",
+			},
+			wantErr:      true,
+			wantCommands: []string{"rmmod " + testModule, "insmod " + testKO},
+			wantLoads:    1,
+			wantFailed:   1,
+		},
+		{
+			name: "compilación fallida",
+			host: &fakeHost{
+				files:     map[string]*fakeFile{testSrc: {modTime: old}},
+				procData:  "ok",
+				buildFail: true,
+			},
+			wantErr:      true,
+			wantCommands: []string{"make -C /kernel"},
+			wantFailed:   1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := recent
+			m := newTestModuleManager(tc.host, &clock)
+			err := m.Ensure()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Ensure() error = %v, se esperaba error: %v", err, tc.wantErr)
+			}
+			if strings.Join(tc.host.commands, "|") != strings.Join(tc.wantCommands, "|") {
+				t.Errorf("comandos = %q, se esperaba %q", tc.host.commands, tc.wantCommands)
+			}
+			st := m.Status()[0]
+			if st.Loads != tc.wantLoads || st.FailedLoads != tc.wantFailed {
+				t.Errorf("loads = %d, failed_loads = %d, se esperaba %d y %d",
+					st.Loads, st.FailedLoads, tc.wantLoads, tc.wantFailed)
+			}
+		})
+	}
+}
+
+func TestModuleManagerBackoff(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &fakeHost{
+		files:     map[string]*fakeFile{testSrc: {modTime: clock}},
+		procData:  "ok",
+		buildFail: true,
+	}
+	m := newTestModuleManager(h, &clock)
+
+	builds := func() int {
+		n := 0
+		for _, c := range h.commands {
+			if strings.HasPrefix(c, "make") {
+				n++
+			}
+		}
+		return n
+	}
+
+	// primer intento
+	m.Ensure()
+	if builds() != 1 {
+		t.Fatalf("se esperaba 1 compilación, hubo %d", builds())
+	}
+
+	// dentro del backoff no se reintenta
+	clock = clock.Add(moduleRetryBase - time.Second)
+	m.Ensure()
+	if builds() != 1 {
+		t.Fatalf("se reintentó dentro del backoff (%d compilaciones)", builds())
+	}
+
+	// vencido el backoff se reintenta, y la espera siguiente se duplica
+	clock = clock.Add(time.Second)
+	m.Ensure()
+	if builds() != 2 {
+		t.Fatalf("se esperaban 2 compilaciones, hubo %d", builds())
+	}
+	if next := m.Status()[0].NextRetryTsMs; next != clock.Add(2*moduleRetryBase).UnixMilli() {
+		t.Errorf("próximo intento en %d, se esperaba %d", next, clock.Add(2*moduleRetryBase).UnixMilli())
+	}
+
+	// el tercer fallo alcanza maxAttempts: no se vuelve a intentar
+	clock = clock.Add(2 * moduleRetryBase)
+	m.Ensure()
+	clock = clock.Add(time.Hour)
+	m.Ensure()
+	if builds() != 3 {
+		t.Fatalf("se esperaban 3 compilaciones, hubo %d", builds())
+	}
+	if st := m.Status()[0]; !st.GaveUp || st.FailedLoads != 3 {
+		t.Errorf("gave_up = %v, failed_loads = %d, se esperaba true y 3", st.GaveUp, st.FailedLoads)
+	}
+
+	// si el módulo aparece sano (p.ej. cargado a mano) se reinicia el contador
+	h.loaded = true
+	if err := m.Ensure(); err != nil {
+		t.Fatal(err)
+	}
+	if st := m.Status()[0]; st.GaveUp || st.FailedLoads != 0 {
+		t.Errorf("después de recuperarse: gave_up = %v, failed_loads = %d", st.GaveUp, st.FailedLoads)
+	}
+}
+
+func TestModuleManagerTransientFailure(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &fakeHost{
+		files:    map[string]*fakeFile{testKO: {modTime: clock}, testSrc: {modTime: clock.Add(-time.Hour)}},
+		loaded:   true,
+		procData: "ok",
+	}
+	m := newTestModuleManager(h, &clock)
+	if err := m.Ensure(); err != nil {
+		t.Fatal(err)
+	}
+
+	// una lectura inválida en un módulo sano se tolera
+	h.procData = "{"
+	if err := m.Ensure(); err == nil {
+		t.Errorf("se esperaba error con snapshot inválido")
+	}
+	if len(h.commands) != 0 {
+		t.Fatalf("se recargó ante una falla aislada: %q", h.commands)
+	}
+
+	// si se repite, se recarga
+	m.Ensure()
+	want := []string{"rmmod " + testModule, "insmod " + testKO}
+	if strings.Join(h.commands, "|") != strings.Join(want, "|") {
+		t.Errorf("comandos = %q, se esperaba %q", h.commands, want)
+	}
+}
+
+// Una compilación lenta no retiene el lock del manager: Status responde
+// mientras make corre.
+func TestModuleManagerStatusDuringBuild(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &fakeHost{
+		files:    map[string]*fakeFile{testSrc: {modTime: clock}},
+		procData: "ok",
+		building: make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	m := newTestModuleManager(h, &clock)
+
+	ensured := make(chan error, 1)
+	go func() { ensured <- m.Ensure() }()
+	<-h.building
+
+	statusDone := make(chan []ModuleStatus, 1)
+	go func() { statusDone <- m.Status() }()
+	select {
+	case st := <-statusDone:
+		if len(st) != 1 || st[0].Loaded {
+			t.Errorf("estado durante la compilación = %+v", st)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Status bloqueado mientras make corre")
+	}
+
+	close(h.release)
+	if err := <-ensured; err != nil {
+		t.Fatal(err)
+	}
+	if st := m.Status(); !st[0].Loaded || st[0].Loads != 1 {
+		t.Errorf("estado tras la carga = %+v", st[0])
+	}
+}
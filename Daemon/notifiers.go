@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Tipos de notificador de alertas
+const (
+	notifierWebhook = "webhook"
+	notifierCommand = "command"
+	notifierFile    = "file"
+)
+
+const defaultNotifierTimeout = 10 * time.Second
+
+// NotifierSpec configura un destino de notificaciones.
+type NotifierSpec struct {
+	Name           string            `json:"name"`
+	Type           string            `json:"type"`
+	URL            string            `json:"url"`     // webhook: POST con la alerta en JSON
+	Headers        map[string]string `json:"headers"` // webhook
+	Command        string            `json:"command"` // command: variables ALERT_* en el entorno
+	Args           []string          `json:"args"`
+	Path           string            `json:"path"` // file: una línea JSON por alerta
+	TimeoutSeconds int               `json:"timeout_seconds"`
+}
+
+func (n NotifierSpec) validate() error {
+	if n.Name == "" {
+		return fmt.Errorf("notificador sin name")
+	}
+	switch n.Type {
+	case notifierWebhook:
+		if n.URL == "" {
+			return fmt.Errorf("notificador %q: webhook sin url", n.Name)
+		}
+	case notifierCommand:
+		if n.Command == "" {
+			return fmt.Errorf("notificador %q: command sin command", n.Name)
+		}
+	case notifierFile:
+		if n.Path == "" {
+			return fmt.Errorf("notificador %q: file sin path", n.Name)
+		}
+	default:
+		return fmt.Errorf("notificador %q: type desconocido %q", n.Name, n.Type)
+	}
+	if n.TimeoutSeconds < 0 {
+		return fmt.Errorf("notificador %q: timeout_seconds no puede ser negativo", n.Name)
+	}
+	return nil
+}
+
+func (n NotifierSpec) timeout() time.Duration {
+	if n.TimeoutSeconds > 0 {
+		return time.Duration(n.TimeoutSeconds) * time.Second
+	}
+	return defaultNotifierTimeout
+}
+
+// send entrega una alerta según el tipo de notificador. procName es el nombre
+// del proceso en el supervisor para los notificadores command.
+func (n NotifierSpec) send(t AlertTransition, procName string) error {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	switch n.Type {
+	case notifierWebhook:
+		return n.sendWebhook(payload)
+	case notifierCommand:
+		return n.runCommand(t, payload, procName)
+	case notifierFile:
+		return n.appendFile(payload)
+	}
+	return fmt.Errorf("tipo de notificador desconocido %q", n.Type)
+}
+
+func (n NotifierSpec) sendWebhook(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.Headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: n.timeout()}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s respondió %s", n.URL, resp.Status)
+	}
+	return nil
+}
+
+// runCommand ejecuta el comando con el supervisor (salida al logger).
+func (n NotifierSpec) runCommand(t AlertTransition, payload []byte, procName string) error {
+	return supervisor.Run(ProcessSpec{
+		Name:    procName,
+		Command: n.Command,
+		Args:    n.Args,
+		Timeout: n.timeout(),
+		Env: []string{
+			"ALERT_RULE=" + t.Rule,
+			"ALERT_STATE=" + t.State,
+			"ALERT_SEVERITY=" + t.Severity,
+			"ALERT_SCOPE=" + t.Scope,
+			"ALERT_TARGET=" + t.TargetID,
+			"ALERT_TARGET_NAME=" + t.TargetName,
+			"ALERT_VALUE=" + strconv.FormatFloat(t.Value, 'f', 2, 64),
+			"ALERT_THRESHOLD=" + strconv.FormatFloat(t.Threshold, 'f', 2, 64),
+			"ALERT_MESSAGE=" + t.Message,
+			"ALERT_JSON=" + string(payload),
+		},
+	})
+}
+
+func (n NotifierSpec) appendFile(payload []byte) error {
+	f, err := os.OpenFile(n.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(payload, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// NotifierStatus son los contadores de un notificador (API).
+type NotifierStatus struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Sent      int    `json:"sent"`
+	Failed    int    `json:"failed"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// alertDispatcher entrega las notificaciones en segundo plano, en orden, para
+// que un webhook lento no frene al orquestador.
+type alertDispatcher struct {
+	mu      sync.Mutex
+	queue   chan AlertTransition
+	stats   map[string]*NotifierStatus
+	dropped int
+	closed  bool
+	done    chan struct{} // se cierra cuando Run entregó todo lo encolado
+}
+
+var dispatcher = newAlertDispatcher()
+
+func newAlertDispatcher() *alertDispatcher {
+	return &alertDispatcher{
+		queue: make(chan AlertTransition, 64),
+		stats: make(map[string]*NotifierStatus),
+		done:  make(chan struct{}),
+	}
+}
+
+// Enqueue encola las transiciones que se notifican (firing y resolved).
+// Después de Close no encola nada.
+func (d *alertDispatcher) Enqueue(transitions []AlertTransition) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	for _, t := range transitions {
+		if t.State != alertFiring && t.State != alertResolved {
+			continue
+		}
+		select {
+		case d.queue <- t:
+		default:
+			d.dropped++
+			logger.Warn("cola de notificaciones llena, alerta descartada", "alerta", t.Fingerprint)
+		}
+	}
+}
+
+// Run entrega las notificaciones hasta que se llama a Close y la cola queda vacía.
+func (d *alertDispatcher) Run() {
+	defer close(d.done)
+	for t := range d.queue {
+		for _, n := range notifiersFor(t.notifiers) {
+			d.deliver(n, t, "notify-"+n.Name)
+		}
+	}
+}
+
+// Close deja de aceptar transiciones; Run termina de entregar las encoladas
+// y cierra Done.
+func (d *alertDispatcher) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+}
+
+// Done se cierra cuando Run terminó.
+func (d *alertDispatcher) Done() <-chan struct{} {
+	return d.done
+}
+
+func (d *alertDispatcher) deliver(n NotifierSpec, t AlertTransition, procName string) error {
+	err := n.send(t, procName)
+	d.mu.Lock()
+	st, ok := d.stats[n.Name]
+	if !ok {
+		st = &NotifierStatus{Name: n.Name, Type: n.Type}
+		d.stats[n.Name] = st
+	}
+	if err != nil {
+		st.Failed++
+		st.LastError = err.Error()
+	} else {
+		st.Sent++
+	}
+	d.mu.Unlock()
+	if err != nil {
+		logger.Error("error enviando notificación", "notificador", n.Name, "alerta", t.Fingerprint, "error", err)
+	}
+	return err
+}
+
+// notifiersFor devuelve los notificadores indicados (todos si names está vacío).
+func notifiersFor(names []string) []NotifierSpec {
+	if len(names) == 0 {
+		return cfg.Notifiers
+	}
+	var out []NotifierSpec
+	for _, n := range cfg.Notifiers {
+		for _, name := range names {
+			if n.Name == name {
+				out = append(out, n)
+			}
+		}
+	}
+	return out
+}
+
+// SendTest envía una alerta de prueba a todos los notificadores y espera el
+// resultado (para probar un webhook local desde la API). Los comandos corren
+// con otro nombre en el supervisor para no chocar con una entrega en curso.
+func (d *alertDispatcher) SendTest() map[string]string {
+	now := time.Now().UnixMilli()
+	t := AlertTransition{
+		Fingerprint: alertFingerprint("prueba", "host"),
+		Rule:        "prueba",
+		Severity:    "info",
+		Scope:       alertScopeHost,
+		TargetID:    "host",
+		TargetName:  "host",
+		State:       alertFiring,
+		TsMs:        now,
+		SinceTsMs:   now,
+		Message:     "Alerta de prueba del daemon",
+	}
+	result := make(map[string]string, len(cfg.Notifiers))
+	for _, n := range cfg.Notifiers {
+		if err := d.deliver(n, t, "notify-test-"+n.Name); err != nil {
+			result[n.Name] = err.Error()
+		} else {
+			result[n.Name] = "ok"
+		}
+	}
+	return result
+}
+
+func (d *alertDispatcher) Status() map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := make([]NotifierStatus, 0, len(cfg.Notifiers))
+	for _, n := range cfg.Notifiers {
+		st := NotifierStatus{Name: n.Name, Type: n.Type}
+		if s, ok := d.stats[n.Name]; ok {
+			st = *s
+		}
+		list = append(list, st)
+	}
+	return map[string]interface{}{
+		"notifiers": list,
+		"queued":    len(d.queue),
+		"dropped":   d.dropped,
+	}
+}
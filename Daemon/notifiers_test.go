@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDispatcher() *alertDispatcher {
+	return newAlertDispatcher()
+}
+
+func testTransition() AlertTransition {
+	return AlertTransition{
+		Fingerprint: alertFingerprint("host_ram_alta", "host"),
+		Rule:        "host_ram_alta",
+		Severity:    "critical",
+		Scope:       alertScopeHost,
+		Metric:      "ram_pct",
+		Op:          ">=",
+		Threshold:   95,
+		TargetID:    "host",
+		TargetName:  "host",
+		State:       alertFiring,
+		Value:       97.5,
+		TsMs:        2000,
+		SinceTsMs:   1000,
+		Message:     "[firing] host_ram_alta",
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	type request struct {
+		method      string
+		contentType string
+		token       string
+		body        AlertTransition
+	}
+	var got []request
+
+	cases := []struct {
+		name       string
+		status     int
+		wantSent   int
+		wantFailed int
+	}{
+		{"2xx cuenta como enviada", http.StatusNoContent, 1, 0},
+		{"no 2xx cuenta como fallida", http.StatusInternalServerError, 0, 1},
+		{"redirección sin destino cuenta como fallida", http.StatusNotModified, 0, 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got = nil
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				req := request{
+					method:      r.Method,
+					contentType: r.Header.Get("Content-Type"),
+					token:       r.Header.Get("X-Token"),
+				}
+				if err := json.Unmarshal(data, &req.body); err != nil {
+					t.Errorf("payload no es JSON: %v (%s)", err, data)
+				}
+				got = append(got, req)
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			n := NotifierSpec{
+				Name:    "hook",
+				Type:    notifierWebhook,
+				URL:     srv.URL,
+				Headers: map[string]string{"X-Token": "secreto"},
+			}
+			d := newTestDispatcher()
+			err := d.deliver(n, testTransition(), "notify-hook")
+			if (err != nil) != (tc.wantFailed > 0) {
+				t.Errorf("deliver() error = %v", err)
+			}
+
+			if len(got) != 1 {
+				t.Fatalf("el servidor recibió %d requests, se esperaba 1", len(got))
+			}
+			req := got[0]
+			if req.method != http.MethodPost {
+				t.Errorf("método = %s, se esperaba POST", req.method)
+			}
+			if req.contentType != "application/json" {
+				t.Errorf("Content-Type = %q", req.contentType)
+			}
+			if req.token != "secreto" {
+				t.Errorf("X-Token = %q, se esperaba el header configurado", req.token)
+			}
+			if want := testTransition(); !reflect.DeepEqual(req.body, want) {
+				t.Errorf("payload =\n%+v\nse esperaba\n%+v", req.body, want)
+			}
+
+			st := d.stats["hook"]
+			if st == nil || st.Sent != tc.wantSent || st.Failed != tc.wantFailed {
+				t.Fatalf("estadísticas = %+v, se esperaba sent=%d failed=%d", st, tc.wantSent, tc.wantFailed)
+			}
+			if tc.wantFailed > 0 && st.LastError == "" {
+				t.Errorf("falta last_error en una entrega fallida")
+			}
+		})
+	}
+}
+
+func TestWebhookNotifierUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	d := newTestDispatcher()
+	n := NotifierSpec{Name: "caido", Type: notifierWebhook, URL: url, TimeoutSeconds: 1}
+	if err := d.deliver(n, testTransition(), "notify-caido"); err == nil {
+		t.Fatalf("se esperaba error con el servidor caído")
+	}
+	if st := d.stats["caido"]; st == nil || st.Failed != 1 || st.Sent != 0 {
+		t.Errorf("estadísticas = %+v, se esperaba failed=1", st)
+	}
+}
+
+// Al cerrar el dispatcher se entregan las transiciones ya encoladas y las que
+// llegan después se ignoran sin pánico.
+func TestDispatcherDrainsOnClose(t *testing.T) {
+	var mu sync.Mutex
+	received := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.Notifiers = []NotifierSpec{{Name: "hook", Type: notifierWebhook, URL: srv.URL}}
+
+	d := newTestDispatcher()
+	resolved := testTransition()
+	resolved.State = alertResolved
+	pending := testTransition()
+	pending.State = alertPending
+	d.Enqueue([]AlertTransition{testTransition(), pending, resolved})
+
+	go d.Run()
+	d.Close()
+	d.Enqueue([]AlertTransition{testTransition()})
+	d.Close()
+
+	select {
+	case <-d.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("el dispatcher no terminó de entregar")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if received != 2 {
+		t.Errorf("notificaciones entregadas = %d, se esperaban 2 (firing y resolved)", received)
+	}
+}
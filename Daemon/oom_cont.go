@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Motivos de salida de un contenedor
+const (
+	exitReasonOOM     = "OOM_KILLED"
+	exitReasonStopped = "STOPPED_BY_DAEMON"
+	exitReasonCrash   = "CRASH"
+	exitReasonExited  = "EXITED"
+)
+
+// ContainerExit es una salida de contenedor detectada (docker events + cgroup).
+type ContainerExit struct {
+	TsMs         int64  `json:"ts_ms"`
+	ContainerID  string `json:"container_id"`
+	Name         string `json:"name"`
+	ExitCode     int    `json:"exit_code"`
+	OOMKilled    bool   `json:"oom_killed"`
+	OOMKillCount uint64 `json:"oom_kill_count"`
+	Reason       string `json:"reason"`
+	LastRSSKB    uint64 `json:"last_rss_kb"`
+}
+
+// exitDedupWindow es cuánto se recuerda un "die" ya registrado para no
+// duplicarlo si docker events lo vuelve a entregar.
+const exitDedupWindow = 10 * time.Minute
+
+// containerExitTracker junta lo que se sabe de cada contenedor mientras vive
+// (último RSS, contador oom_kill, si el daemon lo detuvo) para clasificar su salida.
+type containerExitTracker struct {
+	mu          sync.Mutex
+	stopped     map[string]bool // IDs (cortos o completos) y nombres detenidos por el daemon
+	oomEvent    map[string]bool // docker emitió evento "oom"
+	oomKills    map[string]uint64
+	lastRSSKB   map[string]uint64 // memoria anónima (memory.stat anon), no la page cache
+	names       map[string]string
+	pending     []ContainerExit
+	seenExitIDs map[string]int64 // ID -> ts_ms del "die" registrado
+}
+
+var exitTracker = newContainerExitTracker()
+
+func newContainerExitTracker() *containerExitTracker {
+	return &containerExitTracker{
+		stopped:     make(map[string]bool),
+		oomEvent:    make(map[string]bool),
+		oomKills:    make(map[string]uint64),
+		lastRSSKB:   make(map[string]uint64),
+		names:       make(map[string]string),
+		seenExitIDs: make(map[string]int64),
+	}
+}
+
+// MarkStoppedByDaemon registra que stopContainer actuó sobre el contenedor.
+func (t *containerExitTracker) MarkStoppedByDaemon(c ContainerInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c.ID != "" {
+		t.stopped[c.ID] = true
+	}
+	if c.Name != "" {
+		t.stopped[c.Name] = true
+	}
+}
+
+func (t *containerExitTracker) wasStoppedByDaemon(fullID, name string) bool {
+	if t.stopped[fullID] || (name != "" && t.stopped[name]) {
+		return true
+	}
+	for id := range t.stopped {
+		if len(id) >= 12 && strings.HasPrefix(fullID, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *containerExitTracker) markOOMEvent(fullID string) {
+	t.mu.Lock()
+	t.oomEvent[fullID] = true
+	t.mu.Unlock()
+}
+
+// recordDie clasifica la salida y la deja pendiente para escribirla en la DB.
+func (t *containerExitTracker) recordDie(fullID, name string, exitCode int, inspectedOOM bool, tsMs int64) ContainerExit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if name == "" {
+		name = t.names[fullID]
+	}
+
+	ex := ContainerExit{
+		TsMs:         tsMs,
+		ContainerID:  fullID,
+		Name:         name,
+		ExitCode:     exitCode,
+		OOMKillCount: t.oomKills[fullID],
+		LastRSSKB:    t.lastRSSKB[fullID],
+	}
+	ex.OOMKilled = oomKilledMain(inspectedOOM, t.oomEvent[fullID], ex.OOMKillCount, exitCode)
+	ex.Reason = classifyExit(ex.OOMKilled, t.wasStoppedByDaemon(fullID, name), exitCode)
+
+	// el mismo evento entregado dos veces trae el mismo ts; un contenedor que
+	// se reinicia vuelve a morir con otro ts y sí se registra
+	if seen, ok := t.seenExitIDs[fullID]; !ok || seen != tsMs {
+		t.seenExitIDs[fullID] = tsMs
+		t.pending = append(t.pending, ex)
+	}
+
+	// el contenedor ya no existe: liberar su estado (los nombres se reutilizan)
+	for id := range t.stopped {
+		if id == name || (len(id) >= 12 && strings.HasPrefix(fullID, id)) {
+			delete(t.stopped, id)
+		}
+	}
+	delete(t.oomEvent, fullID)
+	delete(t.oomKills, fullID)
+	delete(t.lastRSSKB, fullID)
+	delete(t.names, fullID)
+	return ex
+}
+
+// classifyExit decide el motivo. Un OOM gana aunque el daemon también lo haya detenido.
+// exitCodeSIGKILL es el código de un proceso principal terminado por SIGKILL.
+const exitCodeSIGKILL = 128 + 9
+
+// oomKilledMain decide si el OOM killer mató al proceso principal. State.OOMKilled
+// de docker inspect es confiable; el evento "oom" y memory.events oom_kill también
+// cuentan a los hijos, así que solo valen si el contenedor murió por SIGKILL.
+func oomKilledMain(inspectedOOM, oomEvent bool, oomKillCount uint64, exitCode int) bool {
+	if inspectedOOM {
+		return true
+	}
+	return (oomEvent || oomKillCount > 0) && exitCode == exitCodeSIGKILL
+}
+
+func classifyExit(oomKilled, stoppedByDaemon bool, exitCode int) string {
+	switch {
+	case oomKilled:
+		return exitReasonOOM
+	case stoppedByDaemon:
+		return exitReasonStopped
+	case exitCode == 0:
+		return exitReasonExited
+	default:
+		return exitReasonCrash
+	}
+}
+
+// prune olvida el estado de contenedores que ya no corren (por ejemplo si se
+// perdió su evento "die") y los "die" registrados hace más de exitDedupWindow.
+func (t *containerExitTracker) prune(alive map[string]bool, nowMs int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.names {
+		if !alive[id] {
+			delete(t.names, id)
+			delete(t.oomKills, id)
+			delete(t.lastRSSKB, id)
+			delete(t.oomEvent, id)
+		}
+	}
+	for id, ts := range t.seenExitIDs {
+		if nowMs-ts > exitDedupWindow.Milliseconds() {
+			delete(t.seenExitIDs, id)
+		}
+	}
+}
+
+// Drain devuelve las salidas pendientes de persistir.
+func (t *containerExitTracker) Drain() []ContainerExit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := t.pending
+	t.pending = nil
+	return out
+}
+
+// PollContainerCgroups guarda, por contenedor vivo, el contador oom_kill de
+// memory.events y el último RSS (anon de memory.stat) antes de que desaparezca.
+// memory.current incluye page cache, que el kernel reclama antes de un OOM.
+func PollContainerCgroups(containers []ContainerInfo) {
+	alive := make(map[string]bool, len(containers))
+	for _, c := range containers {
+		alive[c.ID] = true
+	}
+	exitTracker.prune(alive, time.Now().UnixMilli())
+
+	for _, c := range containers {
+		dir, err := containerCgroupDir(cgroupRoot, c.ID)
+		if err != nil {
+			continue
+		}
+
+		events, err := readCgroupKeyValues(filepath.Join(dir, "memory.events"))
+		if err != nil {
+			continue
+		}
+		memStat, _ := readCgroupKeyValues(filepath.Join(dir, "memory.stat"))
+
+		exitTracker.mu.Lock()
+		exitTracker.names[c.ID] = c.Name
+		exitTracker.oomKills[c.ID] = events["oom_kill"]
+		if anon := memStat["anon"]; anon > 0 {
+			exitTracker.lastRSSKB[c.ID] = anon / 1024
+		}
+		exitTracker.mu.Unlock()
+
+		if events["oom_kill"] > 0 {
+			fmt.Printf("  OOM-kill dentro de %s: oom_kill=%d\n", c.Name, events["oom_kill"])
+		}
+	}
+}
+
+// dockerEvent es el subconjunto de `docker events --format '{{json .}}'` que usamos.
+type dockerEvent struct {
+	Status   string `json:"status"`
+	ID       string `json:"id"`
+	Action   string `json:"Action"`
+	TimeNano int64  `json:"timeNano"`
+	Actor    struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+}
+
+// WatchContainerEvents escucha `docker events` (oom/die) hasta que ctx termine.
+// Si docker events se corta se vuelve a lanzar a los pocos segundos.
+func WatchContainerEvents(ctx context.Context) {
+	for {
+		if err := watchContainerEventsOnce(ctx); err != nil {
+			fmt.Println("docker events terminó:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func watchContainerEventsOnce(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "docker", "events",
+		"--filter", "type=container",
+		"--filter", "event=oom",
+		"--filter", "event=die",
+		"--format", "{{json .}}",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error abriendo stdout de docker events: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error iniciando docker events: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		var ev dockerEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			continue
+		}
+		handleDockerEvent(ev)
+	}
+
+	return cmd.Wait()
+}
+
+func handleDockerEvent(ev dockerEvent) {
+	id := ev.Actor.ID
+	if id == "" {
+		id = ev.ID
+	}
+	action := ev.Action
+	if action == "" {
+		action = ev.Status
+	}
+	name := ev.Actor.Attributes["name"]
+
+	switch action {
+	case "oom":
+		fmt.Printf("Evento OOM en contenedor %s (%s)\n", name, shortID(id))
+		exitTracker.markOOMEvent(id)
+
+	case "die":
+		exitCode, _ := strconv.Atoi(ev.Actor.Attributes["exitCode"])
+		tsMs := time.Now().UnixMilli()
+		if ev.TimeNano > 0 {
+			tsMs = ev.TimeNano / int64(time.Millisecond)
+		}
+
+		// inspect solo funciona si el contenedor no fue creado con --rm
+		inspectedOOM := false
+		if st, err := inspectContainerState(id); err == nil {
+			inspectedOOM = st.OOMKilled
+			if st.ExitCode != 0 {
+				exitCode = st.ExitCode
+			}
+		}
+
+		ex := exitTracker.recordDie(id, name, exitCode, inspectedOOM, tsMs)
+		fmt.Printf("Contenedor %s terminó: exit=%d motivo=%s último RSS=%d KB\n",
+			ex.Name, ex.ExitCode, ex.Reason, ex.LastRSSKB)
+	}
+}
+
+type dockerContainerState struct {
+	OOMKilled bool `json:"OOMKilled"`
+	ExitCode  int  `json:"ExitCode"`
+}
+
+func inspectContainerState(id string) (dockerContainerState, error) {
+	var st dockerContainerState
+	out, err := runCmd(3*time.Second, "docker", "inspect", "--format", "{{json .State}}", id)
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &st); err != nil {
+		return st, fmt.Errorf("error parseando docker inspect de %s: %w", shortID(id), err)
+	}
+	return st, nil
+}
+
+func CreateContainerExitsTable(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS container_exits (
+        id              INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms           BIGINT NOT NULL,
+        container_id    VARCHAR(128) NOT NULL,
+        container_name  VARCHAR(128),
+        exit_code       INT NOT NULL,
+        oom_killed      INT NOT NULL,
+        oom_kill_count  BIGINT NOT NULL,
+        reason          VARCHAR(32) NOT NULL,
+        last_rss_kb     BIGINT,
+        created_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla container_exits: %w", err)
+	}
+
+	idx := `CREATE INDEX IF NOT EXISTS idx_cexits_ts ON container_exits(ts_ms);`
+	if _, err := db.Exec(idx); err != nil {
+		return fmt.Errorf("error creando índice idx_cexits_ts: %w", err)
+	}
+
+	// Vistas para Grafana
+	views := []string{
+		`CREATE VIEW IF NOT EXISTS v_container_exits_by_reason AS
+         SELECT (ts_ms / 60000) * 60000 AS minute_ts_ms,
+                reason,
+                COUNT(*) AS total
+         FROM container_exits
+         GROUP BY minute_ts_ms, reason;`,
+		`CREATE VIEW IF NOT EXISTS v_container_oom_kills AS
+         SELECT ts_ms, container_name, exit_code, oom_kill_count, last_rss_kb
+         FROM container_exits
+         WHERE reason = 'OOM_KILLED';`,
+	}
+	for _, v := range views {
+		if _, err := db.Exec(v); err != nil {
+			return fmt.Errorf("error creando vista de container_exits: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// InsertContainerExits persiste las salidas detectadas desde el último ciclo.
+func InsertContainerExits(db *sql.DB, exits []ContainerExit) error {
+	if len(exits) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error iniciando transacción para container_exits: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+        INSERT INTO container_exits (
+            ts_ms,
+            container_id,
+            container_name,
+            exit_code,
+            oom_killed,
+            oom_kill_count,
+            reason,
+            last_rss_kb
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+    `)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error preparando INSERT en container_exits: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, ex := range exits {
+		oom := 0
+		if ex.OOMKilled {
+			oom = 1
+		}
+		if _, err := stmt.Exec(
+			ex.TsMs,
+			ex.ContainerID,
+			ex.Name,
+			ex.ExitCode,
+			oom,
+			int64(ex.OOMKillCount),
+			ex.Reason,
+			int64(ex.LastRSSKB),
+		); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error insertando salida de %s en container_exits: %w", ex.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error haciendo commit en container_exits: %w", err)
+	}
+	return nil
+}
+
+// QueryContainerExits devuelve las últimas salidas registradas (para la API).
+func QueryContainerExits(db *sql.DB, limit int) ([]ContainerExit, error) {
+	rows, err := db.Query(`
+        SELECT ts_ms, container_id, COALESCE(container_name, ''), exit_code,
+               oom_killed, oom_kill_count, reason, COALESCE(last_rss_kb, 0)
+        FROM container_exits
+        ORDER BY ts_ms DESC
+        LIMIT ?;
+    `, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando container_exits: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ContainerExit
+	for rows.Next() {
+		var ex ContainerExit
+		var oom int
+		var oomCount, rss int64
+		if err := rows.Scan(&ex.TsMs, &ex.ContainerID, &ex.Name, &ex.ExitCode,
+			&oom, &oomCount, &ex.Reason, &rss); err != nil {
+			return nil, fmt.Errorf("error leyendo container_exits: %w", err)
+		}
+		ex.OOMKilled = oom == 1
+		ex.OOMKillCount = uint64(oomCount)
+		ex.LastRSSKB = uint64(rss)
+		result = append(result, ex)
+	}
+	return result, rows.Err()
+}
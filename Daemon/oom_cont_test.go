@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// El último RSS de una salida es la memoria anónima, no memory.current (que
+// incluye page cache), y el estado de contenedores que ya no corren se libera.
+func TestContainerExitTrackerAnonAndPrune(t *testing.T) {
+	root, limitedID, _ := fakeCgroupTree(t)
+	writeCgroupFiles(t, filepath.Join(root, "system.slice", "docker-"+limitedID+".scope"), map[string]string{
+		"memory.events": "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+	})
+	savedRoot, savedTracker := cgroupRoot, exitTracker
+	t.Cleanup(func() { cgroupRoot, exitTracker = savedRoot, savedTracker })
+	cgroupRoot = root
+	exitTracker = newContainerExitTracker()
+
+	PollContainerCgroups([]ContainerInfo{{ID: limitedID, Name: "limitado"}})
+	if got := exitTracker.lastRSSKB[limitedID]; got != 73400320/1024 {
+		t.Errorf("último RSS = %d KB, se esperaba anon (%d KB)", got, 73400320/1024)
+	}
+
+	now := time.Now().UnixMilli()
+	ex := exitTracker.recordDie(limitedID, "", 137, false, now)
+	if ex.Reason != exitReasonOOM || ex.LastRSSKB != 73400320/1024 || ex.Name != "limitado" {
+		t.Errorf("salida = %+v", ex)
+	}
+
+	// el mismo evento entregado dos veces se registra una sola vez; otra
+	// muerte del mismo contenedor (reinicio) sí se registra
+	exitTracker.recordDie(limitedID, "limitado", 137, false, now)
+	exitTracker.recordDie(limitedID, "limitado", 1, false, now+5000)
+	if n := len(exitTracker.Drain()); n != 2 {
+		t.Errorf("salidas pendientes = %d, se esperaban 2", n)
+	}
+
+	// contenedor perdido sin evento "die" y dedupe vencido
+	exitTracker.names["perdido"] = "perdido"
+	exitTracker.lastRSSKB["perdido"] = 10
+	exitTracker.prune(map[string]bool{}, now+5000+exitDedupWindow.Milliseconds()+1)
+	if len(exitTracker.names) != 0 || len(exitTracker.lastRSSKB) != 0 || len(exitTracker.seenExitIDs) != 0 {
+		t.Errorf("estado tras prune: names=%v rss=%v seen=%v",
+			exitTracker.names, exitTracker.lastRSSKB, exitTracker.seenExitIDs)
+	}
+}
+
+func TestOOMKilledMain(t *testing.T) {
+	cases := []struct {
+		name         string
+		inspectedOOM bool
+		oomEvent     bool
+		oomKillCount uint64
+		exitCode     int
+		want         bool
+	}{
+		{name: "inspect lo confirma", inspectedOOM: true, exitCode: 137, want: true},
+		{name: "inspect aunque el código sea otro", inspectedOOM: true, exitCode: 1, want: true},
+		{name: "oom_kill y SIGKILL", oomKillCount: 1, exitCode: 137, want: true},
+		{name: "evento oom y SIGKILL", oomEvent: true, exitCode: 137, want: true},
+		{name: "hijo muerto por OOM, principal sale con 1", oomKillCount: 2, exitCode: 1},
+		{name: "hijo muerto por OOM, principal sale bien", oomEvent: true, oomKillCount: 1, exitCode: 0},
+		{name: "SIGKILL sin OOM", exitCode: 137},
+	}
+	for _, tc := range cases {
+		if got := oomKilledMain(tc.inspectedOOM, tc.oomEvent, tc.oomKillCount, tc.exitCode); got != tc.want {
+			t.Errorf("%s: oomKilledMain = %v, se esperaba %v", tc.name, got, tc.want)
+		}
+	}
+
+	// un crash con OOM de un hijo se clasifica como crash, no como OOM
+	tracker := newContainerExitTracker()
+	tracker.oomKills["c1"] = 1
+	tracker.markOOMEvent("c1")
+	if ex := tracker.recordDie("c1", "app", 1, false, 1000); ex.Reason != exitReasonCrash || ex.OOMKilled {
+		t.Errorf("salida = %+v, se esperaba CRASH", ex)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// orchestratorPolicy decide si el orquestador puede actuar en este ciclo y
+// sobre qué contenedores: histéresis sobre CPU/RAM del host, enfriamiento
+// tras actuar, límite de detenciones por minuto y edad mínima del contenedor.
+// Su estado se guarda en orchestrator_state para sobrevivir reinicios.
+type orchestratorPolicy struct {
+	Active          bool    `json:"active"`
+	LastActionTsMs  int64   `json:"last_action_ts_ms"`
+	KillTsMs        []int64 `json:"kill_ts_ms"`
+	actedThisCycle  bool
+	allowNewActions bool
+	stopBudget      int
+}
+
+const policyStateKey = "policy"
+
+// Arranca inactivo: con histéresis solo se activa al superar ActAbove*; sin
+// histéresis BeginCycle lo activa siempre.
+var policy = &orchestratorPolicy{}
+
+// BeginCycle evalúa histéresis y enfriamiento. Devuelve si se permiten acciones nuevas.
+func (p *orchestratorPolicy) BeginCycle(si *SysInfo, now time.Time) bool {
+	p.actedThisCycle = false
+	p.allowNewActions = false
+
+	if !hysteresisEnabled() {
+		p.Active = true
+	} else if si != nil {
+		p.updateHysteresis(*si)
+	}
+	if !p.Active {
+		fmt.Println(" Orquestador inactivo: uso del host bajo el umbral de histéresis.")
+		return false
+	}
+
+	cooldown := time.Duration(cfg.ActionCooldownSeconds) * time.Second
+	if p.LastActionTsMs > 0 {
+		since := now.Sub(time.UnixMilli(p.LastActionTsMs))
+		if since < cooldown {
+			fmt.Printf(" Orquestador en enfriamiento: %s desde la última acción (mínimo %s).\n",
+				since.Round(time.Second), cooldown)
+			return false
+		}
+	}
+
+	p.allowNewActions = true
+	return true
+}
+
+// hysteresisEnabled indica si hay algún umbral ActAbove*; con ambos en 0 siempre se actúa.
+func hysteresisEnabled() bool {
+	return cfg.ActAboveCPUPct > 0 || cfg.ActAboveRAMPct > 0
+}
+
+// updateHysteresis activa sobre ActAbove* y desactiva solo cuando todas las
+// dimensiones configuradas (ActAbove* > 0) están bajo su StopBelow*.
+func (p *orchestratorPolicy) updateHysteresis(si SysInfo) {
+	cpuPct := float64(si.CPUUsagePct)
+	ramPct := 0.0
+	if si.TotalRAMKB > 0 {
+		ramPct = float64(si.RamUsedKB) * 100.0 / float64(si.TotalRAMKB)
+	}
+
+	above := (cfg.ActAboveCPUPct > 0 && cpuPct >= cfg.ActAboveCPUPct) ||
+		(cfg.ActAboveRAMPct > 0 && ramPct >= cfg.ActAboveRAMPct)
+	below := (cfg.ActAboveCPUPct <= 0 || cpuPct < cfg.StopBelowCPUPct) &&
+		(cfg.ActAboveRAMPct <= 0 || ramPct < cfg.StopBelowRAMPct)
+
+	switch {
+	case !p.Active && above:
+		fmt.Printf(" Histéresis: activando orquestador (CPU %.0f%%, RAM %.0f%%)\n", cpuPct, ramPct)
+		p.Active = true
+	case p.Active && below:
+		fmt.Printf(" Histéresis: desactivando orquestador (CPU %.0f%%, RAM %.0f%%)\n", cpuPct, ramPct)
+		p.Active = false
+	}
+}
+
+// Refuse bloquea las acciones nuevas del ciclo (guardas de seguridad).
+func (p *orchestratorPolicy) Refuse(reason error) {
+	fmt.Println(" Se rechaza actuar en este ciclo:", reason)
+	p.allowNewActions = false
+}
+
+// SetStopBudget fija cuántas detenciones quedan antes de bajar de MinRunningContainers.
+func (p *orchestratorPolicy) SetStopBudget(n int) {
+	p.stopBudget = n
+}
+
+// eligible comprueba que el contenedor no esté protegido y tenga la edad mínima.
+func (p *orchestratorPolicy) eligible(c ContainerInfo, now time.Time) bool {
+	if !p.allowNewActions {
+		return false
+	}
+	if reason := protectedReason(c); reason != "" {
+		fmt.Printf("     (%s está protegido: %s)\n", c.Name, reason)
+		return false
+	}
+	minAge := time.Duration(cfg.MinContainerAgeSeconds) * time.Second
+	if !c.CreatedAt.IsZero() && now.Sub(c.CreatedAt) < minAge {
+		fmt.Printf("     (%s tiene %s, menos de la edad mínima %s)\n",
+			c.Name, now.Sub(c.CreatedAt).Round(time.Second), minAge)
+		return false
+	}
+	return true
+}
+
+// AllowAction autoriza una acción que no es detener (limitar, pausar).
+func (p *orchestratorPolicy) AllowAction(c ContainerInfo) bool {
+	now := time.Now()
+	if !p.eligible(c, now) {
+		return false
+	}
+	p.actedThisCycle = true
+	return true
+}
+
+// AllowStop autoriza una detención respetando MaxKillsPerMinute.
+func (p *orchestratorPolicy) AllowStop(c ContainerInfo) bool {
+	now := time.Now()
+	if !p.eligible(c, now) {
+		return false
+	}
+
+	// ventana deslizante de 60s
+	cutoff := now.Add(-time.Minute).UnixMilli()
+	recent := p.KillTsMs[:0]
+	for _, ts := range p.KillTsMs {
+		if ts > cutoff {
+			recent = append(recent, ts)
+		}
+	}
+	p.KillTsMs = recent
+
+	if cfg.MaxKillsPerMinute > 0 && len(p.KillTsMs) >= cfg.MaxKillsPerMinute {
+		fmt.Printf("     (límite de %d detenciones por minuto alcanzado, se omite %s)\n",
+			cfg.MaxKillsPerMinute, c.Name)
+		return false
+	}
+	if p.stopBudget <= 0 {
+		fmt.Printf("     (no se detiene %s: quedarían menos de %d contenedores en ejecución)\n",
+			c.Name, cfg.MinRunningContainers)
+		return false
+	}
+
+	p.stopBudget--
+	p.KillTsMs = append(p.KillTsMs, now.UnixMilli())
+	p.actedThisCycle = true
+	return true
+}
+
+// EndCycle registra la última acción y persiste el estado.
+func (p *orchestratorPolicy) EndCycle(now time.Time) {
+	if p.actedThisCycle {
+		p.LastActionTsMs = now.UnixMilli()
+	}
+	if err := writer.Do(func(db *sql.DB) error {
+		return SaveOrchestratorState(db, policyStateKey, p)
+	}); err != nil {
+		fmt.Println("Error guardando estado del orquestador:", err)
+	}
+}
+
+func CreateOrchestratorStateTable(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS orchestrator_state (
+        key         VARCHAR(64) PRIMARY KEY,
+        value       TEXT NOT NULL,
+        updated_ts_ms BIGINT NOT NULL
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla orchestrator_state: %w", err)
+	}
+	return nil
+}
+
+// SaveOrchestratorState guarda v como JSON bajo la clave indicada.
+func SaveOrchestratorState(db *sql.DB, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error serializando estado %s: %w", key, err)
+	}
+	_, err = db.Exec(`
+        INSERT INTO orchestrator_state (key, value, updated_ts_ms)
+        VALUES (?, ?, ?)
+        ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_ts_ms = excluded.updated_ts_ms;
+    `, key, string(data), time.Now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("error guardando estado %s en orchestrator_state: %w", key, err)
+	}
+	return nil
+}
+
+// LoadOrchestratorState carga el JSON guardado en v. Devuelve false si no había estado.
+func LoadOrchestratorState(db *sql.DB, key string, v interface{}) (bool, error) {
+	var data string
+	err := db.QueryRow(`SELECT value FROM orchestrator_state WHERE key = ?;`, key).Scan(&data)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error leyendo estado %s de orchestrator_state: %w", key, err)
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return false, fmt.Errorf("error parseando estado %s: %w", key, err)
+	}
+	return true, nil
+}
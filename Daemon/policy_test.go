@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyHysteresis(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+
+	sample := func(cpu, ramPct uint64) *SysInfo {
+		return &SysInfo{CPUUsagePct: cpu, TotalRAMKB: 100, RamUsedKB: ramPct}
+	}
+
+	cases := []struct {
+		name    string
+		actCPU  float64
+		stopCPU float64
+		actRAM  float64
+		stopRAM float64
+		samples []*SysInfo
+		want    []bool // Active después de cada muestra
+	}{
+		{
+			name:    "sin histéresis siempre actúa",
+			samples: []*SysInfo{nil, sample(1, 1)},
+			want:    []bool{true, true},
+		},
+		{
+			name:   "arranca inactivo bajo el umbral",
+			actCPU: 80, stopCPU: 50, actRAM: 80, stopRAM: 50,
+			samples: []*SysInfo{nil, sample(10, 10), sample(60, 60)},
+			want:    []bool{false, false, false},
+		},
+		{
+			name:   "activa y desactiva con ambas dimensiones",
+			actCPU: 80, stopCPU: 50, actRAM: 80, stopRAM: 50,
+			samples: []*SysInfo{sample(90, 10), sample(60, 10), sample(40, 60), sample(40, 40)},
+			want:    []bool{true, true, true, false},
+		},
+		{
+			name:   "solo CPU configurada",
+			actCPU: 80, stopCPU: 50,
+			samples: []*SysInfo{sample(90, 99), sample(40, 99), sample(10, 99)},
+			want:    []bool{true, false, false},
+		},
+		{
+			name:   "solo RAM configurada",
+			actRAM: 80, stopRAM: 50,
+			samples: []*SysInfo{sample(99, 90), sample(99, 60), sample(99, 40)},
+			want:    []bool{true, true, false},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg = defaultConfig()
+			cfg.ActAboveCPUPct, cfg.StopBelowCPUPct = tc.actCPU, tc.stopCPU
+			cfg.ActAboveRAMPct, cfg.StopBelowRAMPct = tc.actRAM, tc.stopRAM
+			cfg.ActionCooldownSeconds = 0
+			if err := cfg.validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			p := &orchestratorPolicy{}
+			for i, si := range tc.samples {
+				p.BeginCycle(si, time.Now())
+				if p.Active != tc.want[i] {
+					t.Errorf("muestra %d: Active = %v, se esperaba %v", i, p.Active, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyHysteresisValidate(t *testing.T) {
+	cases := []struct {
+		name            string
+		actCPU, stopCPU float64
+		actRAM, stopRAM float64
+		wantErr         bool
+	}{
+		{name: "desactivada"},
+		{name: "completa", actCPU: 80, stopCPU: 50, actRAM: 90, stopRAM: 70},
+		{name: "solo CPU", actCPU: 80, stopCPU: 50},
+		{name: "act sin stop", actCPU: 80, wantErr: true},
+		{name: "stop sin act", stopRAM: 50, wantErr: true},
+		{name: "stop sobre act", actCPU: 50, stopCPU: 80, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := defaultConfig()
+			c.ActAboveCPUPct, c.StopBelowCPUPct = tc.actCPU, tc.stopCPU
+			c.ActAboveRAMPct, c.StopBelowRAMPct = tc.actRAM, tc.stopRAM
+			if err := c.validate(); (err != nil) != tc.wantErr {
+				t.Errorf("validate() = %v, se esperaba error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
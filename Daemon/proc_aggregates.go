@@ -0,0 +1,232 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os/user"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// UserAggregate son los totales de los procesos de un UID en un snapshot.
+type UserAggregate struct {
+	UID      int
+	UserName string
+	Procs    int
+	RssKB    uint64
+	CPUPct   float64
+}
+
+// CommAggregate son los totales de los procesos con el mismo comm.
+type CommAggregate struct {
+	Comm   string
+	Procs  int
+	RssKB  uint64
+	CPUPct float64
+}
+
+var (
+	userNamesMu sync.Mutex
+	userNames   = make(map[int]string)
+)
+
+// userName resuelve el nombre de un UID (cacheado; "" si no existe en el sistema).
+func userName(uid int) string {
+	userNamesMu.Lock()
+	defer userNamesMu.Unlock()
+	if name, ok := userNames[uid]; ok {
+		return name
+	}
+	name := ""
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		name = u.Username
+	}
+	userNames[uid] = name
+	return name
+}
+
+// uidOrNull guarda NULL para UID desconocido (-1).
+func uidOrNull(uid int) interface{} {
+	if uid < 0 {
+		return nil
+	}
+	return uid
+}
+
+// BuildProcessAggregates agrupa los procesos del snapshot por UID y por comm.
+// cpuPct puede ser nil (primera muestra): el %CPU queda en 0. Los procesos con
+// UID desconocido (-1) solo cuentan en el agregado por comm.
+func BuildProcessAggregates(si SysInfo, cpuPct map[int]float64) ([]UserAggregate, []CommAggregate) {
+	byUID := make(map[int]*UserAggregate)
+	byComm := make(map[string]*CommAggregate)
+
+	for _, p := range si.Procesos {
+		cpu := cpuPct[p.Pid]
+
+		if p.UID >= 0 {
+			u, ok := byUID[p.UID]
+			if !ok {
+				u = &UserAggregate{UID: p.UID, UserName: userName(p.UID)}
+				byUID[p.UID] = u
+			}
+			u.Procs++
+			u.RssKB += p.RssKB
+			u.CPUPct += cpu
+		}
+
+		c, ok := byComm[p.Comm]
+		if !ok {
+			c = &CommAggregate{Comm: p.Comm}
+			byComm[p.Comm] = c
+		}
+		c.Procs++
+		c.RssKB += p.RssKB
+		c.CPUPct += cpu
+	}
+
+	users := make([]UserAggregate, 0, len(byUID))
+	for _, u := range byUID {
+		users = append(users, *u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UID < users[j].UID })
+
+	comms := make([]CommAggregate, 0, len(byComm))
+	for _, c := range byComm {
+		comms = append(comms, *c)
+	}
+	sort.Slice(comms, func(i, j int) bool { return comms[i].Comm < comms[j].Comm })
+
+	return users, comms
+}
+
+func CreateProcessAggregateTables(db *sql.DB) error {
+	users := `
+    CREATE TABLE IF NOT EXISTS process_user_summary (
+        id         INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms      BIGINT NOT NULL,
+        uid        INT NOT NULL,
+        user_name  VARCHAR(64),
+        procs      INT NOT NULL,
+        rss_kb     BIGINT NOT NULL,
+        cpu_pct    REAL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(users); err != nil {
+		return fmt.Errorf("error creando tabla process_user_summary: %w", err)
+	}
+	idx1 := `CREATE INDEX IF NOT EXISTS idx_user_summary_ts ON process_user_summary(ts_ms, uid);`
+	if _, err := db.Exec(idx1); err != nil {
+		return fmt.Errorf("error creando índice idx_user_summary_ts: %w", err)
+	}
+
+	comms := `
+    CREATE TABLE IF NOT EXISTS process_comm_summary (
+        id         INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms      BIGINT NOT NULL,
+        comm       TEXT NOT NULL,
+        procs      INT NOT NULL,
+        rss_kb     BIGINT NOT NULL,
+        cpu_pct    REAL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(comms); err != nil {
+		return fmt.Errorf("error creando tabla process_comm_summary: %w", err)
+	}
+	idx2 := `CREATE INDEX IF NOT EXISTS idx_comm_summary_ts ON process_comm_summary(ts_ms, comm);`
+	if _, err := db.Exec(idx2); err != nil {
+		return fmt.Errorf("error creando índice idx_comm_summary_ts: %w", err)
+	}
+
+	// el dueño también queda en el ciclo de vida de cada proceso
+	return addColumnIfMissing(db, "processes", "uid", "INT")
+}
+
+// InsertProcessAggregates guarda los agregados por usuario y por comm de un
+// snapshot. withCPU indica si hubo muestra previa (si no, cpu_pct va NULL).
+func InsertProcessAggregates(db *sql.DB, tsMs int64, users []UserAggregate, comms []CommAggregate, withCPU bool, tag scenarioTag) error {
+	cpuValue := func(v float64) interface{} {
+		if !withCPU {
+			return nil
+		}
+		return v
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error iniciando transacción para agregados de procesos: %w", err)
+	}
+
+	userStmt, err := tx.Prepare(`
+        INSERT INTO process_user_summary (
+            ts_ms,
+            uid,
+            user_name,
+            procs,
+            rss_kb,
+            cpu_pct,
+            scenario_run_id,
+            scenario_phase
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+    `)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error preparando INSERT en process_user_summary: %w", err)
+	}
+	defer userStmt.Close()
+
+	commStmt, err := tx.Prepare(`
+        INSERT INTO process_comm_summary (
+            ts_ms,
+            comm,
+            procs,
+            rss_kb,
+            cpu_pct,
+            scenario_run_id,
+            scenario_phase
+        ) VALUES (?, ?, ?, ?, ?, ?, ?);
+    `)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error preparando INSERT en process_comm_summary: %w", err)
+	}
+	defer commStmt.Close()
+
+	runID, phase := tag.RunID, tag.Phase
+	for _, u := range users {
+		if _, err := userStmt.Exec(
+			tsMs,
+			u.UID,
+			nullIfEmpty(u.UserName),
+			u.Procs,
+			int64(u.RssKB),
+			cpuValue(u.CPUPct),
+			nullIfEmpty(runID),
+			nullIfEmpty(phase),
+		); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error insertando uid=%d en process_user_summary: %w", u.UID, err)
+		}
+	}
+	for _, c := range comms {
+		if _, err := commStmt.Exec(
+			tsMs,
+			c.Comm,
+			c.Procs,
+			int64(c.RssKB),
+			cpuValue(c.CPUPct),
+			nullIfEmpty(runID),
+			nullIfEmpty(phase),
+		); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error insertando comm=%s en process_comm_summary: %w", c.Comm, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error haciendo commit en agregados de procesos: %w", err)
+	}
+	return nil
+}
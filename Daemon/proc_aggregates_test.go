@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestBuildProcessAggregates(t *testing.T) {
+	// nombres precargados en el caché: el test no depende de /etc/passwd
+	userNamesMu.Lock()
+	userNames[0], userNames[1000] = "root", "alumno"
+	userNamesMu.Unlock()
+	t.Cleanup(func() {
+		userNamesMu.Lock()
+		delete(userNames, 0)
+		delete(userNames, 1000)
+		userNamesMu.Unlock()
+	})
+
+	si := SysInfo{Procesos: []Process{
+		{Pid: 1, UID: 0, Comm: "systemd", RssKB: 100},
+		{Pid: 2, UID: 1000, Comm: "bash", RssKB: 10},
+		{Pid: 3, UID: 1000, Comm: "bash", RssKB: 20},
+		{Pid: 4, UID: 1000, Comm: "stress-ng", RssKB: 300},
+		{Pid: 5, UID: -1, Comm: "bash", RssKB: 5}, // terminó antes de leer /proc
+	}}
+	cases := []struct {
+		name      string
+		cpuPct    map[int]float64
+		wantUsers []UserAggregate
+		wantComms []CommAggregate
+	}{
+		{
+			name:   "con cpu",
+			cpuPct: map[int]float64{1: 1, 2: 2, 3: 3, 4: 50, 5: 4},
+			wantUsers: []UserAggregate{
+				{UID: 0, UserName: "root", Procs: 1, RssKB: 100, CPUPct: 1},
+				{UID: 1000, UserName: "alumno", Procs: 3, RssKB: 330, CPUPct: 55},
+			},
+			wantComms: []CommAggregate{
+				{Comm: "bash", Procs: 3, RssKB: 35, CPUPct: 9},
+				{Comm: "stress-ng", Procs: 1, RssKB: 300, CPUPct: 50},
+				{Comm: "systemd", Procs: 1, RssKB: 100, CPUPct: 1},
+			},
+		},
+		{
+			name: "primera muestra sin cpu",
+			wantUsers: []UserAggregate{
+				{UID: 0, UserName: "root", Procs: 1, RssKB: 100},
+				{UID: 1000, UserName: "alumno", Procs: 3, RssKB: 330},
+			},
+			wantComms: []CommAggregate{
+				{Comm: "bash", Procs: 3, RssKB: 35},
+				{Comm: "stress-ng", Procs: 1, RssKB: 300},
+				{Comm: "systemd", Procs: 1, RssKB: 100},
+			},
+		},
+	}
+	for _, tc := range cases {
+		users, comms := BuildProcessAggregates(si, tc.cpuPct)
+		if !reflect.DeepEqual(users, tc.wantUsers) {
+			t.Errorf("%s: usuarios = %+v, se esperaba %+v", tc.name, users, tc.wantUsers)
+		}
+		if !reflect.DeepEqual(comms, tc.wantComms) {
+			t.Errorf("%s: comms = %+v, se esperaba %+v", tc.name, comms, tc.wantComms)
+		}
+	}
+}
+
+// Sin muestra previa el %CPU de los agregados va NULL, no 0.
+func TestInsertProcessAggregatesWithoutCPU(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE processes (pid INT, start_time_ns BIGINT)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateProcessAggregateTables(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"process_user_summary", "process_comm_summary"} {
+		for _, col := range []string{"scenario_run_id", "scenario_phase"} {
+			if err := addColumnIfMissing(db, table, col, "VARCHAR(128)"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	users := []UserAggregate{{UID: 1000, Procs: 1, RssKB: 10, CPUPct: 5}}
+	comms := []CommAggregate{{Comm: "bash", Procs: 1, RssKB: 10, CPUPct: 5}}
+	for _, withCPU := range []bool{false, true} {
+		tsMs := int64(1000)
+		if withCPU {
+			tsMs = 2000
+		}
+		if err := InsertProcessAggregates(db, tsMs, users, comms, withCPU, scenarioTag{}); err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range []string{"process_user_summary", "process_comm_summary"} {
+			var cpu sql.NullFloat64
+			if err := db.QueryRow(`SELECT cpu_pct FROM `+table+` WHERE ts_ms = ?`, tsMs).Scan(&cpu); err != nil {
+				t.Fatal(err)
+			}
+			if cpu.Valid != withCPU || (withCPU && cpu.Float64 != 5) {
+				t.Errorf("%s con cpu=%v: cpu_pct = %+v", table, withCPU, cpu)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ProcessChurn resume altas y bajas de procesos entre dos snapshots de sysinfo.
+type ProcessChurn struct {
+	TsMs       int64
+	IntervalMs int64
+	Alive      int
+	Spawned    int
+	Exited     int
+}
+
+// BuildProcessChurn compara los procesos por (pid, start_time); un PID
+// reutilizado cuenta como una baja y un alta.
+func BuildProcessChurn(prev, curr SysInfo) ProcessChurn {
+	churn := ProcessChurn{
+		TsMs:  int64(curr.TsMs),
+		Alive: len(curr.Procesos),
+	}
+	if ns, ok := snapshotIntervalNs(prev, curr); ok {
+		churn.IntervalMs = int64(ns / 1e6)
+	}
+
+	prevKeys := make(map[procKey]bool, len(prev.Procesos))
+	for _, p := range prev.Procesos {
+		prevKeys[p.key()] = true
+	}
+	currKeys := make(map[procKey]bool, len(curr.Procesos))
+	for _, p := range curr.Procesos {
+		currKeys[p.key()] = true
+		if !prevKeys[p.key()] {
+			churn.Spawned++
+		}
+	}
+	for k := range prevKeys {
+		if !currKeys[k] {
+			churn.Exited++
+		}
+	}
+	return churn
+}
+
+// perMinute convierte una cantidad en el intervalo a tasa por minuto.
+func perMinute(n int, intervalMs int64) interface{} {
+	if intervalMs <= 0 {
+		return nil
+	}
+	return float64(n) * 60000.0 / float64(intervalMs)
+}
+
+func CreateProcessesTables(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS processes (
+        pid              INT NOT NULL,
+        start_time_ns    BIGINT NOT NULL,
+        comm             TEXT,
+        first_seen_ts_ms BIGINT NOT NULL,
+        last_seen_ts_ms  BIGINT NOT NULL,
+        exited_ts_ms     BIGINT,
+        peak_rss_kb      BIGINT,
+        total_cpu_ns     BIGINT,
+        PRIMARY KEY (pid, start_time_ns)
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla processes: %w", err)
+	}
+
+	idx1 := `CREATE INDEX IF NOT EXISTS idx_processes_first_seen ON processes(first_seen_ts_ms);`
+	idx2 := `CREATE INDEX IF NOT EXISTS idx_processes_exited ON processes(exited_ts_ms);`
+	if _, err := db.Exec(idx1); err != nil {
+		return fmt.Errorf("error creando índice idx_processes_first_seen: %w", err)
+	}
+	if _, err := db.Exec(idx2); err != nil {
+		return fmt.Errorf("error creando índice idx_processes_exited: %w", err)
+	}
+
+	churn := `
+    CREATE TABLE IF NOT EXISTS process_churn (
+        id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms              BIGINT NOT NULL,
+        interval_ms        BIGINT,
+        alive              INT NOT NULL,
+        spawned            INT NOT NULL,
+        exited             INT NOT NULL,
+        spawn_rate_per_min REAL,
+        exit_rate_per_min  REAL,
+        created_at         TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(churn); err != nil {
+		return fmt.Errorf("error creando tabla process_churn: %w", err)
+	}
+	idx3 := `CREATE INDEX IF NOT EXISTS idx_process_churn_ts ON process_churn(ts_ms);`
+	if _, err := db.Exec(idx3); err != nil {
+		return fmt.Errorf("error creando índice idx_process_churn_ts: %w", err)
+	}
+
+	// process_metrics también guarda el start_time para unir con processes
+	return addColumnIfMissing(db, "process_metrics", "start_time_ns", "BIGINT")
+}
+
+// UpsertProcessesFromSnapshot actualiza el ciclo de vida de los procesos:
+// alta la primera vez que se ven, last_seen/pico RSS/CPU total en cada snapshot,
+// y exited_ts_ms para los que estaban vivos y ya no aparecen.
+func UpsertProcessesFromSnapshot(db *sql.DB, si SysInfo) error {
+	tsMs := int64(si.TsMs)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error iniciando transacción para processes: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+        INSERT INTO processes (
+            pid,
+            start_time_ns,
+            ppid,
+            uid,
+            comm,
+            first_seen_ts_ms,
+            last_seen_ts_ms,
+            peak_rss_kb,
+            total_cpu_ns
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(pid, start_time_ns) DO UPDATE SET
+            ppid            = excluded.ppid,
+            uid             = COALESCE(excluded.uid, processes.uid),
+            comm            = excluded.comm,
+            last_seen_ts_ms = excluded.last_seen_ts_ms,
+            exited_ts_ms    = NULL,
+            peak_rss_kb     = MAX(COALESCE(processes.peak_rss_kb, 0), excluded.peak_rss_kb),
+            total_cpu_ns    = excluded.total_cpu_ns;
+    `)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error preparando UPSERT en processes: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, p := range si.Procesos {
+		if _, err := stmt.Exec(
+			p.Pid,
+			int64(p.StartTimeNs),
+			p.PPid,
+			uidOrNull(p.UID),
+			p.Comm,
+			tsMs,
+			tsMs,
+			int64(p.RssKB),
+			int64(cpuTimeNs(si, p)),
+		); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error actualizando proceso PID=%d en processes: %w", p.Pid, err)
+		}
+	}
+
+	// los vivos que no se actualizaron en este snapshot terminaron
+	if _, err := tx.Exec(`
+        UPDATE processes SET exited_ts_ms = ?
+        WHERE exited_ts_ms IS NULL AND last_seen_ts_ms < ?;
+    `, tsMs, tsMs); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error marcando procesos terminados: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error haciendo commit en processes: %w", err)
+	}
+	return nil
+}
+
+func InsertProcessChurn(db *sql.DB, churn ProcessChurn) error {
+	_, err := db.Exec(`
+        INSERT INTO process_churn (
+            ts_ms,
+            interval_ms,
+            alive,
+            spawned,
+            exited,
+            spawn_rate_per_min,
+            exit_rate_per_min
+        ) VALUES (?, ?, ?, ?, ?, ?, ?);
+    `,
+		churn.TsMs,
+		nullIfZero(churn.IntervalMs),
+		churn.Alive,
+		churn.Spawned,
+		churn.Exited,
+		perMinute(churn.Spawned, churn.IntervalMs),
+		perMinute(churn.Exited, churn.IntervalMs),
+	)
+	if err != nil {
+		return fmt.Errorf("error insertando en process_churn: %w", err)
+	}
+	return nil
+}
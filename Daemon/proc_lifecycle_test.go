@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestBuildProcessChurn(t *testing.T) {
+	proc := func(pid int, startNs uint64) Process { return Process{Pid: pid, StartTimeNs: startNs} }
+	cases := []struct {
+		name string
+		prev SysInfo
+		curr SysInfo
+		want ProcessChurn
+	}{
+		{
+			name: "sin cambios",
+			prev: SysInfo{TsMs: 1000, Procesos: []Process{proc(1, 10), proc(2, 20)}},
+			curr: SysInfo{TsMs: 3000, Procesos: []Process{proc(1, 10), proc(2, 20)}},
+			want: ProcessChurn{TsMs: 3000, IntervalMs: 2000, Alive: 2},
+		},
+		{
+			name: "altas y bajas",
+			prev: SysInfo{TsMs: 1000, Procesos: []Process{proc(1, 10), proc(2, 20)}},
+			curr: SysInfo{TsMs: 3000, Procesos: []Process{proc(1, 10), proc(3, 30), proc(4, 40)}},
+			want: ProcessChurn{TsMs: 3000, IntervalMs: 2000, Alive: 3, Spawned: 2, Exited: 1},
+		},
+		{
+			name: "PID reutilizado",
+			prev: SysInfo{TsMs: 1000, Procesos: []Process{proc(5, 10)}},
+			curr: SysInfo{TsMs: 3000, Procesos: []Process{proc(5, 99)}},
+			want: ProcessChurn{TsMs: 3000, IntervalMs: 2000, Alive: 1, Spawned: 1, Exited: 1},
+		},
+		{
+			name: "reloj hacia atrás: sin intervalo",
+			prev: SysInfo{TsMs: 3000},
+			curr: SysInfo{TsMs: 1000, Procesos: []Process{proc(1, 10)}},
+			want: ProcessChurn{TsMs: 1000, Alive: 1, Spawned: 1},
+		},
+	}
+	for _, tc := range cases {
+		if got := BuildProcessChurn(tc.prev, tc.curr); got != tc.want {
+			t.Errorf("%s: churn = %+v, se esperaba %+v", tc.name, got, tc.want)
+		}
+	}
+	if perMinute(3, 0) != nil || perMinute(3, 30000) != 6.0 {
+		t.Errorf("perMinute = %v, %v", perMinute(3, 0), perMinute(3, 30000))
+	}
+}
+
+// El ciclo de vida marca los procesos que desaparecen, conserva el pico de
+// RSS y trata un PID reutilizado como un proceso distinto.
+func TestUpsertProcessesFromSnapshot(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE process_metrics (id INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateProcessesTables(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, col := range []string{"ppid", "uid"} {
+		if err := addColumnIfMissing(db, "processes", col, "INT"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snaps := []SysInfo{
+		{TsMs: 1000, CPUTimeUnit: "ns", Procesos: []Process{
+			{Pid: 10, StartTimeNs: 1, Comm: "a", RssKB: 500, UID: 1000},
+			{Pid: 20, StartTimeNs: 2, Comm: "b", RssKB: 100, UID: -1},
+		}},
+		{TsMs: 2000, CPUTimeUnit: "ns", Procesos: []Process{
+			{Pid: 10, StartTimeNs: 1, Comm: "a", RssKB: 200, Utime: 5e6, UID: 1000},
+			{Pid: 20, StartTimeNs: 3, Comm: "b2", RssKB: 50, UID: 0}, // PID reutilizado
+		}},
+		{TsMs: 3000, CPUTimeUnit: "ns", Procesos: []Process{
+			{Pid: 20, StartTimeNs: 3, Comm: "b2", RssKB: 60, UID: 0},
+		}},
+	}
+	for _, si := range snaps {
+		if err := UpsertProcessesFromSnapshot(db, si); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		pid         int
+		startNs     int64
+		firstSeen   int64
+		lastSeen    int64
+		exited      sql.NullInt64
+		peakRSS     int64
+		totalCPU    int64
+		uid         sql.NullInt64
+		description string
+	}{
+		{10, 1, 1000, 2000, sql.NullInt64{Int64: 3000, Valid: true}, 500, 5e6, sql.NullInt64{Int64: 1000, Valid: true}, "terminó en el tercer snapshot"},
+		{20, 2, 1000, 1000, sql.NullInt64{Int64: 2000, Valid: true}, 100, 0, sql.NullInt64{}, "reemplazado por otro con el mismo PID"},
+		{20, 3, 2000, 3000, sql.NullInt64{}, 60, 0, sql.NullInt64{Int64: 0, Valid: true}, "sigue vivo"},
+	}
+	for _, tc := range cases {
+		var firstSeen, lastSeen, peakRSS, totalCPU int64
+		var exited, uid sql.NullInt64
+		if err := db.QueryRow(`SELECT first_seen_ts_ms, last_seen_ts_ms, exited_ts_ms, peak_rss_kb, total_cpu_ns, uid
+			FROM processes WHERE pid = ? AND start_time_ns = ?`, tc.pid, tc.startNs).
+			Scan(&firstSeen, &lastSeen, &exited, &peakRSS, &totalCPU, &uid); err != nil {
+			t.Fatalf("PID %d/%d: %v", tc.pid, tc.startNs, err)
+		}
+		if firstSeen != tc.firstSeen || lastSeen != tc.lastSeen || exited != tc.exited ||
+			peakRSS != tc.peakRSS || totalCPU != tc.totalCPU || uid != tc.uid {
+			t.Errorf("PID %d/%d (%s): first=%d last=%d exited=%v peak=%d cpu=%d uid=%v",
+				tc.pid, tc.startNs, tc.description, firstSeen, lastSeen, exited, peakRSS, totalCPU, uid)
+		}
+	}
+}
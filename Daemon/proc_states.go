@@ -0,0 +1,252 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// Tipos y acciones de eventos de estado de procesos
+const (
+	procEventHungTask = "hung_task" // en D (espera no interrumpible) N snapshots seguidos
+	procEventZombie   = "zombie"    // en Z sin que el padre lo recoja
+
+	procEventRaised   = "raised"
+	procEventResolved = "resolved"
+)
+
+// ProcessStateEvent es una alerta de un proceso colgado o zombie (o su resolución).
+type ProcessStateEvent struct {
+	TsMs        int64  `json:"ts_ms"`
+	Kind        string `json:"kind"`
+	Action      string `json:"action"`
+	Pid         int    `json:"pid"`
+	StartTimeNs uint64 `json:"start_time_ns"`
+	Comm        string `json:"comm"`
+	UID         int    `json:"uid"`
+	PPid        int    `json:"ppid"`
+	ParentComm  string `json:"parent_comm,omitempty"`
+	Snapshots   int    `json:"snapshots"`
+	SinceTsMs   int64  `json:"since_ts_ms"`
+}
+
+// stateStreak cuenta los snapshots seguidos de un proceso en el mismo estado.
+type stateStreak struct {
+	kind      string
+	count     int
+	sinceTsMs int64
+	raised    bool
+	last      Process
+}
+
+// stateDetector sigue los procesos en D y Z entre snapshots. Solo lo usa el
+// colector de sysinfo, por eso no lleva mutex.
+type stateDetector struct {
+	streaks map[procKey]*stateStreak
+}
+
+func newStateDetector() *stateDetector {
+	return &stateDetector{streaks: make(map[procKey]*stateStreak)}
+}
+
+func stateKind(state string) string {
+	if state == "" {
+		return ""
+	}
+	switch state[0] {
+	case 'D':
+		return procEventHungTask
+	case 'Z':
+		return procEventZombie
+	}
+	return ""
+}
+
+// stateThreshold es la cantidad de snapshots seguidos para alertar (0 = desactivado).
+func stateThreshold(kind string) int {
+	if kind == procEventZombie {
+		return cfg.ZombieSnapshots
+	}
+	return cfg.HungTaskSnapshots
+}
+
+// Observe procesa un snapshot y devuelve los eventos nuevos: raised cuando un
+// proceso llega al umbral y resolved cuando uno alertado sale del estado o termina.
+func (d *stateDetector) Observe(si SysInfo) []ProcessStateEvent {
+	tsMs := int64(si.TsMs)
+	byPid := make(map[int]Process, len(si.Procesos))
+	for _, p := range si.Procesos {
+		byPid[p.Pid] = p
+	}
+
+	var events []ProcessStateEvent
+	seen := make(map[procKey]bool)
+	for _, p := range si.Procesos {
+		kind := stateKind(p.State)
+		if kind == "" || stateThreshold(kind) <= 0 {
+			continue
+		}
+		key := p.key()
+		seen[key] = true
+
+		st, ok := d.streaks[key]
+		if !ok || st.kind != kind {
+			if ok && st.raised {
+				events = append(events, d.event(st, procEventResolved, tsMs, byPid))
+			}
+			st = &stateStreak{kind: kind, sinceTsMs: tsMs}
+			d.streaks[key] = st
+		}
+		st.count++
+		st.last = p
+		if !st.raised && st.count >= stateThreshold(kind) {
+			st.raised = true
+			events = append(events, d.event(st, procEventRaised, tsMs, byPid))
+		}
+	}
+
+	for key, st := range d.streaks {
+		if seen[key] {
+			continue
+		}
+		if st.raised {
+			events = append(events, d.event(st, procEventResolved, tsMs, byPid))
+		}
+		delete(d.streaks, key)
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Pid < events[j].Pid })
+	return events
+}
+
+// event arma el evento; en los zombies el padre es el responsable de no
+// haber hecho wait(), así que se informa su comm.
+func (d *stateDetector) event(st *stateStreak, action string, tsMs int64, byPid map[int]Process) ProcessStateEvent {
+	ev := ProcessStateEvent{
+		TsMs:        tsMs,
+		Kind:        st.kind,
+		Action:      action,
+		Pid:         st.last.Pid,
+		StartTimeNs: st.last.StartTimeNs,
+		Comm:        st.last.Comm,
+		UID:         st.last.UID,
+		PPid:        st.last.PPid,
+		Snapshots:   st.count,
+		SinceTsMs:   st.sinceTsMs,
+	}
+	if parent, ok := byPid[st.last.PPid]; ok {
+		ev.ParentComm = parent.Comm
+	}
+	return ev
+}
+
+// reportStateEvents imprime las alertas del ciclo.
+func reportStateEvents(events []ProcessStateEvent) {
+	for _, ev := range events {
+		switch {
+		case ev.Action == procEventResolved:
+			logger.Info("proceso recuperado", "tipo", ev.Kind, "pid", ev.Pid, "comm", ev.Comm,
+				"snapshots", ev.Snapshots)
+		case ev.Kind == procEventZombie:
+			logger.Warn("proceso zombie persistente", "pid", ev.Pid, "comm", ev.Comm,
+				"ppid", ev.PPid, "padre", ev.ParentComm, "snapshots", ev.Snapshots)
+		default:
+			logger.Warn("proceso colgado en estado D", "pid", ev.Pid, "comm", ev.Comm,
+				"uid", ev.UID, "snapshots", ev.Snapshots)
+		}
+	}
+}
+
+func CreateProcessStateEventsTable(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS process_state_events (
+        id            INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms         BIGINT NOT NULL,
+        kind          VARCHAR(16) NOT NULL,
+        action        VARCHAR(16) NOT NULL,
+        pid           INT NOT NULL,
+        start_time_ns BIGINT,
+        comm          TEXT,
+        uid           INT,
+        ppid          INT,
+        parent_comm   TEXT,
+        snapshots     INT NOT NULL,
+        since_ts_ms   BIGINT NOT NULL,
+        created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla process_state_events: %w", err)
+	}
+
+	idx := `CREATE INDEX IF NOT EXISTS idx_process_state_events_ts ON process_state_events(ts_ms);`
+	if _, err := db.Exec(idx); err != nil {
+		return fmt.Errorf("error creando índice idx_process_state_events_ts: %w", err)
+	}
+	return nil
+}
+
+func InsertProcessStateEvents(db *sql.DB, events []ProcessStateEvent) error {
+	for _, ev := range events {
+		_, err := db.Exec(`
+            INSERT INTO process_state_events (
+                ts_ms,
+                kind,
+                action,
+                pid,
+                start_time_ns,
+                comm,
+                uid,
+                ppid,
+                parent_comm,
+                snapshots,
+                since_ts_ms
+            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+        `,
+			ev.TsMs,
+			ev.Kind,
+			ev.Action,
+			ev.Pid,
+			nullIfZero(int64(ev.StartTimeNs)),
+			ev.Comm,
+			uidOrNull(ev.UID),
+			ev.PPid,
+			nullIfEmpty(ev.ParentComm),
+			ev.Snapshots,
+			ev.SinceTsMs,
+		)
+		if err != nil {
+			return fmt.Errorf("error insertando evento %s PID=%d en process_state_events: %w", ev.Kind, ev.Pid, err)
+		}
+	}
+	return nil
+}
+
+// QueryProcessStateEvents devuelve los últimos eventos (kind "" = todos).
+func QueryProcessStateEvents(db *sql.DB, kind string, limit int) ([]ProcessStateEvent, error) {
+	rows, err := db.Query(`
+        SELECT ts_ms, kind, action, pid, COALESCE(start_time_ns, 0), COALESCE(comm, ''),
+               COALESCE(uid, -1), COALESCE(ppid, 0), COALESCE(parent_comm, ''), snapshots, since_ts_ms
+        FROM process_state_events
+        WHERE ? = '' OR kind = ?
+        ORDER BY ts_ms DESC, id DESC
+        LIMIT ?;
+    `, kind, kind, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando process_state_events: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ProcessStateEvent
+	for rows.Next() {
+		var ev ProcessStateEvent
+		var start int64
+		if err := rows.Scan(&ev.TsMs, &ev.Kind, &ev.Action, &ev.Pid, &start, &ev.Comm,
+			&ev.UID, &ev.PPid, &ev.ParentComm, &ev.Snapshots, &ev.SinceTsMs); err != nil {
+			return nil, fmt.Errorf("error leyendo process_state_events: %w", err)
+		}
+		ev.StartTimeNs = uint64(start)
+		result = append(result, ev)
+	}
+	return result, rows.Err()
+}
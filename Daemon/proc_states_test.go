@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStateDetectorObserve(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.HungTaskSnapshots = 3
+	cfg.ZombieSnapshots = 2
+
+	proc := func(pid int, startNs uint64, state string) Process {
+		return Process{Pid: pid, PPid: 1, StartTimeNs: startNs, Comm: fmt.Sprintf("p%d", pid), State: state}
+	}
+	parent := Process{Pid: 1, Comm: "padre", State: "S"}
+
+	// cada paso es un snapshot; want son los eventos "kind/action/pid/snapshots"
+	steps := []struct {
+		procs []Process
+		want  []string
+	}{
+		{[]Process{parent, proc(10, 1, "D"), proc(20, 2, "Z")}, nil},
+		{[]Process{parent, proc(10, 1, "D"), proc(20, 2, "Z")}, []string{"zombie/raised/20/2"}},
+		// 10 llega al umbral; el zombie alertado no se repite
+		{[]Process{parent, proc(10, 1, "D+"), proc(20, 2, "Z")}, []string{"hung_task/raised/10/3"}},
+		// 10 sale de D y el zombie es recogido por el padre
+		{[]Process{parent, proc(10, 1, "S")}, []string{"hung_task/resolved/10/3", "zombie/resolved/20/3"}},
+		// PID reutilizado: la racha empieza de cero
+		{[]Process{parent, proc(10, 9, "D")}, nil},
+		{[]Process{parent, proc(10, 9, "D")}, nil},
+		// pasa de D a Z antes del umbral: la racha se reinicia como zombie
+		{[]Process{parent, proc(10, 9, "Z")}, nil},
+		{[]Process{parent, proc(10, 9, "Z")}, []string{"zombie/raised/10/2"}},
+	}
+
+	d := newStateDetector()
+	for i, step := range steps {
+		events := d.Observe(SysInfo{TsMs: uint64(1000 * (i + 1)), Procesos: step.procs})
+		var got []string
+		for _, ev := range events {
+			got = append(got, fmt.Sprintf("%s/%s/%d/%d", ev.Kind, ev.Action, ev.Pid, ev.Snapshots))
+			if ev.Kind == procEventZombie && ev.Action == procEventRaised && ev.ParentComm != "padre" {
+				t.Errorf("paso %d: zombie sin comm del padre: %+v", i, ev)
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(step.want, " ") {
+			t.Errorf("paso %d: eventos = %q, se esperaba %q", i, got, step.want)
+		}
+	}
+}
+
+// Con el umbral en 0 el tipo queda desactivado.
+func TestStateDetectorDisabled(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.HungTaskSnapshots = 0
+	cfg.ZombieSnapshots = 1
+
+	d := newStateDetector()
+	events := d.Observe(SysInfo{TsMs: 1000, Procesos: []Process{
+		{Pid: 10, State: "D"},
+		{Pid: 20, State: "Z"},
+	}})
+	if len(events) != 1 || events[0].Kind != procEventZombie || events[0].SinceTsMs != 1000 {
+		t.Errorf("eventos = %+v, se esperaba solo el zombie", events)
+	}
+	if len(d.streaks) != 1 {
+		t.Errorf("rachas = %d, se esperaba 1", len(d.streaks))
+	}
+}
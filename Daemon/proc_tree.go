@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProcNode es un proceso dentro del árbol con los totales de su subárbol
+// (él mismo más todos sus descendientes).
+type ProcNode struct {
+	Pid           int         `json:"pid"`
+	PPid          int         `json:"ppid"`
+	Comm          string      `json:"comm"`
+	State         string      `json:"state"`
+	RssKB         uint64      `json:"rss_kb"`
+	CPUPct        float64     `json:"cpu_pct"`
+	SubtreeRssKB  uint64      `json:"subtree_rss_kb"`
+	SubtreeCPUPct float64     `json:"subtree_cpu_pct"`
+	SubtreeProcs  int         `json:"subtree_procs"`
+	Children      []*ProcNode `json:"children,omitempty"`
+}
+
+// ProcTree es el árbol de un snapshot: raíces y acceso directo por PID.
+type ProcTree struct {
+	Roots []*ProcNode
+	ByPid map[int]*ProcNode
+}
+
+// BuildProcessTree arma el árbol por ppid. Es raíz todo proceso cuyo padre
+// no está en el snapshot (p.ej. init/kthreadd con ppid 0). cpuPct puede ser nil.
+func BuildProcessTree(si SysInfo, cpuPct map[int]float64) ProcTree {
+	tree := ProcTree{ByPid: make(map[int]*ProcNode, len(si.Procesos))}
+	for _, p := range si.Procesos {
+		tree.ByPid[p.Pid] = &ProcNode{
+			Pid:    p.Pid,
+			PPid:   p.PPid,
+			Comm:   p.Comm,
+			State:  p.State,
+			RssKB:  p.RssKB,
+			CPUPct: cpuPct[p.Pid],
+		}
+	}
+
+	attached := make(map[int]bool, len(tree.ByPid))
+	for _, p := range si.Procesos {
+		node := tree.ByPid[p.Pid]
+		parent, ok := tree.ByPid[p.PPid]
+		if !ok || p.PPid == p.Pid {
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+		attached[p.Pid] = true
+	}
+	for _, p := range si.Procesos {
+		if !attached[p.Pid] {
+			tree.Roots = append(tree.Roots, tree.ByPid[p.Pid])
+		}
+	}
+
+	visited := make(map[int]bool, len(tree.ByPid))
+	for _, root := range tree.Roots {
+		rollupSubtree(root, visited)
+	}
+	// un ciclo de ppid (snapshot inconsistente) deja nodos sin visitar:
+	// se cortan y pasan a ser raíces
+	for _, p := range si.Procesos {
+		if visited[p.Pid] {
+			continue
+		}
+		node := tree.ByPid[p.Pid]
+		if parent, ok := tree.ByPid[node.PPid]; ok {
+			parent.Children = removeChild(parent.Children, node)
+		}
+		tree.Roots = append(tree.Roots, node)
+		rollupSubtree(node, visited)
+	}
+
+	sortByPid(tree.Roots)
+	return tree
+}
+
+func rollupSubtree(n *ProcNode, visited map[int]bool) {
+	visited[n.Pid] = true
+	n.SubtreeRssKB = n.RssKB
+	n.SubtreeCPUPct = n.CPUPct
+	n.SubtreeProcs = 1
+	sortByPid(n.Children)
+	for _, c := range n.Children {
+		if visited[c.Pid] {
+			continue
+		}
+		rollupSubtree(c, visited)
+		n.SubtreeRssKB += c.SubtreeRssKB
+		n.SubtreeCPUPct += c.SubtreeCPUPct
+		n.SubtreeProcs += c.SubtreeProcs
+	}
+}
+
+func removeChild(children []*ProcNode, node *ProcNode) []*ProcNode {
+	for i, c := range children {
+		if c == node {
+			return append(children[:i], children[i+1:]...)
+		}
+	}
+	return children
+}
+
+func sortByPid(nodes []*ProcNode) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Pid < nodes[j].Pid })
+}
+
+// MigrateProcessTreeColumns agrega la relación padre/hijo y los totales del
+// subárbol a las tablas de procesos existentes.
+func MigrateProcessTreeColumns(db *sql.DB) error {
+	if err := addColumnIfMissing(db, "processes", "ppid", "INT"); err != nil {
+		return err
+	}
+	for _, col := range []struct{ name, typ string }{
+		{"ppid", "INT"},
+		{"subtree_rss_kb", "BIGINT"},
+		{"subtree_cpu_pct", "REAL"},
+	} {
+		if err := addColumnIfMissing(db, "process_metrics", col.name, col.typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPs implementa `daemon ps [--tree]`: lee dos snapshots de sysinfo para
+// calcular %CPU y muestra la lista de procesos o el árbol con totales.
+func runPs(args []string) int {
+	fs := flag.NewFlagSet("ps", flag.ContinueOnError)
+	asTree := fs.Bool("tree", false, "mostrar árbol de procesos con totales por subárbol")
+	rootPid := fs.Int("root", 0, "mostrar solo el subárbol de este PID (con --tree)")
+	wait := fs.Duration("interval", time.Second, "tiempo entre las dos lecturas para calcular %CPU")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	prev, err := readSysinfoForPs()
+	if err != nil {
+		fmt.Println("Error leyendo sysinfo:", err)
+		return 1
+	}
+	time.Sleep(*wait)
+	curr, err := readSysinfoForPs()
+	if err != nil {
+		fmt.Println("Error leyendo sysinfo:", err)
+		return 1
+	}
+	tree := BuildProcessTree(curr, BuildProcCpuPct(prev, curr, runtime.NumCPU()))
+
+	if !*asTree {
+		printProcList(tree)
+		return 0
+	}
+	roots := tree.Roots
+	if *rootPid != 0 {
+		node, ok := tree.ByPid[*rootPid]
+		if !ok {
+			fmt.Printf("PID %d no está en el snapshot\n", *rootPid)
+			return 1
+		}
+		roots = []*ProcNode{node}
+	}
+	fmt.Printf("%-40s %8s %10s %7s %12s %8s %6s\n",
+		"PROCESO", "PID", "RSS_KB", "CPU%", "SUB_RSS_KB", "SUB_CPU%", "PROCS")
+	for _, r := range roots {
+		printProcNode(r, 0)
+	}
+	return 0
+}
+
+func readSysinfoForPs() (SysInfo, error) {
+	si, err := ReadSysinfo(sysinfoPath)
+	if err != nil {
+		return si, err
+	}
+	if si.SchemaVersion < 4 {
+		fillFromProcStat(&si)
+	}
+	return si, nil
+}
+
+func printProcList(tree ProcTree) {
+	nodes := make([]*ProcNode, 0, len(tree.ByPid))
+	for _, n := range tree.ByPid {
+		nodes = append(nodes, n)
+	}
+	sortByPid(nodes)
+	fmt.Printf("%8s %8s %-20s %-5s %10s %7s\n", "PID", "PPID", "COMM", "STATE", "RSS_KB", "CPU%")
+	for _, n := range nodes {
+		fmt.Printf("%8d %8d %-20s %-5s %10d %7.2f\n", n.Pid, n.PPid, n.Comm, n.State, n.RssKB, n.CPUPct)
+	}
+}
+
+func printProcNode(n *ProcNode, depth int) {
+	label := strings.Repeat("  ", depth) + n.Comm
+	if len(label) > 40 {
+		label = label[:40]
+	}
+	fmt.Printf("%-40s %8d %10d %7.2f %12d %8.2f %6d\n",
+		label, n.Pid, n.RssKB, n.CPUPct, n.SubtreeRssKB, n.SubtreeCPUPct, n.SubtreeProcs)
+	for _, c := range n.Children {
+		printProcNode(c, depth+1)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildProcessTree(t *testing.T) {
+	proc := func(pid, ppid int, rss uint64) Process { return Process{Pid: pid, PPid: ppid, RssKB: rss} }
+	cases := []struct {
+		name      string
+		procs     []Process
+		cpuPct    map[int]float64
+		wantRoots []int
+		// pid -> {subtree_rss_kb, subtree_procs}
+		wantSubtree map[int][2]uint64
+		wantCPU     map[int]float64
+	}{
+		{
+			name:        "árbol simple",
+			procs:       []Process{proc(1, 0, 10), proc(2, 1, 20), proc(3, 2, 30), proc(4, 1, 40)},
+			cpuPct:      map[int]float64{2: 5, 3: 10},
+			wantRoots:   []int{1},
+			wantSubtree: map[int][2]uint64{1: {100, 4}, 2: {50, 2}, 3: {30, 1}, 4: {40, 1}},
+			wantCPU:     map[int]float64{1: 15, 2: 15, 4: 0},
+		},
+		{
+			name:        "padre fuera del snapshot y kthreadd",
+			procs:       []Process{proc(1, 0, 10), proc(2, 0, 0), proc(50, 999, 5), proc(51, 2, 1)},
+			wantRoots:   []int{1, 2, 50},
+			wantSubtree: map[int][2]uint64{1: {10, 1}, 2: {1, 2}, 50: {5, 1}},
+		},
+		{
+			name:        "sin cpu previa",
+			procs:       []Process{proc(1, 0, 10), proc(2, 1, 20)},
+			wantRoots:   []int{1},
+			wantSubtree: map[int][2]uint64{1: {30, 2}},
+			wantCPU:     map[int]float64{1: 0},
+		},
+		{
+			name:        "ciclo de ppid inconsistente",
+			procs:       []Process{proc(1, 0, 10), proc(7, 8, 1), proc(8, 7, 2)},
+			wantRoots:   []int{1, 7},
+			wantSubtree: map[int][2]uint64{1: {10, 1}, 7: {3, 2}, 8: {2, 1}},
+		},
+		{
+			name:        "proceso que es su propio padre",
+			procs:       []Process{proc(5, 5, 10)},
+			wantRoots:   []int{5},
+			wantSubtree: map[int][2]uint64{5: {10, 1}},
+		},
+	}
+	for _, tc := range cases {
+		tree := BuildProcessTree(SysInfo{Procesos: tc.procs}, tc.cpuPct)
+		var roots []int
+		for _, r := range tree.Roots {
+			roots = append(roots, r.Pid)
+		}
+		if !reflect.DeepEqual(roots, tc.wantRoots) {
+			t.Errorf("%s: raíces = %v, se esperaba %v", tc.name, roots, tc.wantRoots)
+		}
+		for pid, want := range tc.wantSubtree {
+			n := tree.ByPid[pid]
+			if n.SubtreeRssKB != want[0] || uint64(n.SubtreeProcs) != want[1] {
+				t.Errorf("%s: PID %d subárbol = %d KB / %d procesos, se esperaba %d / %d",
+					tc.name, pid, n.SubtreeRssKB, n.SubtreeProcs, want[0], want[1])
+			}
+		}
+		for pid, want := range tc.wantCPU {
+			if got := tree.ByPid[pid].SubtreeCPUPct; got != want {
+				t.Errorf("%s: PID %d subtree_cpu_pct = %v, se esperaba %v", tc.name, pid, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// procKey identifica a un proceso entre snapshots: el PID solo no alcanza
+// porque el kernel lo reutiliza. StartTimeNs es el inicio desde el arranque.
+type procKey struct {
+	Pid         int
+	StartTimeNs uint64
+}
+
+// Raíz de /proc (variable para poder apuntarla a un árbol de prueba)
+var procRoot = "/proc"
+
+// AT_CLKTCK en el vector auxiliar del proceso (ver getauxval(3))
+const atClkTck = 17
+
+const defaultUserHZ = 100
+
+var (
+	userHZOnce sync.Once
+	userHZVal  uint64
+)
+
+// userHZ devuelve USER_HZ (ticks por segundo de /proc/<pid>/stat), leído de
+// /proc/self/auxv. Si no se puede leer se asume 100.
+func userHZ() uint64 {
+	userHZOnce.Do(func() {
+		userHZVal = defaultUserHZ
+		data, err := os.ReadFile(filepath.Join(procRoot, "self", "auxv"))
+		if err != nil {
+			return
+		}
+		if hz := parseAuxvClkTck(data, strconv.IntSize/8); hz > 0 {
+			userHZVal = hz
+		}
+	})
+	return userHZVal
+}
+
+// parseAuxvClkTck busca AT_CLKTCK en el auxv (pares clave/valor del tamaño de
+// palabra de la plataforma: 8 bytes en 64 bits, 4 en 32 bits).
+func parseAuxvClkTck(data []byte, wordSize int) uint64 {
+	word := func(b []byte) uint64 {
+		if wordSize == 4 {
+			return uint64(binary.NativeEndian.Uint32(b))
+		}
+		return binary.NativeEndian.Uint64(b)
+	}
+	if wordSize != 4 && wordSize != 8 {
+		return 0
+	}
+	for i := 0; i+2*wordSize <= len(data); i += 2 * wordSize {
+		key := word(data[i:])
+		val := word(data[i+wordSize:])
+		if key == 0 {
+			break
+		}
+		if key == atClkTck {
+			return val
+		}
+	}
+	return 0
+}
+
+// readProcStat lee ppid (campo 4) y starttime (campo 22, en ns) de /proc/<pid>/stat.
+// Se usa con módulos que no reportan esos campos.
+func readProcStat(pid int) (int, uint64, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseProcStat(string(data), userHZ())
+}
+
+func parseProcStat(stat string, hz uint64) (int, uint64, error) {
+	// comm va entre paréntesis y puede tener espacios: cortar tras el último ')'
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, 0, fmt.Errorf("formato de stat inesperado")
+	}
+	fields := strings.Fields(stat[end+1:])
+	// fields[0] es el campo 3 (state)
+	const (
+		ppidIdx      = 4 - 3
+		startTimeIdx = 22 - 3
+	)
+	if len(fields) <= startTimeIdx {
+		return 0, 0, fmt.Errorf("stat con %d campos, falta starttime", len(fields)+2)
+	}
+	ppid, err := strconv.Atoi(fields[ppidIdx])
+	if err != nil {
+		return 0, 0, fmt.Errorf("ppid inválido: %w", err)
+	}
+	ticks, err := strconv.ParseUint(fields[startTimeIdx], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("starttime inválido: %w", err)
+	}
+	if hz == 0 {
+		hz = defaultUserHZ
+	}
+	return ppid, ticks * (1e9 / hz), nil
+}
+
+// procUID devuelve el dueño de /proc/<pid>, que es el uid efectivo del proceso.
+func procUID(pid int) (int, error) {
+	fi, err := os.Stat(filepath.Join(procRoot, strconv.Itoa(pid)))
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("stat de /proc/%d sin uid", pid)
+	}
+	return int(st.Uid), nil
+}
+
+// fillFromProcStat completa desde /proc los campos que los módulos anteriores
+// no reportan: StartTimeNs y PPid (< v3) y UID (< v4). Los procesos que ya
+// terminaron quedan en 0, y con UID -1.
+func fillFromProcStat(si *SysInfo) {
+	for i := range si.Procesos {
+		p := &si.Procesos[i]
+		if si.SchemaVersion < 3 {
+			if ppid, ns, err := readProcStat(p.Pid); err == nil {
+				if p.StartTimeNs == 0 {
+					p.StartTimeNs = ns
+				}
+				p.PPid = ppid
+			}
+		}
+		if si.SchemaVersion < 4 {
+			p.UID = -1
+			if uid, err := procUID(p.Pid); err == nil {
+				p.UID = uid
+			}
+		}
+	}
+}
+
+func (p Process) key() procKey {
+	return procKey{Pid: p.Pid, StartTimeNs: p.StartTimeNs}
+}
+
+// cpuTimeNs devuelve utime+stime en ns según la unidad del snapshot.
+func cpuTimeNs(si SysInfo, p Process) uint64 {
+	total := p.Utime + p.Stime
+	switch si.CPUTimeUnit {
+	case "ticks":
+		return total * (1e9 / userHZ())
+	default:
+		// "ns"; los módulos sin el campo también usan task_cputime_adjusted (ns)
+		return total
+	}
+}
+
+// snapshotIntervalNs es el tiempo entre snapshots. Prefiere boottime_ns
+// (monótono) para no verse afectado por saltos del reloj de pared.
+func snapshotIntervalNs(prev, curr SysInfo) (uint64, bool) {
+	if prev.BoottimeNs > 0 && curr.BoottimeNs > 0 {
+		if curr.BoottimeNs <= prev.BoottimeNs {
+			return 0, false
+		}
+		return curr.BoottimeNs - prev.BoottimeNs, true
+	}
+	if curr.TsMs <= prev.TsMs {
+		// reloj hacia atrás o snapshot repetido
+		return 0, false
+	}
+	return (curr.TsMs - prev.TsMs) * 1e6, true
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestBuildProcCpuPct(t *testing.T) {
+	snap := func(tsMs, boottimeNs uint64, procs ...Process) SysInfo {
+		return SysInfo{TsMs: tsMs, BoottimeNs: boottimeNs, CPUTimeUnit: "ns", Procesos: procs}
+	}
+	proc := func(pid int, startNs, cpuNs uint64) Process {
+		return Process{Pid: pid, StartTimeNs: startNs, Utime: cpuNs}
+	}
+
+	cases := []struct {
+		name    string
+		prev    SysInfo
+		curr    SysInfo
+		numCPUs int
+		want    map[int]float64
+	}{
+		{
+			name:    "mismo proceso",
+			prev:    snap(1000, 0, proc(10, 500, 0)),
+			curr:    snap(2000, 0, proc(10, 500, 500e6)),
+			numCPUs: 1,
+			want:    map[int]float64{10: 50},
+		},
+		{
+			name:    "normaliza por cantidad de CPUs",
+			prev:    snap(1000, 0, proc(10, 500, 0)),
+			curr:    snap(2000, 0, proc(10, 500, 1e9)),
+			numCPUs: 4,
+			want:    map[int]float64{10: 25},
+		},
+		{
+			name:    "PID reutilizado con otro start_time",
+			prev:    snap(1000, 0, proc(10, 500, 100e6)),
+			curr:    snap(2000, 0, proc(10, 900, 900e6)),
+			numCPUs: 1,
+			want:    map[int]float64{},
+		},
+		{
+			name:    "proceso que terminó",
+			prev:    snap(1000, 0, proc(10, 500, 0), proc(11, 600, 0)),
+			curr:    snap(2000, 0, proc(11, 600, 100e6)),
+			numCPUs: 1,
+			want:    map[int]float64{11: 10},
+		},
+		{
+			name:    "proceso nuevo sin muestra previa",
+			prev:    snap(1000, 0),
+			curr:    snap(2000, 0, proc(12, 700, 100e6)),
+			numCPUs: 1,
+			want:    map[int]float64{},
+		},
+		{
+			name:    "ts_ms hacia atrás",
+			prev:    snap(2000, 0, proc(10, 500, 0)),
+			curr:    snap(1000, 0, proc(10, 500, 100e6)),
+			numCPUs: 1,
+			want:    map[int]float64{},
+		},
+		{
+			name:    "ts_ms repetido",
+			prev:    snap(2000, 0, proc(10, 500, 0)),
+			curr:    snap(2000, 0, proc(10, 500, 100e6)),
+			numCPUs: 1,
+			want:    map[int]float64{},
+		},
+		{
+			name:    "boottime manda sobre un salto del reloj de pared",
+			prev:    snap(5000, 1e9, proc(10, 500, 0)),
+			curr:    snap(1000, 2e9, proc(10, 500, 100e6)),
+			numCPUs: 1,
+			want:    map[int]float64{10: 10},
+		},
+		{
+			name:    "contador reiniciado",
+			prev:    snap(1000, 0, proc(10, 500, 900e6)),
+			curr:    snap(2000, 0, proc(10, 500, 100e6)),
+			numCPUs: 1,
+			want:    map[int]float64{},
+		},
+		{
+			name:    "sin start_time compara por PID",
+			prev:    snap(1000, 0, proc(10, 0, 0)),
+			curr:    snap(2000, 0, proc(10, 0, 200e6)),
+			numCPUs: 1,
+			want:    map[int]float64{10: 20},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := BuildProcCpuPct(tc.prev, tc.curr, tc.numCPUs)
+			if len(got) != len(tc.want) {
+				t.Fatalf("BuildProcCpuPct = %v, se esperaba %v", got, tc.want)
+			}
+			for pid, want := range tc.want {
+				if g, ok := got[pid]; !ok || g < want-0.001 || g > want+0.001 {
+					t.Errorf("PID %d: cpu_pct = %v, se esperaba %v", pid, g, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotIntervalNs(t *testing.T) {
+	cases := []struct {
+		name   string
+		prev   SysInfo
+		curr   SysInfo
+		want   uint64
+		wantOK bool
+	}{
+		{"ts_ms", SysInfo{TsMs: 1000}, SysInfo{TsMs: 3000}, 2e9, true},
+		{"ts_ms igual", SysInfo{TsMs: 1000}, SysInfo{TsMs: 1000}, 0, false},
+		{"ts_ms hacia atrás", SysInfo{TsMs: 3000}, SysInfo{TsMs: 1000}, 0, false},
+		{"boottime", SysInfo{TsMs: 9000, BoottimeNs: 1e9}, SysInfo{TsMs: 1000, BoottimeNs: 4e9}, 3e9, true},
+		{"boottime igual", SysInfo{TsMs: 1000, BoottimeNs: 1e9}, SysInfo{TsMs: 2000, BoottimeNs: 1e9}, 0, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := snapshotIntervalNs(tc.prev, tc.curr)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("snapshotIntervalNs = (%d, %v), se esperaba (%d, %v)", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestProcKey(t *testing.T) {
+	a := Process{Pid: 10, StartTimeNs: 500}
+	b := Process{Pid: 10, StartTimeNs: 900}
+	if a.key() == b.key() {
+		t.Errorf("mismo PID con distinto start_time dio la misma clave %v", a.key())
+	}
+	if a.key() != (Process{Pid: 10, StartTimeNs: 500, Utime: 7}).key() {
+		t.Errorf("la clave no debería depender de los contadores")
+	}
+}
+
+func TestParseAuxvClkTck(t *testing.T) {
+	auxv := func(wordSize int, pairs ...uint64) []byte {
+		buf := make([]byte, len(pairs)*wordSize)
+		for i, v := range pairs {
+			if wordSize == 4 {
+				binary.NativeEndian.PutUint32(buf[i*4:], uint32(v))
+			} else {
+				binary.NativeEndian.PutUint64(buf[i*8:], v)
+			}
+		}
+		return buf
+	}
+
+	cases := []struct {
+		name     string
+		data     []byte
+		wordSize int
+		want     uint64
+	}{
+		{"64 bits", auxv(8, 6, 4096, atClkTck, 250, 0, 0), 8, 250},
+		{"32 bits", auxv(4, 6, 4096, atClkTck, 100, 0, 0), 4, 100},
+		{"sin AT_CLKTCK", auxv(8, 6, 4096, 0, 0), 8, 0},
+		{"AT_CLKTCK después de AT_NULL", auxv(8, 0, 0, atClkTck, 250), 8, 0},
+		{"truncado", auxv(8, 6, 4096, atClkTck, 250)[:20], 8, 0},
+		{"tamaño de palabra inválido", auxv(8, atClkTck, 250), 2, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseAuxvClkTck(tc.data, tc.wordSize); got != tc.want {
+				t.Errorf("parseAuxvClkTck = %d, se esperaba %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseProcStat(t *testing.T) {
+	// comm con espacios y paréntesis
+	stat := "1234 (mi (proc) x) S 42 1234 1234 0 -1 4194560 100 0 0 0 5 3 0 0 20 0 1 0 250 1000 10"
+	ppid, startNs, err := parseProcStat(stat, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ppid != 42 || startNs != 250*1e7 {
+		t.Errorf("parseProcStat = (%d, %d), se esperaba (42, %d)", ppid, startNs, uint64(250*1e7))
+	}
+	if _, _, err := parseProcStat("1234 (x) S 1", 100); err == nil {
+		t.Errorf("stat truncado debería dar error")
+	}
+}
@@ -10,11 +10,13 @@ import (
 
 // CONTENEDORES
 type ContInfoSnapshot struct {
-	TotalRAMKB uint64        `json:"total_ram_kb"`
-	FreeRAMKB  uint64        `json:"free_ram_kb"`
-	UsedRAMKB  uint64        `json:"used_ram_kb"`
-	TsMs       int64         `json:"ts_ms"`
-	Procesos   []ContProcess `json:"procesos"`
+	SchemaVersion int           `json:"schema_version"`
+	ModuleVersion string        `json:"module_version"`
+	TotalRAMKB    uint64        `json:"total_ram_kb"`
+	FreeRAMKB     uint64        `json:"free_ram_kb"`
+	UsedRAMKB     uint64        `json:"used_ram_kb"`
+	TsMs          int64         `json:"ts_ms"`
+	Procesos      []ContProcess `json:"procesos"`
 }
 
 // ContProcess representa cada entrada de "procesos"
@@ -38,6 +40,17 @@ func ReadContInfo(path string) (ContInfoSnapshot, error) {
 		return snap, fmt.Errorf("no se pudo leer %s: %w", path, err)
 	}
 
+	return ParseContInfo(path, data)
+}
+
+// ParseContInfo valida y decodifica el JSON leído de path.
+func ParseContInfo(path string, data []byte) (ContInfoSnapshot, error) {
+	var snap ContInfoSnapshot
+
+	if err := validateSnapshot(snapshotContinfo, data); err != nil {
+		return snap, fmt.Errorf("snapshot inválido en %s: %w", path, err)
+	}
+
 	if err := json.Unmarshal(data, &snap); err != nil {
 		return snap, fmt.Errorf("error al parsear JSON de %s: %w", path, err)
 	}
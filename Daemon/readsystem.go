@@ -12,16 +12,22 @@ import (
 // PROCESOS DEL SISTEMA
 type Process struct {
 	Pid      int    `json:"pid"`
+	PPid     int    `json:"ppid"` // schema v3; 0 si el módulo no lo reporta
+	UID      int    `json:"uid"`  // schema v4 (sin mapeo, overflowuid); -1 si no se pudo leer de /proc (< v4)
 	Comm     string `json:"comm"`
 	RssKB    uint64 `json:"rss_kb"`
 	VmsizeKB uint64 `json:"vmsize_kb"`
 	State    string `json:"state"`
 	Utime    uint64 `json:"utime"`
 	Stime    uint64 `json:"stime"`
-	TsMs     uint64 `json:"ts_ms"`
+	// inicio desde el arranque en ns (schema v2); 0 si el módulo no lo reporta
+	StartTimeNs uint64 `json:"start_time_ns"`
+	TsMs        uint64 `json:"ts_ms"`
 }
 
 type SysInfo struct {
+	SchemaVersion  int       `json:"schema_version"`
+	ModuleVersion  string    `json:"module_version"`
 	TotalRAMKB     uint64    `json:"total_ram_kb"`
 	FreeRAMKB      uint64    `json:"free_ram_kb"`
 	AvailableKB    uint64    `json:"available_kb"`
@@ -29,6 +35,8 @@ type SysInfo struct {
 	TotalProcs     int64     `json:"total_procs"`
 	CPUUsagePct    uint64    `json:"cpu_usage_pct"`
 	TsMs           uint64    `json:"ts_ms"`
+	BoottimeNs     uint64    `json:"boottime_ns"`   // schema v2
+	CPUTimeUnit    string    `json:"cpu_time_unit"` // "ns" o "ticks" (schema v2)
 	Procesos       []Process `json:"procesos"`
 	RawJSONPresent bool
 }
@@ -47,6 +55,17 @@ func ReadSysinfo(path string) (SysInfo, error) {
 		return si, fmt.Errorf("error leyendo %s: %w", path, err)
 	}
 
+	return ParseSysinfo(path, data)
+}
+
+// ParseSysinfo valida y decodifica el JSON leído de path.
+func ParseSysinfo(path string, data []byte) (SysInfo, error) {
+	var si SysInfo
+
+	if err := validateSnapshot(snapshotSysinfo, data); err != nil {
+		return si, fmt.Errorf("snapshot inválido en %s: %w", path, err)
+	}
+
 	if err := json.Unmarshal(data, &si); err != nil {
 		return si, fmt.Errorf("error parseando JSON de %s: %w\ncontenido recibido:\n%s", path, err, string(data))
 	}
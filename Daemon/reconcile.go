@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContainerTemplate es una forma de crear un contenedor de una clase.
+type ContainerTemplate struct {
+	NamePrefix string   `json:"name_prefix" yaml:"name_prefix"`
+	Image      string   `json:"image" yaml:"image"`
+	Args       []string `json:"args" yaml:"args"`
+}
+
+// ContainerClassSpec es el estado deseado de una clase de contenedores.
+// Los contenedores pertenecen a la clase por el prefijo de nombre de sus plantillas.
+type ContainerClassSpec struct {
+	Name      string              `json:"name" yaml:"name"`
+	Desired   int                 `json:"desired" yaml:"desired"`
+	Templates []ContainerTemplate `json:"templates" yaml:"templates"`
+}
+
+// Nombres de las clases usadas por enforceRules
+const (
+	classLow  = "low"
+	classHigh = "high"
+)
+
+func defaultClassSpecs() []ContainerClassSpec {
+	return []ContainerClassSpec{
+		{
+			Name:    classLow,
+			Desired: desiredLowContainers,
+			Templates: []ContainerTemplate{
+				{NamePrefix: lowPrefix, Image: "stress-low:so1"},
+			},
+		},
+		{
+			Name:    classHigh,
+			Desired: desiredHighContainers,
+			Templates: []ContainerTemplate{
+				{NamePrefix: highCPUPrefix, Image: "stress-high-cpu:so1"},
+				{NamePrefix: highRAMPrefix, Image: "stress-high-ram:so1"},
+			},
+		},
+	}
+}
+
+// activeClasses devuelve las clases del escenario en curso o, si no hay, las de la configuración.
+func activeClasses() []ContainerClassSpec {
+	if classes, ok := scenarios.Classes(); ok {
+		return classes
+	}
+	return cfg.Classes
+}
+
+// classSpec busca la clase por nombre en las clases activas.
+func classSpec(name string) (ContainerClassSpec, bool) {
+	for _, spec := range activeClasses() {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return ContainerClassSpec{}, false
+}
+
+// desiredCount devuelve la cantidad deseada de la clase (0 si no existe).
+func desiredCount(class string) int {
+	spec, _ := classSpec(class)
+	return spec.Desired
+}
+
+// classMembers separa los contenedores por plantilla de la clase (mismo orden que Templates).
+func classMembers(spec ContainerClassSpec, containers []ContainerInfo) [][]ContainerInfo {
+	members := make([][]ContainerInfo, len(spec.Templates))
+	for _, c := range containers {
+		for i, tpl := range spec.Templates {
+			if strings.HasPrefix(c.Name, tpl.NamePrefix) {
+				members[i] = append(members[i], c)
+				break
+			}
+		}
+	}
+	return members
+}
+
+// scaleUp arranca contenedores en las clases que están por debajo de lo deseado.
+// Entre plantillas de una misma clase elige la que tenga menos contenedores vivos.
+func scaleUp(running []ContainerInfo) {
+	// un escenario siempre reconcilia hacia arriba
+	if !cfg.ScaleUpEnabled && !scenarios.Active() {
+		return
+	}
+
+	var alive []ContainerInfo
+	for _, c := range running {
+		if !stopper.IsStopping(c.ID) {
+			alive = append(alive, c)
+		}
+	}
+
+	started := 0
+	for _, spec := range activeClasses() {
+		if len(spec.Templates) == 0 {
+			continue
+		}
+		members := classMembers(spec, alive)
+		total := 0
+		for _, m := range members {
+			total += len(m)
+		}
+
+		missing := spec.Desired - total
+		if missing <= 0 {
+			continue
+		}
+		fmt.Printf("Clase %s: %d de %d contenedores, se crearán %d...\n", spec.Name, total, spec.Desired, missing)
+
+		for ; missing > 0; missing-- {
+			if cfg.MaxStartsPerCycle > 0 && started >= cfg.MaxStartsPerCycle {
+				fmt.Printf("     (límite de %d arranques por ciclo alcanzado)\n", cfg.MaxStartsPerCycle)
+				return
+			}
+
+			idx := 0
+			for i := range members {
+				if len(members[i]) < len(members[idx]) {
+					idx = i
+				}
+			}
+			tpl := spec.Templates[idx]
+
+			c, err := startContainer(spec.Name, tpl, nil)
+			if err != nil {
+				fmt.Println("    ", err)
+				return
+			}
+			members[idx] = append(members[idx], c)
+			started++
+		}
+	}
+}
+
+// startContainer crea un contenedor a partir de la plantilla. extraArgs reemplaza
+// a tpl.Args si no es nil (el comando del contenedor).
+func startContainer(class string, tpl ContainerTemplate, extraArgs []string) (ContainerInfo, error) {
+	if !stressImages.Ready(tpl.Image) {
+		return ContainerInfo{}, fmt.Errorf("la imagen %s todavía se está construyendo", tpl.Image)
+	}
+	name := tpl.NamePrefix + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	args := []string{"run", "-d", "--rm",
+		"--name", name,
+		"--label", "so1.managed-by=daemon",
+		"--label", "so1.class=" + class,
+		tpl.Image,
+	}
+	cmdArgs := tpl.Args
+	if extraArgs != nil {
+		cmdArgs = extraArgs
+	}
+	args = append(args, cmdArgs...)
+
+	fmt.Printf("  -> Creando contenedor %s (%s)\n", name, tpl.Image)
+	out, err := runCmd(30*time.Second, "docker", args...)
+	if err != nil {
+		return ContainerInfo{}, fmt.Errorf("no se pudo crear %s: %w", name, err)
+	}
+
+	return ContainerInfo{
+		ID:        strings.TrimSpace(out),
+		Name:      name,
+		Image:     tpl.Image,
+		CreatedAt: time.Now(),
+	}, nil
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario es un experimento de carga por fases leído desde YAML:
+//
+//	name: ram-capacity
+//	classes:                 # opcional, reemplaza las clases de la config
+//	  - name: high
+//	    templates:
+//	      - {name_prefix: stress-high-ram-, image: "stress-high-ram:so1"}
+//	  - name: low
+//	    templates:
+//	      - {name_prefix: stress-low-, image: "stress-low:so1"}
+//	phases:
+//	  - {name: idle, duration: 5m, desired: {high: 0, low: 0}}
+//	  - {name: ramp, duration: 2m, ramp: true, desired: {high: 8}}
+//	  - {name: hold, duration: 10m, desired: {high: 8}}
+//	  - {name: cooldown, duration: 3m, desired: {high: 0}}
+//
+// Las clases que una fase no menciona mantienen el valor de la fase anterior.
+type Scenario struct {
+	Name    string               `yaml:"name"`
+	Classes []ContainerClassSpec `yaml:"classes"`
+	Phases  []ScenarioPhase      `yaml:"phases"`
+
+	// Si es true el generador de carga sigue corriendo durante el escenario
+	KeepWorkload bool `yaml:"keep_workload"`
+}
+
+type ScenarioPhase struct {
+	Name     string         `yaml:"name"`
+	Duration time.Duration  `yaml:"duration"`
+	Ramp     bool           `yaml:"ramp"` // interpolar linealmente desde la fase anterior
+	Desired  map[string]int `yaml:"desired"`
+}
+
+// LoadScenario lee y valida un archivo de escenario.
+func LoadScenario(path string) (Scenario, error) {
+	var scn Scenario
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return scn, fmt.Errorf("no se pudo leer escenario %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, &scn); err != nil {
+		return scn, fmt.Errorf("error parseando escenario %s: %w", path, err)
+	}
+	if len(scn.Classes) == 0 {
+		scn.Classes = cfg.Classes
+	}
+	if err := scn.validate(); err != nil {
+		return scn, fmt.Errorf("escenario %s inválido: %w", path, err)
+	}
+	return scn, nil
+}
+
+func (s Scenario) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("falta name")
+	}
+	if len(s.Phases) == 0 {
+		return fmt.Errorf("el escenario no tiene fases")
+	}
+	classes := make(map[string]bool, len(s.Classes))
+	for _, c := range s.Classes {
+		if c.Name == "" {
+			return fmt.Errorf("clase sin nombre")
+		}
+		for _, tpl := range c.Templates {
+			if tpl.NamePrefix == "" || tpl.Image == "" {
+				return fmt.Errorf("plantilla de la clase %q sin name_prefix o image", c.Name)
+			}
+		}
+		classes[c.Name] = true
+	}
+	for i, ph := range s.Phases {
+		if ph.Name == "" {
+			return fmt.Errorf("fase %d sin nombre", i+1)
+		}
+		if ph.Duration <= 0 {
+			return fmt.Errorf("fase %s sin duración", ph.Name)
+		}
+		for class, n := range ph.Desired {
+			if !classes[class] {
+				return fmt.Errorf("fase %s: clase desconocida %q", ph.Name, class)
+			}
+			if n < 0 {
+				return fmt.Errorf("fase %s: cantidad negativa para %q", ph.Name, class)
+			}
+		}
+	}
+	return nil
+}
+
+// ScenarioStatus es el estado del escenario en curso (API).
+type ScenarioStatus struct {
+	Running      bool           `json:"running"`
+	RunID        string         `json:"run_id"`
+	Scenario     string         `json:"scenario"`
+	Phase        string         `json:"phase"`
+	PhaseIndex   int            `json:"phase_index"`
+	PhaseEndTsMs int64          `json:"phase_end_ts_ms"`
+	Desired      map[string]int `json:"desired"`
+}
+
+type scenarioEvent struct {
+	TsMs     int64
+	RunID    string
+	Scenario string
+	Phase    string // "" para inicio/fin de la corrida
+	Index    int
+	Kind     string // "run_start", "phase_start", "run_end"
+	Detail   string
+}
+
+type scenarioRunner struct {
+	mu      sync.Mutex
+	status  ScenarioStatus
+	classes []ContainerClassSpec
+	stop    chan struct{} // nil una vez cerrado
+	done    chan struct{}
+	events  []scenarioEvent
+
+	// generador de carga detenido al iniciar, para reanudarlo al terminar
+	resumeWorkload *WorkloadScenario
+}
+
+var scenarios = &scenarioRunner{}
+
+// Start ejecuta el escenario en segundo plano.
+func (r *scenarioRunner) Start(scn Scenario) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status.Running {
+		return "", fmt.Errorf("ya hay un escenario corriendo: %s", r.status.RunID)
+	}
+
+	now := time.Now()
+	runID := fmt.Sprintf("%s-%s", scn.Name, now.UTC().Format("20060102T150405"))
+
+	r.status = ScenarioStatus{Running: true, RunID: runID, Scenario: scn.Name, PhaseIndex: -1}
+	r.classes = append([]ContainerClassSpec(nil), scn.Classes...)
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	r.eventLocked(now, -1, "", "run_start", "")
+
+	r.resumeWorkload = nil
+	if !scn.KeepWorkload {
+		if st := workload.Status(); st.Running {
+			resume := st.Scenario
+			r.resumeWorkload = &resume
+		}
+		go workload.Stop()
+	}
+
+	fmt.Printf("Escenario %s iniciado (run %s, %d fases)\n", scn.Name, runID, len(scn.Phases))
+	go r.run(scn, r.stop, r.done)
+	return runID, nil
+}
+
+// Stop corta el escenario en curso y espera a que termine. Se puede llamar
+// desde varios lados a la vez (API y apagado): solo el primero cierra stop.
+func (r *scenarioRunner) Stop() {
+	r.mu.Lock()
+	if !r.status.Running {
+		r.mu.Unlock()
+		return
+	}
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+	done := r.done
+	r.mu.Unlock()
+
+	<-done
+}
+
+// Shutdown corta el escenario sin reanudar el generador de carga (apagado).
+func (r *scenarioRunner) Shutdown() {
+	r.mu.Lock()
+	r.resumeWorkload = nil
+	r.mu.Unlock()
+	r.Stop()
+}
+
+func (r *scenarioRunner) run(scn Scenario, stop, done chan struct{}) {
+	detail := "completado"
+	defer func() {
+		r.mu.Lock()
+		r.eventLocked(time.Now(), -1, "", "run_end", detail)
+		r.status.Running = false
+		r.status.Phase = ""
+		r.classes = nil
+		resume := r.resumeWorkload
+		r.resumeWorkload = nil
+		r.mu.Unlock()
+		fmt.Printf("Escenario %s terminado: %s\n", scn.Name, detail)
+
+		if resume != nil {
+			// el Stop asíncrono de Start puede no haber terminado todavía
+			workload.Stop()
+			if err := workload.Start(*resume); err != nil {
+				fmt.Println("No se pudo reanudar el generador de carga:", err)
+			}
+		}
+		close(done)
+	}()
+
+	// cantidades de partida: las de la configuración
+	current := make(map[string]int)
+	for _, c := range scn.Classes {
+		current[c.Name] = c.Desired
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for i, ph := range scn.Phases {
+		from := make(map[string]int, len(current))
+		to := make(map[string]int, len(current))
+		for class, n := range current {
+			from[class] = n
+			to[class] = n
+		}
+		for class, n := range ph.Desired {
+			to[class] = n
+		}
+
+		start := time.Now()
+		end := start.Add(ph.Duration)
+
+		r.mu.Lock()
+		r.status.Phase = ph.Name
+		r.status.PhaseIndex = i
+		r.status.PhaseEndTsMs = end.UnixMilli()
+		r.eventLocked(start, i, ph.Name, "phase_start", fmt.Sprintf("%v", to))
+		r.mu.Unlock()
+		fmt.Printf("Escenario %s: fase %d/%d %s (%s)\n", scn.Name, i+1, len(scn.Phases), ph.Name, ph.Duration)
+
+		for {
+			now := time.Now()
+			frac := 1.0
+			if ph.Ramp {
+				frac = math.Min(1, float64(now.Sub(start))/float64(ph.Duration))
+			}
+			for class := range to {
+				current[class] = from[class] + int(math.Round(float64(to[class]-from[class])*frac))
+			}
+			r.setDesired(current)
+
+			if !now.Before(end) {
+				break
+			}
+			select {
+			case <-stop:
+				detail = "cancelado"
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+func (r *scenarioRunner) setDesired(desired map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Desired = make(map[string]int, len(desired))
+	for i := range r.classes {
+		if n, ok := desired[r.classes[i].Name]; ok {
+			r.classes[i].Desired = n
+			r.status.Desired[r.classes[i].Name] = n
+		}
+	}
+}
+
+func (r *scenarioRunner) eventLocked(ts time.Time, index int, phase, kind, detail string) {
+	r.events = append(r.events, scenarioEvent{
+		TsMs:     ts.UnixMilli(),
+		RunID:    r.status.RunID,
+		Scenario: r.status.Scenario,
+		Phase:    phase,
+		Index:    index,
+		Kind:     kind,
+		Detail:   detail,
+	})
+}
+
+// Classes devuelve las clases con las cantidades de la fase actual, si hay escenario.
+func (r *scenarioRunner) Classes() ([]ContainerClassSpec, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.status.Running || r.classes == nil {
+		return nil, false
+	}
+	return append([]ContainerClassSpec(nil), r.classes...), true
+}
+
+// Active indica si hay un escenario en curso.
+func (r *scenarioRunner) Active() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status.Running
+}
+
+// scenarioTag es la corrida y fase con que se etiqueta una fila de métricas.
+type scenarioTag struct {
+	RunID string
+	Phase string
+}
+
+// Tag devuelve la corrida y fase en curso; vacío si no hay escenario. Los
+// colectores lo toman al empezar el ciclo, así una fila encolada durante un
+// cambio de fase conserva la fase en que se tomó la muestra.
+func (r *scenarioRunner) Tag() scenarioTag {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.status.Running {
+		return scenarioTag{}
+	}
+	return scenarioTag{RunID: r.status.RunID, Phase: r.status.Phase}
+}
+
+func (r *scenarioRunner) Status() ScenarioStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+func (r *scenarioRunner) drainEvents() []scenarioEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := r.events
+	r.events = nil
+	return out
+}
+
+// Tablas de métricas que llevan la etiqueta de escenario/fase
+var scenarioTaggedTables = []string{
+	"system_metrics",
+	"host_pressure_metrics",
+	"process_metrics",
+	"process_state_summary",
+	"process_user_summary",
+	"process_comm_summary",
+	"container_host_metrics",
+	"container_metrics",
+	"container_cgroup_metrics",
+}
+
+func CreateScenarioTables(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS scenario_events (
+        id           INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms        BIGINT NOT NULL,
+        run_id       VARCHAR(128) NOT NULL,
+        scenario     VARCHAR(128) NOT NULL,
+        phase        VARCHAR(64),
+        phase_index  INT,
+        kind         VARCHAR(16) NOT NULL,
+        detail       TEXT,
+        created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla scenario_events: %w", err)
+	}
+
+	idx := `CREATE INDEX IF NOT EXISTS idx_scenario_events_run ON scenario_events(run_id, ts_ms);`
+	if _, err := db.Exec(idx); err != nil {
+		return fmt.Errorf("error creando índice idx_scenario_events_run: %w", err)
+	}
+
+	for _, table := range scenarioTaggedTables {
+		if err := addColumnIfMissing(db, table, "scenario_run_id", "VARCHAR(128)"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(db, table, "scenario_phase", "VARCHAR(64)"); err != nil {
+			return err
+		}
+	}
+
+	// Vista para comparar corridas: duración de cada fase
+	view := `
+    CREATE VIEW IF NOT EXISTS v_scenario_phases AS
+    SELECT e.run_id, e.scenario, e.phase, e.phase_index,
+           e.ts_ms AS start_ts_ms,
+           (SELECT MIN(n.ts_ms) FROM scenario_events n
+             WHERE n.run_id = e.run_id AND n.ts_ms >= e.ts_ms AND n.id > e.id) AS end_ts_ms
+    FROM scenario_events e
+    WHERE e.kind = 'phase_start';
+    `
+	if _, err := db.Exec(view); err != nil {
+		return fmt.Errorf("error creando vista v_scenario_phases: %w", err)
+	}
+	return nil
+}
+
+// InsertScenarioEvents persiste inicios/fin de corrida y cambios de fase.
+func InsertScenarioEvents(db *sql.DB) error {
+	events := scenarios.drainEvents()
+	for _, ev := range events {
+		if _, err := db.Exec(`
+            INSERT INTO scenario_events (
+                ts_ms,
+                run_id,
+                scenario,
+                phase,
+                phase_index,
+                kind,
+                detail
+            ) VALUES (?, ?, ?, ?, ?, ?, ?);
+        `, ev.TsMs, ev.RunID, ev.Scenario, nullIfEmpty(ev.Phase), ev.Index, ev.Kind, ev.Detail); err != nil {
+			return fmt.Errorf("error insertando evento %s de %s en scenario_events: %w", ev.Kind, ev.RunID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScenarioValidateTemplates(t *testing.T) {
+	scenario := func(tpl ContainerTemplate) Scenario {
+		return Scenario{
+			Name: "prueba",
+			Classes: []ContainerClassSpec{
+				{Name: "batch", Templates: []ContainerTemplate{tpl}},
+			},
+			Phases: []ScenarioPhase{
+				{Name: "carga", Duration: time.Minute, Desired: map[string]int{"batch": 2}},
+			},
+		}
+	}
+
+	cases := []struct {
+		name    string
+		tpl     ContainerTemplate
+		wantErr bool
+	}{
+		{name: "completa", tpl: ContainerTemplate{NamePrefix: "job-", Image: "job:latest"}},
+		{name: "sin name_prefix", tpl: ContainerTemplate{Image: "job:latest"}, wantErr: true},
+		{name: "sin image", tpl: ContainerTemplate{NamePrefix: "job-"}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := scenario(tc.tpl).validate(); (err != nil) != tc.wantErr {
+				t.Errorf("validate() = %v, se esperaba error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// La fase con que se etiqueta un ciclo es la del momento de la muestra, aunque
+// cambie antes de que el escritor inserte las filas.
+func TestCycleCapturesScenarioTag(t *testing.T) {
+	scenarios.mu.Lock()
+	saved := scenarios.status
+	scenarios.status = ScenarioStatus{Running: true, RunID: "run-1", Phase: "calma"}
+	scenarios.mu.Unlock()
+	t.Cleanup(func() {
+		scenarios.mu.Lock()
+		scenarios.status = saved
+		scenarios.mu.Unlock()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tags := make(chan scenarioTag, 1)
+	go runAligned(ctx, "test", func() time.Duration { return 10 * time.Millisecond }, nil, func(rec *cycleRecord) {
+		scenarios.mu.Lock()
+		scenarios.status.Phase = "pico"
+		scenarios.mu.Unlock()
+		select {
+		case tags <- rec.Scenario:
+		default:
+		}
+	})
+
+	select {
+	case tag := <-tags:
+		if tag != (scenarioTag{RunID: "run-1", Phase: "calma"}) {
+			t.Errorf("etiqueta del ciclo = %+v, se esperaba la fase al empezar el ciclo", tag)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no corrió ningún ciclo")
+	}
+}
+
+// Dos Stop simultáneos (API y apagado) no cierran dos veces el canal.
+func TestScenarioConcurrentStop(t *testing.T) {
+	r := &scenarioRunner{}
+	scn := Scenario{
+		Name:         "prueba",
+		KeepWorkload: true,
+		Phases:       []ScenarioPhase{{Name: "larga", Duration: time.Hour}},
+	}
+	if _, err := r.Start(scn); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Stop()
+		}()
+	}
+	wg.Wait()
+	if r.Active() {
+		t.Error("el escenario sigue activo tras Stop")
+	}
+	r.Stop() // sin escenario: no hace nada
+}
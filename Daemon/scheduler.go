@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Etapas medidas en cada ciclo de un colector
+const (
+	stageRead    = "read"
+	stageParse   = "parse"
+	stageCalc    = "calc"
+	stageInsert  = "insert"
+	stageEnforce = "enforce"
+)
+
+// cycleRecord son los tiempos y errores de un ciclo, guardados en collector_cycles.
+// Lo crea el planificador y lo completa el colector; se persiste junto con su lote.
+type cycleRecord struct {
+	Collector   string
+	TickTs      time.Time // tick alineado programado
+	StartTs     time.Time
+	Interval    time.Duration // intervalo programado
+	Actual      time.Duration // tiempo real desde el ciclo anterior (0 en el primero)
+	MissedTicks int           // ticks perdidos desde el ciclo anterior
+	Stages      map[string]time.Duration
+	Errors      int
+	Scenario    scenarioTag // escenario y fase al empezar el ciclo, no al escribirlo
+}
+
+func (r *cycleRecord) stage(name string, since time.Time) {
+	r.Stages[name] += time.Since(since)
+}
+
+func (r *cycleRecord) fail() {
+	r.Errors++
+}
+
+// sibling crea el registro de otro colector que corre en el mismo tick.
+func (r *cycleRecord) sibling(name string) *cycleRecord {
+	return &cycleRecord{
+		Collector:   name,
+		TickTs:      r.TickTs,
+		StartTs:     time.Now(),
+		Interval:    r.Interval,
+		Actual:      r.Actual,
+		MissedTicks: r.MissedTicks,
+		Stages:      make(map[string]time.Duration),
+		Scenario:    r.Scenario,
+	}
+}
+
+// nextAlignedTick devuelve el siguiente múltiplo de interval en el reloj de pared.
+func nextAlignedTick(t time.Time, interval time.Duration) time.Time {
+	return t.Truncate(interval).Add(interval)
+}
+
+// runAligned ejecuta fn en ticks alineados al reloj (p.ej. :00, :20, :40 con 20s),
+// así el intervalo efectivo no se alarga con la duración del trabajo. Si un ciclo
+// tarda más que el intervalo, los ticks que se saltan se cuentan como perdidos.
+// changed (opcional) avisa que interval cambió: si el nuevo tick alineado llega
+// antes que el programado, se reprograma sin esperar al tick viejo.
+func runAligned(ctx context.Context, name string, interval func() time.Duration,
+	changed func() <-chan struct{}, fn func(rec *cycleRecord)) {
+	iv := interval()
+	next := nextAlignedTick(time.Now(), iv)
+	missed := 0
+	var prevStart time.Time
+
+	for {
+		var wake <-chan struct{}
+		if changed != nil {
+			// pedir el canal antes de releer el intervalo para no perder un cambio
+			wake = changed()
+			if nv := interval(); nv != iv {
+				iv = nv
+				if n := nextAlignedTick(time.Now(), iv); n.Before(next) {
+					next = n
+				}
+			}
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-wake:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		rec := &cycleRecord{
+			Collector:   name,
+			TickTs:      next,
+			StartTs:     time.Now(),
+			Interval:    iv,
+			MissedTicks: missed,
+			Stages:      make(map[string]time.Duration),
+			Scenario:    scenarios.Tag(),
+		}
+		if !prevStart.IsZero() {
+			rec.Actual = rec.StartTs.Sub(prevStart)
+		}
+		prevStart = rec.StartTs
+		fn(rec)
+
+		end := time.Now()
+		iv = interval()
+		missed = 0
+		if behind := end.Sub(next); behind >= iv {
+			missed = int(behind / iv)
+			fmt.Printf(" Colector %s atrasado: %d tick(s) perdido(s) (ciclo de %s, intervalo %s)\n",
+				name, missed, end.Sub(rec.StartTs).Round(time.Millisecond), iv)
+		}
+		next = nextAlignedTick(end, iv)
+	}
+}
+
+// submitCycle encola el lote del colector (fn puede ser nil) y al final guarda el ciclo.
+func submitCycle(rec *cycleRecord, fn func(db *sql.DB) error) {
+	if !writer.Submit(rec.Collector, cycleWriteFunc(rec, fn)) {
+		fmt.Printf(" Ciclo de %s descartado por el escritor\n", rec.Collector)
+	}
+}
+
+func cycleWriteFunc(rec *cycleRecord, fn func(db *sql.DB) error) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		var err error
+		if fn != nil {
+			start := time.Now()
+			err = fn(db)
+			rec.stage(stageInsert, start)
+			if err != nil {
+				rec.fail()
+			}
+		}
+		if cerr := InsertCollectorCycle(db, rec, time.Now()); cerr != nil {
+			fmt.Println("Error InsertCollectorCycle:", cerr)
+		}
+		return err
+	}
+}
+
+func CreateCollectorCyclesTable(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS collector_cycles (
+        id            INTEGER PRIMARY KEY AUTOINCREMENT,
+        collector     VARCHAR(32) NOT NULL,
+        tick_ts_ms    BIGINT NOT NULL,
+        start_ts_ms   BIGINT NOT NULL,
+        lag_ms        REAL NOT NULL,
+        interval_ms   BIGINT NOT NULL,
+        actual_interval_ms BIGINT,
+        missed_ticks  INT NOT NULL,
+        read_ms       REAL,
+        parse_ms      REAL,
+        calc_ms       REAL,
+        insert_ms     REAL,
+        enforce_ms    REAL,
+        total_ms      REAL NOT NULL,
+        errors        INT NOT NULL,
+        created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla collector_cycles: %w", err)
+	}
+
+	idx := `CREATE INDEX IF NOT EXISTS idx_collector_cycles_ts ON collector_cycles(collector, tick_ts_ms);`
+	if _, err := db.Exec(idx); err != nil {
+		return fmt.Errorf("error creando índice idx_collector_cycles_ts: %w", err)
+	}
+	return nil
+}
+
+// InsertCollectorCycle guarda un ciclo; total_ms va desde el tick real hasta end.
+func InsertCollectorCycle(db *sql.DB, rec *cycleRecord, end time.Time) error {
+	stageMs := func(name string) interface{} {
+		d, ok := rec.Stages[name]
+		if !ok {
+			return nil
+		}
+		return float64(d) / float64(time.Millisecond)
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+
+	_, err := db.Exec(`
+        INSERT INTO collector_cycles (
+            collector,
+            tick_ts_ms,
+            start_ts_ms,
+            lag_ms,
+            interval_ms,
+            actual_interval_ms,
+            missed_ticks,
+            read_ms,
+            parse_ms,
+            calc_ms,
+            insert_ms,
+            enforce_ms,
+            total_ms,
+            errors
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+    `,
+		rec.Collector,
+		rec.TickTs.UnixMilli(),
+		rec.StartTs.UnixMilli(),
+		ms(rec.StartTs.Sub(rec.TickTs)),
+		rec.Interval.Milliseconds(),
+		nullIfZero(rec.Actual.Milliseconds()),
+		rec.MissedTicks,
+		stageMs(stageRead),
+		stageMs(stageParse),
+		stageMs(stageCalc),
+		stageMs(stageInsert),
+		stageMs(stageEnforce),
+		ms(end.Sub(rec.StartTs)),
+		rec.Errors,
+	)
+	if err != nil {
+		return fmt.Errorf("error insertando ciclo de %s en collector_cycles: %w", rec.Collector, err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestNextAlignedTick(t *testing.T) {
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		now      time.Time
+		interval time.Duration
+		want     time.Time
+	}{
+		{base.Add(5 * time.Second), 20 * time.Second, base.Add(20 * time.Second)},
+		{base.Add(19*time.Second + 999*time.Millisecond), 20 * time.Second, base.Add(20 * time.Second)},
+		// justo en el tick: el siguiente, no el mismo
+		{base.Add(20 * time.Second), 20 * time.Second, base.Add(40 * time.Second)},
+		{base.Add(61 * time.Second), time.Minute, base.Add(2 * time.Minute)},
+		{base.Add(7 * time.Second), 5 * time.Second, base.Add(10 * time.Second)},
+	}
+	for _, tc := range cases {
+		if got := nextAlignedTick(tc.now, tc.interval); !got.Equal(tc.want) {
+			t.Errorf("nextAlignedTick(%s, %s) = %s, se esperaba %s",
+				tc.now.Format(time.TimeOnly), tc.interval, got.Format(time.TimeOnly), tc.want.Format(time.TimeOnly))
+		}
+	}
+}
+
+// Un ciclo más largo que el intervalo cuenta los ticks perdidos en el
+// siguiente, y los ticks quedan alineados a múltiplos del intervalo.
+func TestRunAlignedMissedTicks(t *testing.T) {
+	const iv = 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	recs := make(chan *cycleRecord, 10)
+	calls := 0
+	go runAligned(ctx, "test", func() time.Duration { return iv }, nil, func(rec *cycleRecord) {
+		calls++
+		if calls == 1 {
+			time.Sleep(3*iv + iv/2)
+		}
+		recs <- rec
+	})
+
+	var got []*cycleRecord
+	for len(got) < 2 {
+		select {
+		case rec := <-recs:
+			got = append(got, rec)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("solo %d ciclos", len(got))
+		}
+	}
+	cancel()
+
+	for i, rec := range got {
+		if rec.TickTs.UnixNano()%int64(iv) != 0 {
+			t.Errorf("ciclo %d: tick %s no alineado a %s", i, rec.TickTs, iv)
+		}
+		if rec.StartTs.Before(rec.TickTs) {
+			t.Errorf("ciclo %d: empezó antes de su tick", i)
+		}
+	}
+	if got[0].MissedTicks != 0 || got[0].Actual != 0 {
+		t.Errorf("primer ciclo: perdidos = %d, actual = %s", got[0].MissedTicks, got[0].Actual)
+	}
+	if got[1].MissedTicks < 2 || got[1].MissedTicks > 4 {
+		t.Errorf("segundo ciclo: perdidos = %d, se esperaban ~3", got[1].MissedTicks)
+	}
+	if got[1].Actual < 3*iv {
+		t.Errorf("segundo ciclo: intervalo real %s, se esperaba >= %s", got[1].Actual, 3*iv)
+	}
+}
+
+// Las etapas que no corrieron quedan en NULL; lag y total se miden desde el tick.
+func TestInsertCollectorCycle(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := CreateCollectorCyclesTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	tick := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	rec := &cycleRecord{
+		Collector: "sysinfo",
+		TickTs:    tick,
+		StartTs:   tick.Add(5 * time.Millisecond),
+		Interval:  20 * time.Second,
+		Stages:    map[string]time.Duration{stageRead: 2 * time.Millisecond},
+		Errors:    1,
+	}
+	host := rec.sibling("host")
+	if host.TickTs != rec.TickTs || host.Interval != rec.Interval || host.Collector != "host" {
+		t.Errorf("sibling = %+v", host)
+	}
+	if err := InsertCollectorCycle(db, rec, rec.StartTs.Add(10*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	var lag, total float64
+	var read, parse sql.NullFloat64
+	var actual sql.NullInt64
+	var errs int
+	if err := db.QueryRow(`SELECT lag_ms, total_ms, read_ms, parse_ms, actual_interval_ms, errors
+		FROM collector_cycles WHERE collector = 'sysinfo'`).
+		Scan(&lag, &total, &read, &parse, &actual, &errs); err != nil {
+		t.Fatal(err)
+	}
+	if lag != 5 || total != 10 || errs != 1 {
+		t.Errorf("lag = %v, total = %v, errores = %d", lag, total, errs)
+	}
+	if !read.Valid || read.Float64 != 2 || parse.Valid || actual.Valid {
+		t.Errorf("read = %+v, parse = %+v, actual = %+v", read, parse, actual)
+	}
+}
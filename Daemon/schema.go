@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tipos de snapshot producidos por los módulos del kernel
+const (
+	snapshotSysinfo  = "sysinfo"
+	snapshotContinfo = "continfo"
+)
+
+// snapshotSchema son los campos obligatorios de una versión del formato JSON.
+type snapshotSchema struct {
+	ModuleVersions []string // versiones del módulo que emiten este formato (informativo)
+	Required       []string // campos de la raíz
+	ProcRequired   []string // campos de cada elemento de "procesos"
+}
+
+// snapshotSchemas es la tabla de compatibilidad: por tipo de snapshot, las
+// versiones de schema_version que el daemon sabe leer. Al cambiar el JSON de
+// un módulo se sube SNAPSHOT_SCHEMA_VERSION en el .c y se agrega aquí.
+var snapshotSchemas = map[string]map[int]snapshotSchema{
+	snapshotSysinfo: {
+		1: {
+			ModuleVersions: []string{"1.3.0"},
+			Required: []string{"schema_version", "module_version", "total_ram_kb", "free_ram_kb",
+				"available_kb", "ram_used_kb", "total_procs", "cpu_usage_pct", "ts_ms", "procesos"},
+			ProcRequired: []string{"pid", "comm", "rss_kb", "vmsize_kb", "state", "utime", "stime", "ts_ms"},
+		},
+		// v2: boottime_ns, cpu_time_unit y start_time_ns por proceso
+		2: {
+			ModuleVersions: []string{"1.4.0"},
+			Required: []string{"schema_version", "module_version", "total_ram_kb", "free_ram_kb",
+				"available_kb", "ram_used_kb", "total_procs", "cpu_usage_pct", "ts_ms",
+				"boottime_ns", "cpu_time_unit", "procesos"},
+			ProcRequired: []string{"pid", "comm", "rss_kb", "vmsize_kb", "state", "utime", "stime",
+				"start_time_ns", "ts_ms"},
+		},
+		// v3: ppid por proceso
+		3: {
+			ModuleVersions: []string{"1.5.0"},
+			Required: []string{"schema_version", "module_version", "total_ram_kb", "free_ram_kb",
+				"available_kb", "ram_used_kb", "total_procs", "cpu_usage_pct", "ts_ms",
+				"boottime_ns", "cpu_time_unit", "procesos"},
+			ProcRequired: []string{"pid", "ppid", "comm", "rss_kb", "vmsize_kb", "state", "utime", "stime",
+				"start_time_ns", "ts_ms"},
+		},
+		// v4: uid por proceso
+		4: {
+			ModuleVersions: []string{"1.6.0"},
+			Required: []string{"schema_version", "module_version", "total_ram_kb", "free_ram_kb",
+				"available_kb", "ram_used_kb", "total_procs", "cpu_usage_pct", "ts_ms",
+				"boottime_ns", "cpu_time_unit", "procesos"},
+			ProcRequired: []string{"pid", "ppid", "uid", "comm", "rss_kb", "vmsize_kb", "state", "utime", "stime",
+				"start_time_ns", "ts_ms"},
+		},
+	},
+	snapshotContinfo: {
+		1: {
+			ModuleVersions: []string{"1.1.0"},
+			Required: []string{"schema_version", "module_version", "total_ram_kb", "free_ram_kb",
+				"used_ram_kb", "ts_ms", "procesos"},
+			ProcRequired: []string{"pid", "nombre", "cmdline_or_container_id", "vsz_kb", "rss_kb",
+				"mem_percent", "cpu_time_ns", "estado", "container_related"},
+		},
+	},
+}
+
+// supportedSchemaVersions lista las versiones conocidas (para mensajes de error).
+func supportedSchemaVersions(kind string) []int {
+	var out []int
+	for v := range snapshotSchemas[kind] {
+		out = append(out, v)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// validateSnapshot comprueba schema_version y los campos obligatorios del JSON
+// antes de decodificarlo, para que un campo renombrado en el módulo sea un
+// error y no ceros silenciosos.
+func validateSnapshot(kind string, data []byte) error {
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("JSON inválido: %w", err)
+	}
+
+	rawVersion, ok := root["schema_version"]
+	if !ok {
+		return fmt.Errorf("%s sin schema_version: el módulo es anterior al versionado, recompilarlo (soportadas: %v)",
+			kind, supportedSchemaVersions(kind))
+	}
+	var version int
+	if err := json.Unmarshal(rawVersion, &version); err != nil {
+		return fmt.Errorf("%s: schema_version inválido: %w", kind, err)
+	}
+
+	schema, ok := snapshotSchemas[kind][version]
+	if !ok {
+		var moduleVersion string
+		_ = json.Unmarshal(root["module_version"], &moduleVersion)
+		return fmt.Errorf("%s schema_version %d (módulo %q) no soportado por este daemon (soportadas: %v)",
+			kind, version, moduleVersion, supportedSchemaVersions(kind))
+	}
+
+	if missing := missingFields(root, schema.Required); len(missing) > 0 {
+		return fmt.Errorf("%s v%d: faltan campos %s", kind, version, strings.Join(missing, ", "))
+	}
+
+	var procs []map[string]json.RawMessage
+	if err := json.Unmarshal(root["procesos"], &procs); err != nil {
+		return fmt.Errorf("%s v%d: procesos inválido: %w", kind, version, err)
+	}
+	for i, p := range procs {
+		if missing := missingFields(p, schema.ProcRequired); len(missing) > 0 {
+			return fmt.Errorf("%s v%d: procesos[%d] sin campos %s", kind, version, i, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+func missingFields(obj map[string]json.RawMessage, required []string) []string {
+	var missing []string
+	for _, f := range required {
+		if _, ok := obj[f]; !ok {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+// CheckSnapshotSchemas lee ambos /proc al arrancar y devuelve un error claro
+// si algún módulo emite un formato que el daemon no soporta.
+func CheckSnapshotSchemas() error {
+	if _, err := ReadSysinfo(sysinfoPath); err != nil {
+		return fmt.Errorf("módulo sysinfo incompatible o no disponible: %w", err)
+	}
+	if _, err := ReadContInfo(continfoPath); err != nil {
+		return fmt.Errorf("módulo continfo incompatible o no disponible: %w", err)
+	}
+	return nil
+}
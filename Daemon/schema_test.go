@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSysinfoV4 = `{"schema_version": 4, "module_version": "1.6.0", "total_ram_kb": 1000, "free_ram_kb": 500,
+ "available_kb": 600, "ram_used_kb": 400, "total_procs": 1, "cpu_usage_pct": 10, "ts_ms": 1000,
+ "boottime_ns": 5, "cpu_time_unit": "ns", "procesos": [
+  {"pid": 1, "ppid": 0, "uid": 65534, "comm": "init", "rss_kb": 10, "vmsize_kb": 20, "state": "S",
+   "utime": 1, "stime": 1, "start_time_ns": 1, "ts_ms": 1000}]}`
+
+func TestValidateSnapshot(t *testing.T) {
+	cases := []struct {
+		name    string
+		kind    string
+		data    string
+		wantErr string
+	}{
+		{name: "v4 completo", kind: snapshotSysinfo, data: testSysinfoV4},
+		{
+			name:    "sin schema_version",
+			kind:    snapshotSysinfo,
+			data:    `{"module_version": "1.2.0", "procesos": []}`,
+			wantErr: "sin schema_version",
+		},
+		{
+			name:    "versión desconocida",
+			kind:    snapshotSysinfo,
+			data:    `{"schema_version": 99, "module_version": "9.9.9"}`,
+			wantErr: `schema_version 99 (módulo "9.9.9") no soportado`,
+		},
+		{
+			name:    "falta campo raíz",
+			kind:    snapshotSysinfo,
+			data:    strings.Replace(testSysinfoV4, `"boottime_ns": 5, `, "", 1),
+			wantErr: "faltan campos boottime_ns",
+		},
+		{
+			name:    "campo de proceso renombrado",
+			kind:    snapshotSysinfo,
+			data:    strings.Replace(testSysinfoV4, `"uid": 65534`, `"user": 65534`, 1),
+			wantErr: "procesos[0] sin campos uid",
+		},
+		{
+			name:    "continfo v1 sin procesos válidos",
+			kind:    snapshotContinfo,
+			data:    `{"schema_version": 1, "module_version": "1.1.0", "total_ram_kb": 1, "free_ram_kb": 1, "used_ram_kb": 0, "ts_ms": 1, "procesos": 3}`,
+			wantErr: "procesos inválido",
+		},
+		{name: "JSON roto", kind: snapshotSysinfo, data: `{"schema_version": 4,`, wantErr: "JSON inválido"},
+	}
+	for _, tc := range cases {
+		err := validateSnapshot(tc.kind, []byte(tc.data))
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: error inesperado: %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: error = %v, se esperaba %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+// El uid del módulo llega tal cual, incluido overflowuid para uids sin mapeo.
+func TestParseSysinfoUID(t *testing.T) {
+	si, err := ParseSysinfo("test", []byte(testSysinfoV4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(si.Procesos) != 1 || si.Procesos[0].UID != 65534 {
+		t.Errorf("procesos = %+v, se esperaba uid 65534", si.Procesos)
+	}
+}
+
+// Un /proc ausente (módulo sin cargar) se distingue de uno incompatible.
+func TestReadSnapshotMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := ReadSysinfo(filepath.Join(dir, "sysinfo")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("sysinfo ausente: error = %v, se esperaba ErrNotExist", err)
+	}
+	if _, err := ReadContInfo(filepath.Join(dir, "continfo")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("continfo ausente: error = %v, se esperaba ErrNotExist", err)
+	}
+
+	bad := filepath.Join(dir, "viejo")
+	if err := os.WriteFile(bad, []byte(`{"procesos": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSysinfo(bad); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Errorf("sysinfo incompatible: error = %v", err)
+	}
+}
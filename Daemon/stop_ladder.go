@@ -0,0 +1,405 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pasos de la escalera de detención
+const (
+	stopStepSigterm  = "SIGTERM"
+	stopStepSigkill  = "SIGKILL"
+	stopStepVerified = "VERIFIED"
+	stopStepRetry    = "RETRY"
+	stopStepFailed   = "FAILED"
+)
+
+// stopState es el avance de la detención de un contenedor entre ciclos.
+type stopState struct {
+	Info        ContainerInfo `json:"info"`
+	Reason      string        `json:"reason"`
+	Step        string        `json:"step"`
+	Attempt     int           `json:"attempt"`
+	StartedTsMs int64         `json:"started_ts_ms"`
+	StepTsMs    int64         `json:"step_ts_ms"`
+
+	// seq cambia en cada paso; quien actúa sobre una copia comprueba que el
+	// estado no haya avanzado mientras corría docker sin el lock
+	seq uint64
+}
+
+// StopCounters cuenta cuántas veces hizo falta cada paso.
+type StopCounters struct {
+	Requested     int `json:"requested"`
+	SigtermSent   int `json:"sigterm_sent"`
+	GoneAfterTerm int `json:"gone_after_sigterm"`
+	SigkillNeeded int `json:"sigkill_needed"`
+	GoneAfterKill int `json:"gone_after_sigkill"`
+	Retries       int `json:"retries"`
+	Failed        int `json:"failed"`
+	CommandErrors int `json:"command_errors"`
+}
+
+type stopEvent struct {
+	TsMs    int64
+	Info    ContainerInfo
+	Step    string
+	Attempt int
+	Detail  string
+}
+
+// stopLadder lleva las detenciones en curso. mu protege el estado; los
+// comandos docker se ejecutan siempre sin él.
+type stopLadder struct {
+	mu       sync.Mutex
+	exec     Executor
+	inFlight map[string]*stopState
+	timers   map[string]*time.Timer // SIGKILL al vencer la gracia de cada SIGTERM
+	counters StopCounters
+	events   []stopEvent
+}
+
+var stopper = newStopLadder(hostExecutor{})
+
+func newStopLadder(exec Executor) *stopLadder {
+	return &stopLadder{
+		exec:     exec,
+		inFlight: make(map[string]*stopState),
+		timers:   make(map[string]*time.Timer),
+	}
+}
+
+// Begin envía SIGTERM y deja el contenedor en seguimiento. Si ya se está
+// deteniendo no hace nada, así el siguiente ciclo no lo vuelve a intentar.
+func (l *stopLadder) Begin(c ContainerInfo, reason string) {
+	l.mu.Lock()
+	if _, ok := l.inFlight[c.ID]; ok {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now().UnixMilli()
+	st := &stopState{Info: c, Reason: reason, Step: stopStepSigterm, Attempt: 1, StartedTsMs: now, StepTsMs: now}
+	l.inFlight[c.ID] = st
+	l.counters.Requested++
+	snapshot := *st
+	l.mu.Unlock()
+
+	l.send(snapshot)
+}
+
+// IsStopping indica si el contenedor está en la escalera (no debe contarse como vivo).
+func (l *stopLadder) IsStopping(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.inFlight[id]
+	return ok
+}
+
+// send envía la señal del paso de st (una copia) y registra el resultado. Tras
+// un SIGTERM programa el SIGKILL para cuando venza la gracia.
+func (l *stopLadder) send(st stopState) {
+	detail := ""
+	if _, err := l.exec.Run(10*time.Second, "docker", "kill", "--signal", st.Step, st.Info.ID); err != nil {
+		// el contenedor puede haber terminado solo entre medio: se verifica después
+		detail = err.Error()
+		fmt.Printf("     (error enviando %s a %s: %v)\n", st.Step, st.Info.Name, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if detail != "" {
+		l.counters.CommandErrors++
+	}
+	switch st.Step {
+	case stopStepSigterm:
+		l.counters.SigtermSent++
+	case stopStepSigkill:
+		l.counters.SigkillNeeded++
+	}
+	l.eventLocked(&st, st.Step, detail)
+
+	if cur, ok := l.inFlight[st.Info.ID]; ok && cur.seq == st.seq && st.Step == stopStepSigterm {
+		id, seq := st.Info.ID, st.seq
+		grace := time.Duration(cfg.StopGraceSeconds) * time.Second
+		l.timers[id] = time.AfterFunc(grace-time.Since(time.UnixMilli(st.StepTsMs)), func() {
+			l.escalate(id, seq)
+		})
+	}
+}
+
+// escalate envía SIGKILL si el contenedor sigue en el mismo SIGTERM y vivo en
+// docker. Si ya no está (o docker ps falla) lo verifica el siguiente Advance.
+func (l *stopLadder) escalate(id string, seq uint64) {
+	l.mu.Lock()
+	cur, ok := l.inFlight[id]
+	pending := ok && cur.seq == seq && cur.Step == stopStepSigterm
+	l.mu.Unlock()
+	if !pending {
+		return
+	}
+
+	running, err := l.runningIDs()
+	if err != nil || !running[id] {
+		return
+	}
+
+	l.mu.Lock()
+	st, ok := l.stepLocked(id, seq, stopStepSigkill)
+	l.mu.Unlock()
+	if ok {
+		fmt.Printf("  %s sigue vivo tras %ds de gracia, enviando SIGKILL\n", st.Info.Name, cfg.StopGraceSeconds)
+		l.send(st)
+	}
+}
+
+// stepLocked pasa id al paso dado si nadie lo avanzó desde seq y devuelve la
+// copia con la que enviar la señal.
+func (l *stopLadder) stepLocked(id string, seq uint64, step string) (stopState, bool) {
+	cur, ok := l.inFlight[id]
+	if !ok || cur.seq != seq {
+		return stopState{}, false
+	}
+	l.stopTimerLocked(id)
+	cur.Step = step
+	cur.StepTsMs = time.Now().UnixMilli()
+	cur.seq++
+	return *cur, true
+}
+
+func (l *stopLadder) stopTimerLocked(id string) {
+	if t, ok := l.timers[id]; ok {
+		t.Stop()
+		delete(l.timers, id)
+	}
+}
+
+func (l *stopLadder) forgetLocked(id string) {
+	l.stopTimerLocked(id)
+	delete(l.inFlight, id)
+}
+
+func (l *stopLadder) eventLocked(st *stopState, step, detail string) {
+	l.events = append(l.events, stopEvent{
+		TsMs:    time.Now().UnixMilli(),
+		Info:    st.Info,
+		Step:    step,
+		Attempt: st.Attempt,
+		Detail:  detail,
+	})
+}
+
+// runningIDs lista los IDs completos de los contenedores en ejecución.
+func (l *stopLadder) runningIDs() (map[string]bool, error) {
+	out, err := l.exec.Run(5*time.Second,
+		"docker", "ps",
+		"--no-trunc",
+		"--filter", "status=running",
+		"--format", dockerPsFormat,
+	)
+	if err != nil {
+		return nil, err
+	}
+	running, err := parseDockerPs(out)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(running))
+	for _, c := range running {
+		ids[c.ID] = true
+	}
+	return ids, nil
+}
+
+// Advance avanza la escalera de cada contenedor en seguimiento. Un contenedor
+// está "ido" cuando no aparece en docker ps ni en el snapshot del kernel.
+// snap puede ser nil si este ciclo no se pudo leer continfo; si es anterior
+// al último paso se decide solo con docker ps. El SIGKILL tras
+// la gracia lo envía el timer de cada SIGTERM; aquí queda como respaldo.
+func (l *stopLadder) Advance(snap *ContInfoSnapshot) {
+	l.mu.Lock()
+	pending := make([]stopState, 0, len(l.inFlight))
+	for _, st := range l.inFlight {
+		pending = append(pending, *st)
+	}
+	l.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	runningIDs, err := l.runningIDs()
+	if err != nil {
+		fmt.Println("Error listando contenedores para verificar detenciones:", err)
+		return
+	}
+
+	grace := time.Duration(cfg.StopGraceSeconds) * time.Second
+	verifyTimeout := time.Duration(cfg.StopVerifySeconds) * time.Second
+	now := time.Now()
+
+	for _, st := range pending {
+		id := st.Info.ID
+		inDocker := runningIDs[id]
+		// un snapshot anterior a la señal todavía muestra el contenedor vivo
+		inKernel := snap != nil && snap.TsMs > st.StepTsMs && containerInSnapshot(*snap, id)
+		elapsed := now.Sub(time.UnixMilli(st.StepTsMs))
+
+		// sin snapshot del kernel este ciclo solo se puede confiar en docker
+		if !inDocker && !inKernel {
+			l.mu.Lock()
+			if cur, ok := l.inFlight[id]; ok && cur.seq == st.seq {
+				if st.Step == stopStepSigterm {
+					l.counters.GoneAfterTerm++
+				} else {
+					l.counters.GoneAfterKill++
+				}
+				l.eventLocked(cur, stopStepVerified, fmt.Sprintf("detenido tras %s", st.Step))
+				fmt.Printf("  Contenedor %s detenido y verificado (%s)\n", st.Info.Name, st.Step)
+				l.forgetLocked(id)
+			}
+			l.mu.Unlock()
+			continue
+		}
+
+		switch st.Step {
+		case stopStepSigterm:
+			if elapsed < grace {
+				continue
+			}
+			l.mu.Lock()
+			next, ok := l.stepLocked(id, st.seq, stopStepSigkill)
+			l.mu.Unlock()
+			if ok {
+				fmt.Printf("  %s sigue vivo tras %s de gracia, enviando SIGKILL\n", st.Info.Name, grace)
+				l.send(next)
+			}
+
+		case stopStepSigkill:
+			if elapsed < verifyTimeout {
+				continue
+			}
+			l.mu.Lock()
+			cur, ok := l.inFlight[id]
+			if !ok || cur.seq != st.seq {
+				l.mu.Unlock()
+				continue
+			}
+			if cur.Attempt >= cfg.StopMaxRetries {
+				l.counters.Failed++
+				detail := fmt.Sprintf("sigue presente (docker=%v kernel=%v)", inDocker, inKernel)
+				l.eventLocked(cur, stopStepFailed, detail)
+				fmt.Printf("  No se pudo detener %s tras %d intentos: %s\n", st.Info.Name, cur.Attempt, detail)
+				l.forgetLocked(id)
+				l.mu.Unlock()
+				continue
+			}
+			cur.Attempt++
+			l.counters.Retries++
+			l.eventLocked(cur, stopStepRetry, "")
+			fmt.Printf("  Reintentando detener %s (intento %d)\n", st.Info.Name, cur.Attempt)
+			next, ok := l.stepLocked(id, st.seq, stopStepSigterm)
+			l.mu.Unlock()
+			if ok {
+				l.send(next)
+			}
+		}
+	}
+}
+
+// containerInSnapshot busca el ID completo en las cmdline del snapshot
+// (containerd-shim lleva "-id <ID>").
+func containerInSnapshot(snap ContInfoSnapshot, fullID string) bool {
+	for _, p := range snap.Procesos {
+		if strings.Contains(p.CmdlineOrContID, fullID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Status devuelve contadores y contenedores en seguimiento (para la API).
+func (l *stopLadder) Status() (StopCounters, []stopState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]stopState, 0, len(l.inFlight))
+	for _, st := range l.inFlight {
+		list = append(list, *st)
+	}
+	return l.counters, list
+}
+
+func (l *stopLadder) drainEvents() []stopEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := l.events
+	l.events = nil
+	return out
+}
+
+func CreateStopEventsTable(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS stop_events (
+        id              INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms           BIGINT NOT NULL,
+        container_id    VARCHAR(128) NOT NULL,
+        container_name  VARCHAR(128),
+        step            VARCHAR(16) NOT NULL,
+        attempt         INT NOT NULL,
+        detail          TEXT,
+        created_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla stop_events: %w", err)
+	}
+
+	idx := `CREATE INDEX IF NOT EXISTS idx_stop_events_ts ON stop_events(ts_ms);`
+	if _, err := db.Exec(idx); err != nil {
+		return fmt.Errorf("error creando índice idx_stop_events_ts: %w", err)
+	}
+	return nil
+}
+
+// InsertStopEvents persiste los pasos de la escalera ocurridos desde el último ciclo.
+func InsertStopEvents(db *sql.DB) error {
+	events := stopper.drainEvents()
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error iniciando transacción para stop_events: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+        INSERT INTO stop_events (
+            ts_ms,
+            container_id,
+            container_name,
+            step,
+            attempt,
+            detail
+        ) VALUES (?, ?, ?, ?, ?, ?);
+    `)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error preparando INSERT en stop_events: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, ev := range events {
+		if _, err := stmt.Exec(ev.TsMs, ev.Info.ID, ev.Info.Name, ev.Step, ev.Attempt, ev.Detail); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error insertando paso %s de %s en stop_events: %w", ev.Step, ev.Info.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error haciendo commit en stop_events: %w", err)
+	}
+	return nil
+}
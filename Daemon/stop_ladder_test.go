@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDocker simula docker ps y docker kill para la escalera de detención.
+type fakeDocker struct {
+	mu      sync.Mutex
+	running map[string]bool
+	kills   []string
+	psGate  chan struct{} // si no es nil, docker ps espera hasta que se cierre
+}
+
+func (d *fakeDocker) Run(timeout time.Duration, name string, args ...string) (string, error) {
+	switch args[0] {
+	case "ps":
+		if d.psGate != nil {
+			<-d.psGate
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		var out strings.Builder
+		for id := range d.running {
+			out.WriteString(id + "\t" + id + "\timg\t2024-01-01 00:00:00 +0000 UTC\t\n")
+		}
+		return out.String(), nil
+	case "kill":
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.kills = append(d.kills, args[2]+" "+args[3])
+		return "", nil
+	}
+	return "", nil
+}
+
+func (d *fakeDocker) killed() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.kills...)
+}
+
+func TestStopLadderSigkillAtGrace(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.StopGraceSeconds = 1
+	cfg.StopVerifySeconds = 5
+	cfg.StopMaxRetries = 2
+
+	d := &fakeDocker{running: map[string]bool{"c1": true}}
+	l := newStopLadder(d)
+	l.Begin(ContainerInfo{ID: "c1", Name: "c1"}, "prueba")
+
+	// sin ningún Advance, el SIGKILL sale al vencer la gracia
+	deadline := time.Now().Add(3 * time.Second)
+	for len(d.killed()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := d.killed(); len(got) != 2 || got[0] != "SIGTERM c1" || got[1] != "SIGKILL c1" {
+		t.Fatalf("señales = %v, se esperaba SIGTERM y SIGKILL", got)
+	}
+	counters, list := l.Status()
+	if counters.SigkillNeeded != 1 || len(list) != 1 || list[0].Step != stopStepSigkill {
+		t.Errorf("contadores = %+v, estado = %+v", counters, list)
+	}
+
+	d.mu.Lock()
+	delete(d.running, "c1")
+	d.mu.Unlock()
+	l.Advance(nil)
+	if counters, _ := l.Status(); counters.GoneAfterKill != 1 || l.IsStopping("c1") {
+		t.Errorf("tras verificar: contadores = %+v", counters)
+	}
+}
+
+// Advance no retiene el lock mientras espera a docker.
+func TestStopLadderAdvanceUnlockedDuringDocker(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.StopGraceSeconds = 60
+
+	d := &fakeDocker{running: map[string]bool{"c1": true}}
+	l := newStopLadder(d)
+	l.Begin(ContainerInfo{ID: "c1", Name: "c1"}, "prueba")
+
+	d.psGate = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		l.Advance(nil)
+		close(done)
+	}()
+
+	checked := make(chan bool)
+	go func() { checked <- l.IsStopping("c1") }()
+	select {
+	case stopping := <-checked:
+		if !stopping {
+			t.Errorf("c1 debería seguir en la escalera")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("IsStopping quedó bloqueado mientras docker ps corría")
+	}
+	close(d.psGate)
+	<-done
+}
+
+// Un snapshot del kernel tomado antes del SIGTERM no cuenta: el contenedor
+// que ya no está en docker ps se da por detenido sin pasar a SIGKILL.
+func TestStopLadderIgnoresStaleKernelSnapshot(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.StopGraceSeconds = 0
+	cfg.StopVerifySeconds = 5
+	cfg.StopMaxRetries = 2
+
+	const id = "c1aaaaaaaaaa"
+	shim := ContProcess{CmdlineOrContID: "containerd-shim -namespace moby -id " + id}
+
+	cases := []struct {
+		name     string
+		snapAge  int64 // ms respecto del SIGTERM (negativo = anterior)
+		wantGone bool
+	}{
+		{name: "snapshot anterior a la señal", snapAge: -500, wantGone: true},
+		{name: "snapshot posterior a la señal", snapAge: 500, wantGone: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &fakeDocker{running: map[string]bool{}}
+			l := newStopLadder(d)
+			l.Begin(ContainerInfo{ID: id, Name: "c1"}, "prueba")
+			_, list := l.Status()
+
+			snap := &ContInfoSnapshot{TsMs: list[0].StepTsMs + tc.snapAge, Procesos: []ContProcess{shim}}
+			l.Advance(snap)
+
+			counters, _ := l.Status()
+			if gone := counters.GoneAfterTerm == 1; gone != tc.wantGone {
+				t.Errorf("detenido = %v, se esperaba %v (contadores %+v)", gone, tc.wantGone, counters)
+			}
+			if tc.wantGone && counters.SigkillNeeded != 0 {
+				t.Errorf("SIGKILL enviado a un contenedor que ya había salido")
+			}
+		})
+	}
+}
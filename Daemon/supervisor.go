@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Políticas de reinicio de un proceso supervisado
+const (
+	restartNever     = "never"
+	restartOnFailure = "on-failure"
+	restartAlways    = "always"
+)
+
+// Estados de un proceso supervisado
+const (
+	procStateRunning = "running"
+	procStateBackoff = "backoff"
+	procStateExited  = "exited"
+	procStateFailed  = "failed"
+	procStateStopped = "stopped"
+)
+
+// ProcessSpec describe un proceso hijo administrado por el supervisor.
+type ProcessSpec struct {
+	Name    string
+	Command string
+	Args    []string
+	Dir     string
+	Env     []string // variables extra además del entorno del daemon
+
+	Restart     string        // never, on-failure, always
+	Timeout     time.Duration // 0 = sin límite
+	BackoffMin  time.Duration
+	BackoffMax  time.Duration
+	MaxRestarts int // 0 = sin límite
+
+	// Si el proceso corrió al menos esto, el backoff vuelve al mínimo
+	StableAfter time.Duration
+}
+
+// ProcessStatus es el estado visible por la API.
+type ProcessStatus struct {
+	Name          string `json:"name"`
+	Command       string `json:"command"`
+	State         string `json:"state"`
+	PID           int    `json:"pid,omitempty"`
+	Restarts      int    `json:"restarts"`
+	LastExitCode  int    `json:"last_exit_code"`
+	LastError     string `json:"last_error,omitempty"`
+	StartedTsMs   int64  `json:"started_ts_ms,omitempty"`
+	ExitedTsMs    int64  `json:"exited_ts_ms,omitempty"`
+	NextStartTsMs int64  `json:"next_start_ts_ms,omitempty"`
+}
+
+type supervisedProcess struct {
+	spec   ProcessSpec
+	status ProcessStatus
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// processSupervisor lanza procesos hijos, reenvía su salida línea a línea al
+// logger, aplica timeouts y los reinicia con backoff exponencial.
+type processSupervisor struct {
+	mu    sync.Mutex
+	procs map[string]*supervisedProcess
+	order []string
+}
+
+var supervisor = &processSupervisor{procs: make(map[string]*supervisedProcess)}
+
+// Tiempo entre SIGTERM y SIGKILL al cancelar un proceso
+const processKillDelay = 5 * time.Second
+
+// register publica el proceso ya con su cancel, así Stop nunca ve uno a medio armar.
+func (s *processSupervisor) register(spec ProcessSpec) (*supervisedProcess, context.Context, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.procs[spec.Name]; ok && isActiveProcState(p.status.State) {
+		return nil, nil, fmt.Errorf("el proceso %s ya está en ejecución", spec.Name)
+	}
+	if spec.Restart == "" {
+		spec.Restart = restartNever
+	}
+	if spec.BackoffMin <= 0 {
+		spec.BackoffMin = time.Second
+	}
+	if spec.BackoffMax < spec.BackoffMin {
+		spec.BackoffMax = spec.BackoffMin
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &supervisedProcess{
+		spec:   spec,
+		status: ProcessStatus{Name: spec.Name, Command: spec.Command, State: procStateRunning},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if _, ok := s.procs[spec.Name]; !ok {
+		s.order = append(s.order, spec.Name)
+	}
+	s.procs[spec.Name] = p
+	return p, ctx, nil
+}
+
+func isActiveProcState(state string) bool {
+	return state == procStateRunning || state == procStateBackoff
+}
+
+// Start lanza el proceso en segundo plano con su política de reinicio.
+func (s *processSupervisor) Start(spec ProcessSpec) error {
+	p, ctx, err := s.register(spec)
+	if err != nil {
+		return err
+	}
+	go s.loop(ctx, p)
+	return nil
+}
+
+// Run ejecuta el proceso una vez y espera a que termine (con su Timeout).
+func (s *processSupervisor) Run(spec ProcessSpec) error {
+	spec.Restart = restartNever
+	p, ctx, err := s.register(spec)
+	if err != nil {
+		return err
+	}
+	s.loop(ctx, p)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.status.State != procStateExited {
+		return fmt.Errorf("%s: %s", spec.Name, p.status.LastError)
+	}
+	return nil
+}
+
+func (s *processSupervisor) loop(ctx context.Context, p *supervisedProcess) {
+	defer close(p.done)
+	defer p.cancel()
+
+	backoff := p.spec.BackoffMin
+	for {
+		started := time.Now()
+		err := s.runOnce(ctx, p)
+		ranFor := time.Since(started)
+
+		s.mu.Lock()
+		st := &p.status
+		st.PID = 0
+		st.ExitedTsMs = time.Now().UnixMilli()
+		st.LastExitCode = exitCode(err)
+		st.LastError = ""
+		if err != nil {
+			st.LastError = err.Error()
+		}
+
+		if ctx.Err() != nil {
+			st.State = procStateStopped
+			s.mu.Unlock()
+			logger.Info("proceso detenido", "proceso", p.spec.Name)
+			return
+		}
+
+		if !shouldRestart(p.spec, err, st.Restarts) {
+			st.State = procStateExited
+			if err != nil {
+				st.State = procStateFailed
+			}
+			s.mu.Unlock()
+			if err != nil {
+				logger.Error("proceso terminó con error", "proceso", p.spec.Name, "error", err)
+			} else {
+				logger.Info("proceso finalizado", "proceso", p.spec.Name)
+			}
+			return
+		}
+
+		if p.spec.StableAfter > 0 && ranFor >= p.spec.StableAfter {
+			backoff = p.spec.BackoffMin
+		}
+		st.State = procStateBackoff
+		st.Restarts++
+		st.NextStartTsMs = time.Now().Add(backoff).UnixMilli()
+		s.mu.Unlock()
+
+		logger.Warn("proceso terminó, se reinicia",
+			"proceso", p.spec.Name, "error", err, "corrió", ranFor.Round(time.Millisecond), "espera", backoff)
+
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			p.status.State = procStateStopped
+			p.status.NextStartTsMs = 0
+			s.mu.Unlock()
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = nextBackoff(p.spec, backoff)
+	}
+}
+
+// shouldRestart aplica la política de reinicio tras una salida.
+func shouldRestart(spec ProcessSpec, err error, restarts int) bool {
+	restart := spec.Restart == restartAlways ||
+		(spec.Restart == restartOnFailure && err != nil)
+	return restart && (spec.MaxRestarts <= 0 || restarts < spec.MaxRestarts)
+}
+
+// nextBackoff duplica la espera hasta BackoffMax.
+func nextBackoff(spec ProcessSpec, backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > spec.BackoffMax {
+		backoff = spec.BackoffMax
+	}
+	return backoff
+}
+
+// runOnce ejecuta una vez el proceso y reenvía stdout/stderr al logger.
+func (s *processSupervisor) runOnce(ctx context.Context, p *supervisedProcess) error {
+	runCtx := ctx
+	if p.spec.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, p.spec.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(runCtx, p.spec.Command, p.spec.Args...)
+	cmd.Dir = p.spec.Dir
+	if len(p.spec.Env) > 0 {
+		cmd.Env = append(os.Environ(), p.spec.Env...)
+	}
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = processKillDelay
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error iniciando %s: %w", p.spec.Command, err)
+	}
+
+	s.mu.Lock()
+	p.status.State = procStateRunning
+	p.status.PID = cmd.Process.Pid
+	p.status.StartedTsMs = time.Now().UnixMilli()
+	p.status.NextStartTsMs = 0
+	s.mu.Unlock()
+	logger.Info("proceso iniciado", "proceso", p.spec.Name, "pid", cmd.Process.Pid)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go streamLines(&wg, p.spec.Name, "stdout", stdout)
+	go streamLines(&wg, p.spec.Name, "stderr", stderr)
+	wg.Wait()
+
+	err = cmd.Wait()
+	if runCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("tiempo límite de %s excedido: %w", p.spec.Timeout, err)
+	}
+	return err
+}
+
+func streamLines(wg *sync.WaitGroup, name, stream string, r io.Reader) {
+	defer wg.Done()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		logger.Info(scanner.Text(), "proceso", name, "stream", stream)
+	}
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// Stop cancela el proceso (SIGTERM y luego SIGKILL) y espera a que termine.
+func (s *processSupervisor) Stop(name string) {
+	s.mu.Lock()
+	p, ok := s.procs[name]
+	var cancel context.CancelFunc
+	if ok {
+		cancel = p.cancel
+	}
+	s.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-p.done
+}
+
+// StopAll detiene todos los procesos supervisados.
+func (s *processSupervisor) StopAll() {
+	s.mu.Lock()
+	names := append([]string(nil), s.order...)
+	s.mu.Unlock()
+	for _, name := range names {
+		s.Stop(name)
+	}
+}
+
+func (s *processSupervisor) Status() []ProcessStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]ProcessStatus, 0, len(s.order))
+	for _, name := range s.order {
+		out = append(out, s.procs[name].status)
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShouldRestart(t *testing.T) {
+	fail := errors.New("exit status 1")
+	cases := []struct {
+		name     string
+		spec     ProcessSpec
+		err      error
+		restarts int
+		want     bool
+	}{
+		{"never con error", ProcessSpec{Restart: restartNever}, fail, 0, false},
+		{"on-failure con error", ProcessSpec{Restart: restartOnFailure}, fail, 0, true},
+		{"on-failure sin error", ProcessSpec{Restart: restartOnFailure}, nil, 0, false},
+		{"always sin error", ProcessSpec{Restart: restartAlways}, nil, 0, true},
+		{"always bajo el máximo", ProcessSpec{Restart: restartAlways, MaxRestarts: 3}, nil, 2, true},
+		{"always en el máximo", ProcessSpec{Restart: restartAlways, MaxRestarts: 3}, fail, 3, false},
+		{"sin límite", ProcessSpec{Restart: restartAlways}, fail, 1000, true},
+	}
+	for _, tc := range cases {
+		if got := shouldRestart(tc.spec, tc.err, tc.restarts); got != tc.want {
+			t.Errorf("%s: shouldRestart = %v, se esperaba %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	spec := ProcessSpec{BackoffMin: time.Second, BackoffMax: 5 * time.Second}
+	cases := []struct {
+		cur  time.Duration
+		want time.Duration
+	}{
+		{time.Second, 2 * time.Second},
+		{2 * time.Second, 4 * time.Second},
+		{4 * time.Second, 5 * time.Second},
+		{5 * time.Second, 5 * time.Second},
+	}
+	for _, tc := range cases {
+		if got := nextBackoff(spec, tc.cur); got != tc.want {
+			t.Errorf("nextBackoff(%s) = %s, se esperaba %s", tc.cur, got, tc.want)
+		}
+	}
+}
+
+// Run corta el proceso al vencer el timeout y reintenta hasta MaxRestarts.
+func TestSupervisorRun(t *testing.T) {
+	cases := []struct {
+		name         string
+		spec         ProcessSpec
+		wantErr      string
+		wantState    string
+		wantRestarts int
+	}{
+		{
+			name:      "termina bien",
+			spec:      ProcessSpec{Name: "ok", Command: "sh", Args: []string{"-c", "echo hola"}},
+			wantState: procStateExited,
+		},
+		{
+			name:      "timeout",
+			spec:      ProcessSpec{Name: "lento", Command: "sleep", Args: []string{"5"}, Timeout: 100 * time.Millisecond},
+			wantErr:   "tiempo límite",
+			wantState: procStateFailed,
+		},
+		{
+			name:      "falla",
+			spec:      ProcessSpec{Name: "falla", Command: "false"},
+			wantErr:   "exit status 1",
+			wantState: procStateFailed,
+		},
+	}
+	for _, tc := range cases {
+		s := &processSupervisor{procs: make(map[string]*supervisedProcess)}
+		start := time.Now()
+		err := s.Run(tc.spec)
+		if tc.wantErr == "" && err != nil {
+			t.Errorf("%s: error inesperado: %v", tc.name, err)
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%s: error = %v, se esperaba %q", tc.name, err, tc.wantErr)
+		}
+		if time.Since(start) > 3*time.Second {
+			t.Errorf("%s: Run tardó %s", tc.name, time.Since(start))
+		}
+		st := s.Status()[0]
+		if st.State != tc.wantState || st.Restarts != tc.wantRestarts {
+			t.Errorf("%s: estado = %s reinicios = %d, se esperaba %s y %d",
+				tc.name, st.State, st.Restarts, tc.wantState, tc.wantRestarts)
+		}
+	}
+}
+
+// Con on-failure el proceso se reinicia con backoff hasta MaxRestarts, y Stop
+// sobre un proceso ya terminado no bloquea.
+func TestSupervisorRestartsWithBackoff(t *testing.T) {
+	s := &processSupervisor{procs: make(map[string]*supervisedProcess)}
+	spec := ProcessSpec{
+		Name: "reintenta", Command: "false", Restart: restartOnFailure,
+		BackoffMin: 10 * time.Millisecond, BackoffMax: 20 * time.Millisecond, MaxRestarts: 3,
+	}
+	if err := s.Start(spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(spec); err == nil {
+		t.Errorf("se esperaba error al lanzar dos veces el mismo proceso")
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if st := s.Status()[0]; !isActiveProcState(st.State) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	st := s.Status()[0]
+	if st.State != procStateFailed || st.Restarts != 3 || st.LastExitCode != 1 {
+		t.Errorf("estado = %+v, se esperaba failed tras 3 reinicios", st)
+	}
+	s.Stop("reintenta")
+	s.Stop("inexistente")
+}
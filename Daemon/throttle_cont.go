@@ -0,0 +1,387 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Acciones posibles sobre un contenedor de alto consumo en exceso
+const (
+	enforceActionStop         = "stop"
+	enforceActionCgroup       = "cgroup"
+	enforceActionDockerUpdate = "docker-update"
+	enforceActionPause        = "pause"
+)
+
+// Período usado al escribir cpu.max (microsegundos)
+const cgroupCPUPeriodUsec = 100000
+
+// throttledContainer recuerda qué se aplicó y cómo deshacerlo. Se persiste en
+// orchestrator_state para poder liberar los contenedores tras un reinicio.
+type throttledContainer struct {
+	Info        ContainerInfo `json:"info"`
+	Action      string        `json:"action"`
+	AppliedTsMs int64         `json:"applied_ts_ms"`
+	ActionRowID int64         `json:"action_row_id"`
+
+	// valores originales para restaurar
+	PrevCPUMax     string `json:"prev_cpu_max,omitempty"`
+	PrevMemHigh    string `json:"prev_mem_high,omitempty"`
+	PrevNanoCPUs   int64  `json:"prev_nano_cpus,omitempty"`
+	PrevMemoryByte int64  `json:"prev_memory_bytes,omitempty"`
+}
+
+// Clave de los contenedores limitados en orchestrator_state
+const throttledStateKey = "throttled"
+
+// throttled: contenedores limitados actualmente, por ID completo
+var throttled = make(map[string]*throttledContainer)
+
+// saveThrottledState persiste los contenedores limitados.
+func saveThrottledState() {
+	if err := writer.Do(func(db *sql.DB) error {
+		return SaveOrchestratorState(db, throttledStateKey, throttled)
+	}); err != nil {
+		fmt.Println("Error guardando contenedores limitados:", err)
+	}
+}
+
+// pendingAction es una acción cuyo "después" todavía no se midió.
+type pendingAction struct {
+	ContainerID string
+	TsMs        int64 // momento de la acción: el "después" debe ser posterior
+}
+
+// acciones cuyo "después" se completa con la primera muestra de cgroup
+// posterior a la acción: id de fila -> acción
+var pendingAfter = make(map[int64]pendingAction)
+
+// throttleContainer aplica la acción configurada y la registra con las métricas previas.
+func throttleContainer(c ContainerInfo, reason string, before CgroupStats, beforeUsage CgroupUsage) error {
+	tc := &throttledContainer{Info: c, Action: cfg.EnforceAction, AppliedTsMs: time.Now().UnixMilli()}
+
+	fmt.Printf("  -> Limitando contenedor %s (%s) con %s [motivo: %s]\n",
+		c.Name, shortID(c.ID), tc.Action, reason)
+
+	var err error
+	switch tc.Action {
+	case enforceActionCgroup:
+		err = applyCgroupLimits(tc)
+	case enforceActionDockerUpdate:
+		err = applyDockerUpdate(tc)
+	case enforceActionPause:
+		_, err = runCmd(10*time.Second, "docker", "pause", c.ID)
+	default:
+		err = fmt.Errorf("acción de limitación no soportada: %s", tc.Action)
+	}
+	if err != nil {
+		return fmt.Errorf("no se pudo limitar %s: %w", c.Name, err)
+	}
+
+	var id int64
+	err = writer.Do(func(db *sql.DB) error {
+		id, err = InsertEnforcementAction(db, tc.AppliedTsMs, c, tc.Action, "apply", reason, before, beforeUsage)
+		return err
+	})
+	if err != nil {
+		fmt.Println("Error InsertEnforcementAction:", err)
+	} else {
+		tc.ActionRowID = id
+		pendingAfter[id] = pendingAction{ContainerID: c.ID, TsMs: tc.AppliedTsMs}
+	}
+
+	throttled[c.ID] = tc
+	return nil
+}
+
+// releaseContainer deshace la limitación aplicada.
+func releaseContainer(tc *throttledContainer, reason string, before CgroupStats, beforeUsage CgroupUsage) error {
+	fmt.Printf("  -> Liberando contenedor %s (%s) de %s [motivo: %s]\n",
+		tc.Info.Name, shortID(tc.Info.ID), tc.Action, reason)
+
+	var err error
+	switch tc.Action {
+	case enforceActionCgroup:
+		err = releaseCgroupLimits(tc)
+	case enforceActionDockerUpdate:
+		err = releaseDockerUpdate(tc)
+	case enforceActionPause:
+		_, err = runCmd(10*time.Second, "docker", "unpause", tc.Info.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("no se pudo liberar %s: %w", tc.Info.Name, err)
+	}
+
+	delete(throttled, tc.Info.ID)
+
+	var id int64
+	releasedTsMs := time.Now().UnixMilli()
+	err = writer.Do(func(db *sql.DB) error {
+		id, err = InsertEnforcementAction(db, releasedTsMs, tc.Info, tc.Action, "release", reason, before, beforeUsage)
+		return err
+	})
+	if err != nil {
+		fmt.Println("Error InsertEnforcementAction:", err)
+	} else {
+		pendingAfter[id] = pendingAction{ContainerID: tc.Info.ID, TsMs: releasedTsMs}
+	}
+	return nil
+}
+
+func containerStatus(id string) string {
+	out, err := runCmd(3*time.Second, "docker", "inspect", "--format", "{{.State.Status}}", id)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+func applyCgroupLimits(tc *throttledContainer) error {
+	dir, err := containerCgroupDir(cgroupRoot, tc.Info.ID)
+	if err != nil {
+		return err
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "cpu.max")); err == nil {
+		tc.PrevCPUMax = strings.TrimSpace(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "memory.high")); err == nil {
+		tc.PrevMemHigh = strings.TrimSpace(string(data))
+	}
+
+	quota := int64(cfg.ThrottleCPUCores * cgroupCPUPeriodUsec)
+	cpuMax := fmt.Sprintf("%d %d", quota, cgroupCPUPeriodUsec)
+	if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(cpuMax), 0644); err != nil {
+		return fmt.Errorf("error escribiendo cpu.max: %w", err)
+	}
+
+	memHigh := strconv.FormatUint(cfg.ThrottleMemoryMB*1024*1024, 10)
+	if err := os.WriteFile(filepath.Join(dir, "memory.high"), []byte(memHigh), 0644); err != nil {
+		return fmt.Errorf("error escribiendo memory.high: %w", err)
+	}
+	return nil
+}
+
+func releaseCgroupLimits(tc *throttledContainer) error {
+	dir, err := containerCgroupDir(cgroupRoot, tc.Info.ID)
+	if err != nil {
+		return err
+	}
+
+	cpuMax := tc.PrevCPUMax
+	if cpuMax == "" {
+		cpuMax = fmt.Sprintf("max %d", cgroupCPUPeriodUsec)
+	}
+	memHigh := tc.PrevMemHigh
+	if memHigh == "" {
+		memHigh = "max"
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(cpuMax), 0644); err != nil {
+		return fmt.Errorf("error restaurando cpu.max: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "memory.high"), []byte(memHigh), 0644); err != nil {
+		return fmt.Errorf("error restaurando memory.high: %w", err)
+	}
+	return nil
+}
+
+func applyDockerUpdate(tc *throttledContainer) error {
+	out, err := runCmd(5*time.Second, "docker", "inspect",
+		"--format", "{{.HostConfig.NanoCpus}} {{.HostConfig.Memory}}", tc.Info.ID)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 2 {
+		tc.PrevNanoCPUs, _ = strconv.ParseInt(fields[0], 10, 64)
+		tc.PrevMemoryByte, _ = strconv.ParseInt(fields[1], 10, 64)
+	}
+
+	_, err = runCmd(10*time.Second, "docker", "update",
+		"--cpus", strconv.FormatFloat(cfg.ThrottleCPUCores, 'f', 2, 64),
+		"--memory", fmt.Sprintf("%dm", cfg.ThrottleMemoryMB),
+		"--memory-swap", "-1",
+		tc.Info.ID,
+	)
+	return err
+}
+
+func releaseDockerUpdate(tc *throttledContainer) error {
+	// NanoCPUs 0 en docker update significa "sin cambios", no "sin límite":
+	// si no tenía límite se sube a la cantidad de CPUs del host.
+	cpus := float64(tc.PrevNanoCPUs) / 1e9
+	if tc.PrevNanoCPUs <= 0 {
+		cpus = float64(runtime.NumCPU())
+	}
+	args := []string{"update",
+		"--cpus", strconv.FormatFloat(cpus, 'f', 2, 64),
+	}
+	// docker update no permite quitar el límite de memoria: si no tenía,
+	// se sube a la RAM total del host (última muestra de sysinfo), que en la
+	// práctica equivale a no tener.
+	mem := tc.PrevMemoryByte
+	if mem <= 0 {
+		if si, _, _, _ := collected.latest(); si != nil && si.TotalRAMKB > 0 {
+			mem = int64(si.TotalRAMKB) * 1024
+		}
+	}
+	if mem > 0 {
+		args = append(args, "--memory", strconv.FormatInt(mem, 10))
+	}
+	args = append(args, tc.Info.ID)
+
+	_, err := runCmd(10*time.Second, "docker", args...)
+	return err
+}
+
+// reconcileThrottled libera los contenedores limitados que ya no hacen falta:
+// cuando ya hay espacio en su clase o cuando su uso bajó de ReleaseBelowPctOfCap
+// respecto al límite aplicado. Los que ya no existen se olvidan.
+func reconcileThrottled(running map[string]ContainerInfo, unthrottledHigh int,
+	stats map[string]CgroupStats, usage map[string]CgroupUsage) {
+
+	for id, tc := range throttled {
+		if _, ok := running[id]; !ok {
+			// docker ps --filter status=running no muestra los pausados
+			if tc.Action != enforceActionPause || containerStatus(id) != "paused" {
+				delete(throttled, id)
+				continue
+			}
+		}
+
+		st := stats[id]
+		u := usage[id]
+		reason := ""
+
+		switch {
+		case unthrottledHigh < desiredCount(classHigh):
+			reason = "hay espacio para contenedores de alto consumo"
+		case tc.Action != enforceActionPause && belowReleaseThreshold(st, u):
+			reason = fmt.Sprintf("uso bajo %.0f%% del límite", cfg.ReleaseBelowPctOfCap)
+		}
+		if reason == "" {
+			continue
+		}
+
+		if err := releaseContainer(tc, reason, st, u); err != nil {
+			fmt.Println("   ", err)
+			continue
+		}
+		unthrottledHigh++
+	}
+}
+
+// belowReleaseThreshold indica si el uso bajó de ReleaseBelowPctOfCap respecto
+// al límite aplicado. Sin tasa de CPU (primera muestra o contenedor sin leer)
+// no hay con qué comparar y no se libera.
+func belowReleaseThreshold(st CgroupStats, u CgroupUsage) bool {
+	if !u.HasDelta {
+		return false
+	}
+	frac := cfg.ReleaseBelowPctOfCap / 100.0
+
+	// u.CPUPct está normalizado por cantidad de CPUs; el límite está en núcleos
+	cpuCores := u.CPUPct / 100.0 * float64(runtime.NumCPU())
+	cpuOK := cpuCores < cfg.ThrottleCPUCores*frac
+	memOK := float64(st.MemCurrentBytes) < float64(cfg.ThrottleMemoryMB*1024*1024)*frac
+	return cpuOK && memOK
+}
+
+// applyPendingAfter completa las métricas "después" de las acciones pendientes.
+// Si el colector de cgroup todavía no leyó después de la acción la fila sigue
+// pendiente: la muestra actual sería la misma que el "antes".
+func applyPendingAfter(stats map[string]CgroupStats, usage map[string]CgroupUsage) {
+	for rowID, p := range pendingAfter {
+		st, ok := stats[p.ContainerID]
+		if !ok {
+			// el contenedor ya no existe; no hay "después" que medir
+			delete(pendingAfter, rowID)
+			continue
+		}
+		if st.TsMs <= p.TsMs {
+			continue
+		}
+		u := usage[p.ContainerID]
+		if err := writer.Do(func(db *sql.DB) error {
+			return UpdateEnforcementActionAfter(db, rowID, st, u)
+		}); err != nil {
+			fmt.Println("Error UpdateEnforcementActionAfter:", err)
+			continue
+		}
+		delete(pendingAfter, rowID)
+	}
+}
+
+func CreateEnforcementActionsTable(db *sql.DB) error {
+	ddl := `
+    CREATE TABLE IF NOT EXISTS enforcement_actions (
+        id              INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts_ms           BIGINT NOT NULL,
+        container_id    VARCHAR(128) NOT NULL,
+        container_name  VARCHAR(128),
+        action          VARCHAR(32) NOT NULL,
+        phase           VARCHAR(16) NOT NULL,
+        reason          TEXT,
+        before_cpu_pct  REAL,
+        before_mem_kb   BIGINT,
+        after_ts_ms     BIGINT,
+        after_cpu_pct   REAL,
+        after_mem_kb    BIGINT,
+        created_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("error creando tabla enforcement_actions: %w", err)
+	}
+
+	idx := `CREATE INDEX IF NOT EXISTS idx_enf_actions_ts ON enforcement_actions(ts_ms);`
+	if _, err := db.Exec(idx); err != nil {
+		return fmt.Errorf("error creando índice idx_enf_actions_ts: %w", err)
+	}
+	return nil
+}
+
+func InsertEnforcementAction(db *sql.DB, tsMs int64, c ContainerInfo, action, phase, reason string,
+	before CgroupStats, beforeUsage CgroupUsage) (int64, error) {
+
+	res, err := db.Exec(`
+        INSERT INTO enforcement_actions (
+            ts_ms,
+            container_id,
+            container_name,
+            action,
+            phase,
+            reason,
+            before_cpu_pct,
+            before_mem_kb
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+    `, tsMs, c.ID, c.Name, action, phase, reason, beforeUsage.CPUPct, int64(before.MemCurrentBytes/1024))
+	if err != nil {
+		return 0, fmt.Errorf("error insertando en enforcement_actions: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("no se pudo obtener LastInsertId en enforcement_actions: %w", err)
+	}
+	return id, nil
+}
+
+func UpdateEnforcementActionAfter(db *sql.DB, rowID int64, after CgroupStats, afterUsage CgroupUsage) error {
+	_, err := db.Exec(`
+        UPDATE enforcement_actions
+        SET after_ts_ms = ?, after_cpu_pct = ?, after_mem_kb = ?
+        WHERE id = ?;
+    `, after.TsMs, afterUsage.CPUPct, int64(after.MemCurrentBytes/1024), rowID)
+	if err != nil {
+		return fmt.Errorf("error actualizando enforcement_actions id=%d: %w", rowID, err)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// startTestWriter reemplaza el escritor global por uno sobre una DB en memoria.
+func startTestWriter(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+
+	saved := writer
+	ctx, cancel := context.WithCancel(context.Background())
+	writer = newDBWriter(db, 16, writerBlock)
+	go writer.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-writer.Done()
+		writer = saved
+		db.Close()
+	})
+	return db
+}
+
+// El "después" de una acción se toma de la primera muestra de cgroup
+// posterior; mientras tanto la fila queda pendiente.
+func TestApplyPendingAfterWaitsForNewerSample(t *testing.T) {
+	db := startTestWriter(t)
+	if err := CreateEnforcementActionsTable(db); err != nil {
+		t.Fatal(err)
+	}
+	saved := pendingAfter
+	pendingAfter = make(map[int64]pendingAction)
+	t.Cleanup(func() { pendingAfter = saved })
+
+	c := ContainerInfo{ID: "c1", Name: "stress-high-cpu-a"}
+	before := CgroupStats{TsMs: 1000, ContainerID: "c1", MemCurrentBytes: 512 << 20}
+	id, err := InsertEnforcementAction(db, 1500, c, enforceActionCgroup, "apply", "prueba", before, CgroupUsage{CPUPct: 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pendingAfter[id] = pendingAction{ContainerID: "c1", TsMs: 1500}
+
+	afterTs := func() sql.NullInt64 {
+		var ts sql.NullInt64
+		if err := db.QueryRow(`SELECT after_ts_ms FROM enforcement_actions WHERE id = ?`, id).Scan(&ts); err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	cases := []struct {
+		name        string
+		sampleTs    int64
+		wantPending bool
+	}{
+		{name: "muestra anterior a la acción", sampleTs: 1000, wantPending: true},
+		{name: "muestra posterior a la acción", sampleTs: 21000, wantPending: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := map[string]CgroupStats{"c1": {TsMs: tc.sampleTs, ContainerID: "c1", MemCurrentBytes: 100 << 20}}
+			applyPendingAfter(stats, map[string]CgroupUsage{"c1": {CPUPct: 10}})
+
+			_, pending := pendingAfter[id]
+			if pending != tc.wantPending {
+				t.Errorf("pendiente = %v, se esperaba %v", pending, tc.wantPending)
+			}
+			if ts := afterTs(); ts.Valid == tc.wantPending || (ts.Valid && ts.Int64 != tc.sampleTs) {
+				t.Errorf("after_ts_ms = %+v", ts)
+			}
+		})
+	}
+}
+
+func TestReleaseBelowPctOfCapValidate(t *testing.T) {
+	cases := []struct {
+		pct     float64
+		wantErr bool
+	}{
+		{pct: 0},
+		{pct: 50},
+		{pct: 99.5},
+		{pct: 100, wantErr: true},
+		{pct: -1, wantErr: true},
+	}
+	for _, tc := range cases {
+		c := defaultConfig()
+		c.ReleaseBelowPctOfCap = tc.pct
+		if err := c.validate(); (err != nil) != tc.wantErr {
+			t.Errorf("release_below_pct_of_cap=%v: validate() = %v, se esperaba error: %v", tc.pct, err, tc.wantErr)
+		}
+	}
+}
+
+// setupThrottleTest deja cfg, el cgroupfs falso, throttled y pendingAfter
+// aislados para el test, con la acción cgroup de 0.25 núcleos y 256 MB.
+func setupThrottleTest(t *testing.T) (db *sql.DB, root, limitedID, freeID string) {
+	t.Helper()
+	db = startTestWriter(t)
+	if err := CreateEnforcementActionsTable(db); err != nil {
+		t.Fatal(err)
+	}
+	root, limitedID, freeID = fakeCgroupTree(t)
+
+	savedCfg, savedRoot, savedThrottled, savedPending := cfg, cgroupRoot, throttled, pendingAfter
+	t.Cleanup(func() {
+		cfg, cgroupRoot, throttled, pendingAfter = savedCfg, savedRoot, savedThrottled, savedPending
+	})
+	cfg.EnforceAction = enforceActionCgroup
+	cfg.ThrottleCPUCores = 0.25
+	cfg.ThrottleMemoryMB = 256
+	cfg.ReleaseBelowPctOfCap = 50
+	cgroupRoot = root
+	throttled = make(map[string]*throttledContainer)
+	pendingAfter = make(map[int64]pendingAction)
+	return db, root, limitedID, freeID
+}
+
+// pctOfHost convierte núcleos a %CPU normalizado por cantidad de CPUs.
+func pctOfHost(cores float64) float64 {
+	return cores * 100 / float64(runtime.NumCPU())
+}
+
+func TestBelowReleaseThreshold(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.ThrottleCPUCores = 1
+	cfg.ThrottleMemoryMB = 100
+
+	cases := []struct {
+		name  string
+		pct   float64
+		cores float64
+		memMB uint64
+		delta bool
+		want  bool
+	}{
+		{name: "CPU y memoria bajas", pct: 50, cores: 0.2, memMB: 10, delta: true, want: true},
+		{name: "CPU sobre el umbral", pct: 50, cores: 0.6, memMB: 10, delta: true},
+		{name: "memoria sobre el umbral", pct: 50, cores: 0.2, memMB: 60, delta: true},
+		{name: "sin tasa de CPU", pct: 50, cores: 0, memMB: 0},
+		{name: "umbral 0 desactiva", pct: 0, cores: 0, memMB: 0, delta: true},
+	}
+	for _, tc := range cases {
+		cfg.ReleaseBelowPctOfCap = tc.pct
+		st := CgroupStats{MemCurrentBytes: tc.memMB << 20}
+		u := CgroupUsage{HasDelta: tc.delta, CPUPct: pctOfHost(tc.cores)}
+		if got := belowReleaseThreshold(st, u); got != tc.want {
+			t.Errorf("%s: belowReleaseThreshold = %v, se esperaba %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// Limitar con la acción cgroup escribe cpu.max/memory.high y liberar restaura
+// los valores originales; ambas acciones quedan registradas y pendientes.
+func TestThrottleAndReleaseCgroup(t *testing.T) {
+	db, root, limitedID, _ := setupThrottleTest(t)
+	dir := filepath.Join(root, "system.slice", "docker-"+limitedID+".scope")
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	c := ContainerInfo{ID: limitedID, Name: "stress-high-cpu-a"}
+	if err := throttleContainer(c, "prueba", CgroupStats{}, CgroupUsage{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("cpu.max"); got != "25000 100000" {
+		t.Errorf("cpu.max limitado = %q", got)
+	}
+	if got := read("memory.high"); got != "268435456" {
+		t.Errorf("memory.high limitado = %q", got)
+	}
+	tc := throttled[limitedID]
+	if tc == nil || tc.PrevCPUMax != "50000 100000" || tc.PrevMemHigh != "" || tc.ActionRowID == 0 {
+		t.Fatalf("estado limitado = %+v", tc)
+	}
+
+	if err := releaseContainer(tc, "prueba", CgroupStats{}, CgroupUsage{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("cpu.max"); got != "50000 100000" {
+		t.Errorf("cpu.max restaurado = %q", got)
+	}
+	if got := read("memory.high"); got != "max" {
+		t.Errorf("memory.high restaurado = %q", got)
+	}
+	if _, ok := throttled[limitedID]; ok {
+		t.Errorf("el contenedor sigue en throttled")
+	}
+
+	var phases string
+	if err := db.QueryRow(`SELECT group_concat(phase, ',') FROM (SELECT phase FROM enforcement_actions ORDER BY id)`).
+		Scan(&phases); err != nil {
+		t.Fatal(err)
+	}
+	if phases != "apply,release" || len(pendingAfter) != 2 {
+		t.Errorf("fases = %q, pendientes = %d", phases, len(pendingAfter))
+	}
+}
+
+func TestReconcileThrottled(t *testing.T) {
+	full := desiredCount(classHigh)
+	busy := CgroupUsage{HasDelta: true, CPUPct: pctOfHost(0.25)}
+	idle := CgroupUsage{HasDelta: true, CPUPct: pctOfHost(0.01)}
+
+	cases := []struct {
+		name         string
+		running      bool
+		unthrottled  int
+		usage        CgroupUsage
+		memMB        uint64
+		wantReleased bool
+		wantKept     bool
+	}{
+		{name: "ya no existe", running: false, unthrottled: full},
+		{name: "hay espacio en la clase", running: true, unthrottled: full - 1, usage: busy, memMB: 200, wantReleased: true},
+		{name: "uso bajo el umbral", running: true, unthrottled: full, usage: idle, memMB: 10, wantReleased: true},
+		{name: "sigue consumiendo", running: true, unthrottled: full, usage: busy, memMB: 10, wantKept: true},
+		{name: "sin muestra de cgroup", running: true, unthrottled: full, wantKept: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, _, limitedID, _ := setupThrottleTest(t)
+			c := ContainerInfo{ID: limitedID, Name: "stress-high-cpu-a"}
+			if err := throttleContainer(c, "prueba", CgroupStats{}, CgroupUsage{}); err != nil {
+				t.Fatal(err)
+			}
+
+			running := map[string]ContainerInfo{}
+			if tc.running {
+				running[limitedID] = c
+			}
+			stats := map[string]CgroupStats{limitedID: {ContainerID: limitedID, MemCurrentBytes: tc.memMB << 20}}
+			reconcileThrottled(running, tc.unthrottled, stats, map[string]CgroupUsage{limitedID: tc.usage})
+
+			if _, kept := throttled[limitedID]; kept != tc.wantKept {
+				t.Errorf("sigue limitado = %v, se esperaba %v", kept, tc.wantKept)
+			}
+			var releases int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM enforcement_actions WHERE phase = 'release'`).Scan(&releases); err != nil {
+				t.Fatal(err)
+			}
+			if (releases == 1) != tc.wantReleased {
+				t.Errorf("liberaciones = %d, se esperaba liberado = %v", releases, tc.wantReleased)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cómo se genera la carga de contenedores
+const (
+	workloadModeNative = "native" // generador en Go (workload.go)
+	workloadModeScript = "script" // cronjob/stress_container.sh
+	workloadModeOff    = "off"
+)
+
+// Tipos de contenedor que sabe crear el generador
+const (
+	workloadHighCPU = "high-cpu"
+	workloadHighRAM = "high-ram"
+	workloadLow     = "low"
+)
+
+// Dockerfiles de las imágenes de estrés, compartidos con cronjob/stress_container.sh.
+// El comando se pasa al crear el contenedor para poder variar los parámetros.
+const stressImagesDir = "../cronjob/images"
+
+var stressImages = newImageBuilder(hostExecutor{}, stressImagesDir, map[string]string{
+	"stress-high-cpu:so1": "stress-high-cpu.Dockerfile",
+	"stress-high-ram:so1": "stress-high-ram.Dockerfile",
+	"stress-low:so1":      "stress-low.Dockerfile",
+})
+
+// WorkloadTypeParams son los parámetros de stress-ng por tipo de contenedor.
+type WorkloadTypeParams struct {
+	CPUWorkers int    `json:"cpu_workers"`
+	VMWorkers  int    `json:"vm_workers"`
+	VMBytes    string `json:"vm_bytes"`
+}
+
+// WorkloadScenario describe la carga a generar.
+type WorkloadScenario struct {
+	Seed            int64 `json:"seed"`             // 0 = semilla según la hora
+	DurationSeconds int   `json:"duration_seconds"` // 0 = sin fin
+
+	// Llegadas continuas (exponencial con esta media); 0 = desactivado
+	ArrivalIntervalSeconds float64 `json:"arrival_interval_seconds"`
+
+	// Ráfagas: BurstSize contenedores cada BurstEverySeconds, separados BurstSpacingSeconds
+	BurstEverySeconds   int     `json:"burst_every_seconds"`
+	BurstSize           int     `json:"burst_size"`
+	BurstSpacingSeconds float64 `json:"burst_spacing_seconds"`
+
+	// Proporción relativa de cada tipo (high-cpu, high-ram, low)
+	Mix map[string]float64 `json:"mix"`
+
+	Types map[string]WorkloadTypeParams `json:"types"`
+
+	// Máximo de contenedores del generador vivos a la vez (0 = sin límite)
+	MaxAlive int `json:"max_alive"`
+}
+
+// defaultWorkloadScenario reproduce el comportamiento de stress_container.sh:
+// 10 contenedores al azar cada ~70s (10 x 1s + 60s de espera).
+func defaultWorkloadScenario() WorkloadScenario {
+	return WorkloadScenario{
+		BurstEverySeconds:   70,
+		BurstSize:           10,
+		BurstSpacingSeconds: 1,
+		Mix: map[string]float64{
+			workloadHighCPU: 1,
+			workloadHighRAM: 1,
+			workloadLow:     1,
+		},
+		Types: map[string]WorkloadTypeParams{
+			workloadHighCPU: {CPUWorkers: 2},
+			workloadHighRAM: {VMWorkers: 1, VMBytes: "256M"},
+		},
+	}
+}
+
+func (s WorkloadScenario) validate() error {
+	if s.ArrivalIntervalSeconds <= 0 && (s.BurstEverySeconds <= 0 || s.BurstSize <= 0) {
+		return fmt.Errorf("el escenario no genera contenedores: falta arrival_interval_seconds o burst_every_seconds/burst_size")
+	}
+	total := 0.0
+	for typ, w := range s.Mix {
+		if _, ok := workloadTemplate(typ); !ok {
+			return fmt.Errorf("tipo de contenedor desconocido en mix: %q", typ)
+		}
+		if w < 0 {
+			return fmt.Errorf("proporción negativa para %q", typ)
+		}
+		total += w
+	}
+	if total <= 0 {
+		return fmt.Errorf("mix debe tener al menos un tipo con proporción > 0")
+	}
+	return nil
+}
+
+// WorkloadStatus es el estado del generador expuesto por la API.
+type WorkloadStatus struct {
+	Running     bool             `json:"running"`
+	Seed        int64            `json:"seed"`
+	StartedTsMs int64            `json:"started_ts_ms"`
+	Created     map[string]int   `json:"created"`
+	Errors      int              `json:"errors"`
+	Scenario    WorkloadScenario `json:"scenario"`
+}
+
+type workloadGenerator struct {
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    chan struct{}
+	status  WorkloadStatus
+	created []string // IDs creados (para contar los vivos)
+}
+
+var workload = &workloadGenerator{}
+
+// Start lanza el generador con el escenario dado. Falla si ya está corriendo.
+func (g *workloadGenerator) Start(scn WorkloadScenario) error {
+	if err := scn.validate(); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.status.Running {
+		return fmt.Errorf("el generador de carga ya está corriendo")
+	}
+
+	if scn.Seed == 0 {
+		scn.Seed = time.Now().UnixNano()
+	}
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if scn.DurationSeconds > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(scn.DurationSeconds)*time.Second)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	g.cancel = cancel
+	g.done = make(chan struct{})
+	g.created = nil
+	g.status = WorkloadStatus{
+		Running:     true,
+		Seed:        scn.Seed,
+		StartedTsMs: time.Now().UnixMilli(),
+		Created:     make(map[string]int),
+		Scenario:    scn,
+	}
+
+	fmt.Printf("Generador de carga iniciado (semilla %d)\n", scn.Seed)
+	go g.run(ctx, scn)
+	return nil
+}
+
+// Stop detiene el generador y espera a que termine. No detiene los contenedores creados.
+func (g *workloadGenerator) Stop() {
+	g.mu.Lock()
+	cancel, done := g.cancel, g.done
+	g.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+func (g *workloadGenerator) Status() WorkloadStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st := g.status
+	st.Created = make(map[string]int, len(g.status.Created))
+	for k, v := range g.status.Created {
+		st.Created[k] = v
+	}
+	return st
+}
+
+func (g *workloadGenerator) run(ctx context.Context, scn WorkloadScenario) {
+	defer func() {
+		g.mu.Lock()
+		g.status.Running = false
+		g.cancel = nil
+		close(g.done)
+		g.mu.Unlock()
+		fmt.Println("Generador de carga detenido.")
+	}()
+
+	if err := stressImages.Ensure(ctx); err != nil {
+		fmt.Println("Error preparando imágenes de estrés:", err)
+		return
+	}
+
+	// Una sola fuente aleatoria: misma semilla, misma secuencia de tipos y tiempos
+	rng := rand.New(rand.NewSource(scn.Seed))
+
+	var nextArrival, nextBurst <-chan time.Time
+	if scn.ArrivalIntervalSeconds > 0 {
+		nextArrival = time.After(expDuration(rng, scn.ArrivalIntervalSeconds))
+	}
+	if scn.BurstEverySeconds > 0 && scn.BurstSize > 0 {
+		nextBurst = time.After(0)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-nextArrival:
+			g.spawn(scn, pickWorkloadType(rng, scn.Mix))
+			nextArrival = time.After(expDuration(rng, scn.ArrivalIntervalSeconds))
+
+		case <-nextBurst:
+			fmt.Printf("Generando ráfaga de %d contenedores: %s\n", scn.BurstSize, time.Now().Format(time.RFC3339))
+			for i := 0; i < scn.BurstSize; i++ {
+				g.spawn(scn, pickWorkloadType(rng, scn.Mix))
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Duration(scn.BurstSpacingSeconds * float64(time.Second))):
+				}
+			}
+			nextBurst = time.After(time.Duration(scn.BurstEverySeconds) * time.Second)
+		}
+	}
+}
+
+// spawn crea un contenedor del tipo dado respetando MaxAlive.
+func (g *workloadGenerator) spawn(scn WorkloadScenario, typ string) {
+	if scn.MaxAlive > 0 && g.aliveCount() >= scn.MaxAlive {
+		fmt.Printf("     (generador: %d contenedores vivos, máximo alcanzado)\n", scn.MaxAlive)
+		return
+	}
+
+	tpl, _ := workloadTemplate(typ)
+	class := classLow
+	if typ != workloadLow {
+		class = classHigh
+	}
+
+	c, err := startContainer(class, tpl, workloadArgs(typ, scn.Types[typ]))
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err != nil {
+		fmt.Println("    ", err)
+		g.status.Errors++
+		return
+	}
+	g.status.Created[typ]++
+	g.created = append(g.created, c.ID)
+}
+
+// aliveCount cuenta cuántos de los contenedores creados siguen corriendo.
+func (g *workloadGenerator) aliveCount() int {
+	running, err := listRunningContainersFull()
+	if err != nil {
+		return 0
+	}
+	ids := make(map[string]bool, len(running))
+	for _, c := range running {
+		ids[c.ID] = true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	alive := g.created[:0]
+	for _, id := range g.created {
+		if ids[id] {
+			alive = append(alive, id)
+		}
+	}
+	g.created = alive
+	return len(alive)
+}
+
+// pickWorkloadType elige un tipo según las proporciones del mix.
+// Se recorre en orden fijo para que la semilla sea reproducible.
+func pickWorkloadType(rng *rand.Rand, mix map[string]float64) string {
+	order := []string{workloadHighCPU, workloadHighRAM, workloadLow}
+	total := 0.0
+	for _, typ := range order {
+		total += mix[typ]
+	}
+	r := rng.Float64() * total
+	for _, typ := range order {
+		r -= mix[typ]
+		if r < 0 {
+			return typ
+		}
+	}
+	return workloadLow
+}
+
+func expDuration(rng *rand.Rand, meanSeconds float64) time.Duration {
+	return time.Duration(rng.ExpFloat64() * meanSeconds * float64(time.Second))
+}
+
+func workloadTemplate(typ string) (ContainerTemplate, bool) {
+	switch typ {
+	case workloadHighCPU:
+		return ContainerTemplate{NamePrefix: highCPUPrefix, Image: "stress-high-cpu:so1"}, true
+	case workloadHighRAM:
+		return ContainerTemplate{NamePrefix: highRAMPrefix, Image: "stress-high-ram:so1"}, true
+	case workloadLow:
+		return ContainerTemplate{NamePrefix: lowPrefix, Image: "stress-low:so1"}, true
+	}
+	return ContainerTemplate{}, false
+}
+
+// workloadArgs arma el comando de stress-ng; nil usa el CMD de la imagen.
+func workloadArgs(typ string, p WorkloadTypeParams) []string {
+	switch typ {
+	case workloadHighCPU:
+		if p.CPUWorkers > 0 {
+			return []string{"stress-ng", "--cpu", strconv.Itoa(p.CPUWorkers), "--metrics-brief"}
+		}
+	case workloadHighRAM:
+		if p.VMWorkers > 0 || p.VMBytes != "" {
+			workers := p.VMWorkers
+			if workers <= 0 {
+				workers = 1
+			}
+			vmBytes := p.VMBytes
+			if vmBytes == "" {
+				vmBytes = "256M"
+			}
+			return []string{"stress-ng", "--vm", strconv.Itoa(workers), "--vm-bytes", vmBytes, "--metrics-brief"}
+		}
+	}
+	return nil
+}
+
+// imageBuilder construye las imágenes propias que falten, una sola vez y en
+// segundo plano. Es el único lugar que las prepara: startContainer pregunta
+// por Ready antes de cada docker run.
+type imageBuilder struct {
+	mu          sync.Mutex
+	exec        Executor
+	dir         string
+	dockerfiles map[string]string // imagen -> Dockerfile en dir
+	ready       map[string]bool
+	building    map[string]*imageBuild
+}
+
+// imageBuild es una construcción en curso; done se cierra al terminar.
+type imageBuild struct {
+	done chan struct{}
+	err  error
+}
+
+func newImageBuilder(exec Executor, dir string, dockerfiles map[string]string) *imageBuilder {
+	return &imageBuilder{
+		exec:        exec,
+		dir:         dir,
+		dockerfiles: dockerfiles,
+		ready:       make(map[string]bool),
+		building:    make(map[string]*imageBuild),
+	}
+}
+
+// Ready indica si image puede usarse ya. Si es una imagen propia que aún no
+// existe lanza su construcción y devuelve false; las ajenas las baja docker run.
+func (b *imageBuilder) Ready(image string) bool {
+	ready, _ := b.start(image)
+	return ready
+}
+
+// Ensure espera a que estén todas las imágenes propias (o a que se cancele ctx).
+func (b *imageBuilder) Ensure(ctx context.Context) error {
+	for image := range b.dockerfiles {
+		ready, build := b.start(image)
+		if ready {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-build.done:
+		}
+		if build.err != nil {
+			return build.err
+		}
+	}
+	return nil
+}
+
+func (b *imageBuilder) start(image string) (bool, *imageBuild) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dockerfile, ok := b.dockerfiles[image]
+	if !ok || b.ready[image] {
+		return true, nil
+	}
+	if build := b.building[image]; build != nil {
+		return false, build
+	}
+	build := &imageBuild{done: make(chan struct{})}
+	b.building[image] = build
+	go b.build(image, dockerfile, build)
+	return false, build
+}
+
+// build revisa si la imagen ya existe y si no la construye desde su Dockerfile.
+func (b *imageBuilder) build(image, dockerfile string, build *imageBuild) {
+	var err error
+	if _, inspectErr := b.exec.Run(5*time.Second, "docker", "image", "inspect", image); inspectErr != nil {
+		fmt.Println("Construyendo imagen:", image)
+		if _, buildErr := b.exec.Run(15*time.Minute, "docker", "build", "-t", image,
+			"-f", filepath.Join(b.dir, dockerfile), b.dir); buildErr != nil {
+			err = fmt.Errorf("error construyendo %s: %w", image, buildErr)
+			fmt.Println(err)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.building, image)
+	if err == nil {
+		b.ready[image] = true
+	}
+	build.err = err
+	close(build.done)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeImages simula docker image inspect/build sobre un conjunto de imágenes.
+type fakeImages struct {
+	mu        sync.Mutex
+	present   map[string]bool
+	buildFail bool
+	builds    []string
+	release   chan struct{} // si no es nil, docker build espera hasta que se cierre
+}
+
+func (d *fakeImages) Run(timeout time.Duration, name string, args ...string) (string, error) {
+	switch args[0] {
+	case "image":
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if !d.present[args[2]] {
+			return "", fmt.Errorf("no such image")
+		}
+	case "build":
+		if d.release != nil {
+			<-d.release
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.builds = append(d.builds, strings.Join(args[1:], " "))
+		if d.buildFail {
+			return "", fmt.Errorf("error de build")
+		}
+		d.present[args[2]] = true
+	}
+	return "", nil
+}
+
+func TestImageBuilderEnsure(t *testing.T) {
+	cases := []struct {
+		name       string
+		present    map[string]bool
+		buildFail  bool
+		wantErr    bool
+		wantBuilds []string
+	}{
+		{
+			name:    "ya existen",
+			present: map[string]bool{"cpu:1": true, "low:1": true},
+		},
+		{
+			name:       "falta una",
+			present:    map[string]bool{"low:1": true},
+			wantBuilds: []string{"-t cpu:1 -f /imgs/cpu.Dockerfile /imgs"},
+		},
+		{
+			name:       "falla el build",
+			present:    map[string]bool{"low:1": true},
+			buildFail:  true,
+			wantErr:    true,
+			wantBuilds: []string{"-t cpu:1 -f /imgs/cpu.Dockerfile /imgs"},
+		},
+	}
+	for _, tc := range cases {
+		d := &fakeImages{present: tc.present, buildFail: tc.buildFail}
+		b := newImageBuilder(d, "/imgs", map[string]string{"cpu:1": "cpu.Dockerfile", "low:1": "low.Dockerfile"})
+		err := b.Ensure(context.Background())
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: error = %v", tc.name, err)
+		}
+		if strings.Join(d.builds, "|") != strings.Join(tc.wantBuilds, "|") {
+			t.Errorf("%s: builds = %q, se esperaba %q", tc.name, d.builds, tc.wantBuilds)
+		}
+		// una imagen ajena nunca se construye
+		if !b.Ready("grafana/grafana") {
+			t.Errorf("%s: imagen ajena no lista", tc.name)
+		}
+		if got := b.Ready("cpu:1"); got == tc.wantErr {
+			t.Errorf("%s: Ready(cpu:1) = %v", tc.name, got)
+		}
+	}
+}
+
+// Ready no bloquea mientras la imagen se construye y no lanza builds repetidos.
+func TestImageBuilderReadyDuringBuild(t *testing.T) {
+	d := &fakeImages{present: map[string]bool{}, release: make(chan struct{})}
+	b := newImageBuilder(d, "/imgs", map[string]string{"cpu:1": "cpu.Dockerfile"})
+
+	for i := 0; i < 3; i++ {
+		if b.Ready("cpu:1") {
+			t.Fatal("imagen lista antes de construirse")
+		}
+	}
+	close(d.release)
+	if err := b.Ensure(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !b.Ready("cpu:1") || len(d.builds) != 1 {
+		t.Errorf("Ready = %v, builds = %q; se esperaba un solo build", b.Ready("cpu:1"), d.builds)
+	}
+}
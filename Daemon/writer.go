@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Políticas cuando la cola del escritor está llena
+const (
+	writerDropNewest = "drop-newest" // se descarta el lote que llega
+	writerDropOldest = "drop-oldest" // se descarta el lote más viejo de la cola
+	writerBlock      = "block"       // el colector espera (back-pressure)
+)
+
+// writeJob es un lote de escrituras de un colector.
+type writeJob struct {
+	name       string
+	enqueuedAt time.Time
+	fn         func(db *sql.DB) error
+}
+
+type syncWriteJob struct {
+	fn   func(db *sql.DB) error
+	done chan error
+}
+
+// WriterStats son los contadores del escritor (API).
+type WriterStats struct {
+	Policy     string           `json:"policy"`
+	QueueLen   int              `json:"queue_len"`
+	QueueCap   int              `json:"queue_cap"`
+	Enqueued   int64            `json:"enqueued"`
+	Written    int64            `json:"written"`
+	Errors     int64            `json:"errors"`
+	Dropped    map[string]int64 `json:"dropped"`
+	MaxLagMs   int64            `json:"max_lag_ms"`
+	LastLagMs  int64            `json:"last_lag_ms"`
+	LastError  string           `json:"last_error,omitempty"`
+	LastWrite  int64            `json:"last_write_ts_ms"`
+	SyncWrites int64            `json:"sync_writes"`
+}
+
+// dbWriter es la única goroutine que escribe en la DB. Los colectores encolan
+// lotes con Submit (cola acotada); el orquestador usa Do, que espera el resultado.
+type dbWriter struct {
+	db     *sql.DB
+	policy string
+	queue  chan writeJob
+	syncq  chan syncWriteJob
+	done   chan struct{} // se cierra cuando Run terminó de vaciar la cola
+
+	mu    sync.Mutex
+	stats WriterStats
+}
+
+var writer *dbWriter
+
+func newDBWriter(db *sql.DB, size int, policy string) *dbWriter {
+	return &dbWriter{
+		db:     db,
+		policy: policy,
+		queue:  make(chan writeJob, size),
+		syncq:  make(chan syncWriteJob),
+		done:   make(chan struct{}),
+		stats:  WriterStats{Policy: policy, QueueCap: size, Dropped: make(map[string]int64)},
+	}
+}
+
+// Submit encola un lote según la política. Devuelve false si se descartó.
+func (w *dbWriter) Submit(name string, fn func(db *sql.DB) error) bool {
+	job := writeJob{name: name, enqueuedAt: time.Now(), fn: fn}
+
+	switch w.policy {
+	case writerBlock:
+		w.queue <- job
+		w.countEnqueued()
+		return true
+
+	case writerDropOldest:
+		for {
+			select {
+			case w.queue <- job:
+				w.countEnqueued()
+				return true
+			default:
+			}
+			select {
+			case old := <-w.queue:
+				w.countDropped(old.name)
+			default:
+			}
+		}
+
+	default: // writerDropNewest
+		select {
+		case w.queue <- job:
+			w.countEnqueued()
+			return true
+		default:
+			w.countDropped(name)
+			return false
+		}
+	}
+}
+
+// Do ejecuta fn en la goroutine del escritor y espera su resultado.
+// Tiene prioridad sobre la cola y nunca se descarta mientras el escritor corre.
+func (w *dbWriter) Do(fn func(db *sql.DB) error) error {
+	done := make(chan error, 1)
+	select {
+	case w.syncq <- syncWriteJob{fn: fn, done: done}:
+		return <-done
+	case <-w.done:
+		return fmt.Errorf("el escritor ya se detuvo")
+	}
+}
+
+// Run procesa las escrituras hasta que se cancela ctx; entonces escribe lo
+// que quedó en la cola y cierra Done.
+func (w *dbWriter) Run(ctx context.Context) {
+	defer close(w.done)
+	for {
+		// primero las escrituras síncronas del orquestador
+		select {
+		case j := <-w.syncq:
+			w.runSync(j)
+			continue
+		default:
+		}
+
+		select {
+		case <-ctx.Done():
+			w.drain()
+			return
+		case j := <-w.syncq:
+			w.runSync(j)
+		case j := <-w.queue:
+			err := j.fn(w.db)
+			w.finish(j.name, time.Since(j.enqueuedAt), err)
+		}
+	}
+}
+
+// drain escribe los lotes que quedaron encolados al detenerse.
+func (w *dbWriter) drain() {
+	for {
+		select {
+		case j := <-w.queue:
+			err := j.fn(w.db)
+			w.finish(j.name, time.Since(j.enqueuedAt), err)
+		default:
+			return
+		}
+	}
+}
+
+// Done se cierra cuando el escritor terminó.
+func (w *dbWriter) Done() <-chan struct{} {
+	return w.done
+}
+
+func (w *dbWriter) runSync(j syncWriteJob) {
+	err := j.fn(w.db)
+	w.mu.Lock()
+	w.stats.SyncWrites++
+	w.mu.Unlock()
+	j.done <- err
+}
+
+func (w *dbWriter) finish(name string, lag time.Duration, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.Written++
+	w.stats.LastWrite = time.Now().UnixMilli()
+	w.stats.LastLagMs = lag.Milliseconds()
+	if w.stats.LastLagMs > w.stats.MaxLagMs {
+		w.stats.MaxLagMs = w.stats.LastLagMs
+	}
+	if err != nil {
+		w.stats.Errors++
+		w.stats.LastError = fmt.Sprintf("%s: %v", name, err)
+		fmt.Printf("Error escribiendo lote %s: %v\n", name, err)
+	}
+}
+
+func (w *dbWriter) countEnqueued() {
+	w.mu.Lock()
+	w.stats.Enqueued++
+	w.mu.Unlock()
+}
+
+func (w *dbWriter) countDropped(name string) {
+	w.mu.Lock()
+	w.stats.Dropped[name]++
+	w.mu.Unlock()
+	fmt.Printf(" Escritor atrasado: se descartó un lote de %s (política %s)\n", name, w.policy)
+}
+
+func (w *dbWriter) Status() WriterStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	st := w.stats
+	st.QueueLen = len(w.queue)
+	st.Dropped = make(map[string]int64, len(w.stats.Dropped))
+	for k, v := range w.stats.Dropped {
+		st.Dropped[k] = v
+	}
+	return st
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// Al cancelarse el contexto el escritor escribe lo que quedó encolado antes
+// de terminar, y Do deja de bloquear.
+func TestDBWriterDrainsOnCancel(t *testing.T) {
+	w := newDBWriter(nil, 10, writerBlock)
+
+	written := 0
+	for i := 0; i < 5; i++ {
+		w.Submit("prueba", func(db *sql.DB) error {
+			written++
+			return nil
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	go w.Run(ctx)
+
+	select {
+	case <-w.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("el escritor no terminó")
+	}
+	if written != 5 {
+		t.Errorf("lotes escritos = %d, se esperaban 5", written)
+	}
+	if err := w.Do(func(db *sql.DB) error { return nil }); err == nil {
+		t.Error("Do con el escritor detenido: se esperaba error")
+	}
+}
@@ -10,55 +10,19 @@ IMAGE_HIGH_CPU="stress-high-cpu:so1"
 IMAGE_HIGH_RAM="stress-high-ram:so1"
 IMAGE_LOW_LOAD="stress-low:so1"
 
+# Dockerfiles compartidos con el daemon (Daemon/workload.go)
+IMAGES_DIR="$(dirname "$0")/images"
+
 echo "Construyendo imágenes de Docker para las pruebas de consumo..."
 
-# ==============================
-# 1) Imagen de ALTO consumo CPU
-# ==============================
 echo "Construyendo imagen de ALTO consumo de CPU: ${IMAGE_HIGH_CPU}"
-docker build -t "${IMAGE_HIGH_CPU}" - << 'EOF'
-FROM ubuntu:20.04
-
-ENV DEBIAN_FRONTEND=noninteractive
+docker build -t "${IMAGE_HIGH_CPU}" -f "${IMAGES_DIR}/stress-high-cpu.Dockerfile" "${IMAGES_DIR}"
 
-RUN apt-get update \
-    && apt-get install -y stress-ng \
-    && rm -rf /var/lib/apt/lists/*
-
-CMD ["bash", "-c", "echo 'Iniciando stress CPU'; stress-ng --cpu 2  --metrics-brief"]
-EOF
-
-# ==============================
-# 2) Imagen de ALTO consumo RAM
-# ==============================
 echo "Construyendo imagen de ALTO consumo de RAM: ${IMAGE_HIGH_RAM}"
-docker build -t "${IMAGE_HIGH_RAM}" - << 'EOF'
-FROM ubuntu:20.04
+docker build -t "${IMAGE_HIGH_RAM}" -f "${IMAGES_DIR}/stress-high-ram.Dockerfile" "${IMAGES_DIR}"
 
-ENV DEBIAN_FRONTEND=noninteractive
-
-RUN apt-get update \
-    && apt-get install -y stress-ng \
-    && rm -rf /var/lib/apt/lists/*
-
-CMD ["bash", "-c", "echo 'Iniciando stress RAM'; stress-ng --vm 1 --vm-bytes 256M --metrics-brief"]
-EOF
-
-# ==============================
-# 3) Imagen de BAJO consumo
-# ==============================
 echo "Construyendo imagen de BAJO consumo de CPU/RAM: ${IMAGE_LOW_LOAD}"
-docker build -t "${IMAGE_LOW_LOAD}" - << 'EOF'
-FROM ubuntu:20.04
-
-ENV DEBIAN_FRONTEND=noninteractive
-
-RUN printf '#!/bin/bash\nwhile true; do sleep 30; done\n' \
-    > /usr/local/bin/stress-low \
-    && chmod +x /usr/local/bin/stress-low
-
-CMD ["stress-low"]
-EOF
+docker build -t "${IMAGE_LOW_LOAD}" -f "${IMAGES_DIR}/stress-low.Dockerfile" "${IMAGES_DIR}"
 
 echo "Imágenes construidas."
 echo
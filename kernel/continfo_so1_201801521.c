@@ -19,13 +19,17 @@
 #include <linux/string.h>
 
 
+/* Versión del formato JSON: subirla al cambiar/quitar campos (ver Daemon/schema.go) */
+#define SNAPSHOT_SCHEMA_VERSION 1
+#define MODULE_VER "1.1.0"
+
 #define PROC_NAME "continfo_so1_201801521"
 #define CMDLINE_MAX 1024
 
 MODULE_LICENSE("GPL");
 MODULE_AUTHOR("201801521");
 MODULE_DESCRIPTION("Listado de procesos de contenedores");
-MODULE_VERSION("1.0");
+MODULE_VERSION(MODULE_VER);
 
 static struct proc_dir_entry *proc_entry;
 
@@ -93,6 +97,8 @@ static int continfo_so1_201801521_show(struct seq_file *m, void *v)
             (unsigned long long)(ts.tv_nsec / 1000000ULL);
 
     seq_printf(m, "{\n");
+    seq_printf(m, "  \"schema_version\": %d,\n", SNAPSHOT_SCHEMA_VERSION);
+    seq_printf(m, "  \"module_version\": \"%s\",\n", MODULE_VER);
     seq_printf(m, "  \"total_ram_kb\": %lu,\n", total_ram_kb);
     seq_printf(m, "  \"free_ram_kb\": %lu,\n", free_ram_kb);
     seq_printf(m, "  \"used_ram_kb\": %lu,\n", used_ram_kb);
@@ -12,14 +12,20 @@
 #include <linux/fs.h>
 #include <linux/uaccess.h>
 #include <linux/sched/cputime.h>
+#include <linux/cred.h>
+#include <linux/uidgid.h>
 
 
+/* Versión del formato JSON: subirla al cambiar/quitar campos (ver Daemon/schema.go) */
+#define SNAPSHOT_SCHEMA_VERSION 4
+#define MODULE_VER "1.6.0"
+
 #define PROC_NAME "sysinfo_so1_201801521"
 
 MODULE_LICENSE("GPL");
 MODULE_AUTHOR("201801521");
 MODULE_DESCRIPTION("Modulo de monitoreo de sistema: RAM, CPU y procesos");
-MODULE_VERSION("1.2.1");
+MODULE_VERSION(MODULE_VER);
 
 static struct proc_dir_entry *proc_entry;
 static unsigned long prev_idle = 0;
@@ -161,6 +167,7 @@ static int sysinfo_show(struct seq_file *m, void *v)
     unsigned long cpu_usage_pct = 0;
     struct timespec64 ts;
     unsigned long long ts_ms = 0;
+    unsigned long long boottime_ns = 0;
     struct task_struct *task;
     long total_procs = 0;
     bool first_proc = true;
@@ -180,6 +187,9 @@ static int sysinfo_show(struct seq_file *m, void *v)
     ts_ms = (unsigned long long)ts.tv_sec * 1000ULL +
             (unsigned long long)(ts.tv_nsec / 1000000ULL);
 
+    /* reloj monótono (incluye suspensión): intervalos sin saltos de reloj */
+    boottime_ns = (unsigned long long)ktime_get_boottime_ns();
+
     /* contar procesos en una pasada */
     rcu_read_lock();
     for_each_process(task) {
@@ -189,6 +199,8 @@ static int sysinfo_show(struct seq_file *m, void *v)
 
     /* imprimir cabecera JSON */
     seq_printf(m, "{\n");
+    seq_printf(m, "  \"schema_version\": %d,\n", SNAPSHOT_SCHEMA_VERSION);
+    seq_printf(m, "  \"module_version\": \"%s\",\n", MODULE_VER);
     seq_printf(m, "  \"total_ram_kb\": %lu,\n", total_ram_kb);
     seq_printf(m, "  \"free_ram_kb\": %lu,\n", free_ram_kb);
     seq_printf(m, "  \"available_kb\": %lu,\n", available_kb);
@@ -196,6 +208,9 @@ static int sysinfo_show(struct seq_file *m, void *v)
     seq_printf(m, "  \"total_procs\": %ld,\n", total_procs);
     seq_printf(m, "  \"cpu_usage_pct\": %lu,\n", cpu_usage_pct);
     seq_printf(m, "  \"ts_ms\": %llu,\n", ts_ms);
+    seq_printf(m, "  \"boottime_ns\": %llu,\n", boottime_ns);
+    /* utime/stime de task_cputime_adjusted vienen en nanosegundos */
+    seq_printf(m, "  \"cpu_time_unit\": \"ns\",\n");
 
     /* iniciar array de procesos */
     seq_printf(m, "  \"procesos\": [\n");
@@ -209,6 +224,12 @@ static int sysinfo_show(struct seq_file *m, void *v)
         unsigned long vmsize_kb = 0;
         unsigned long long utime_val = 0;
         unsigned long long stime_val = 0;
+        /* inicio del proceso desde el arranque (ns); con el pid identifica al proceso */
+        unsigned long long start_ns = (unsigned long long)task->start_boottime;
+        /* padre real (tgid); seguro dentro de rcu_read_lock */
+        pid_t ppid = task_tgid_nr(rcu_dereference(task->real_parent));
+        /* uid real visto desde el namespace inicial */
+        uid_t uid = from_kuid_munged(&init_user_ns, task_uid(task));
         char state_ch;
         struct mm_struct *mm = NULL;
 
@@ -244,8 +265,8 @@ state_ch = task_state_char(task);
             first_proc = false;
 
         seq_printf(m,
-            "    { \"pid\": %d, \"comm\": \"%s\", \"rss_kb\": %lu, \"vmsize_kb\": %lu, \"state\": \"%c\", \"utime\": %llu, \"stime\": %llu, \"ts_ms\": %llu }",
-            pid, comm, rss_kb, vmsize_kb, state_ch, utime_val, stime_val, ts_ms);
+            "    { \"pid\": %d, \"ppid\": %d, \"uid\": %u, \"comm\": \"%s\", \"rss_kb\": %lu, \"vmsize_kb\": %lu, \"state\": \"%c\", \"utime\": %llu, \"stime\": %llu, \"start_time_ns\": %llu, \"ts_ms\": %llu }",
+            pid, ppid, uid, comm, rss_kb, vmsize_kb, state_ch, utime_val, stime_val, start_ns, ts_ms);
     }
     rcu_read_unlock();
 